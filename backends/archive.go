@@ -0,0 +1,735 @@
+package backends
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vimalk78/fs-mcp/policy"
+)
+
+const (
+	// maxArchiveEntries bounds the number of entries indexed for one archive
+	maxArchiveEntries = 1000000
+	// maxArchiveSpool bounds the decompressed size of an archive spooled to a temporary file
+	maxArchiveSpool = 4 << 30
+)
+
+// ArchiveConfig holds the settings of an archive repository; its path is the archive file
+type ArchiveConfig struct {
+	Format string `json:"format"` // "tar", "tar.gz" or "zip" (default from the file name)
+	Source string `json:"source"` // Repository the archive is read from, path relative to its root
+}
+
+func init() {
+	RegisterBackend("archive", &Backend{
+		Decode: decodeArchiveConfig,
+		Open: func(ctx context.Context, repo *Repository, pool *Pool) (FileSystem, error) {
+			return pool.archives.get(ctx, repo, pool)
+		},
+		Location: func(repo *Repository) string {
+			if cfg := repo.Config.(*ArchiveConfig); cfg.Source != "" {
+				return fmt.Sprintf("%s:%s", cfg.Source, repo.Path)
+			}
+			return repo.Path
+		},
+		Ready: func(repo *Repository, pool *Pool) bool {
+			if cfg := repo.Config.(*ArchiveConfig); cfg.Source != "" {
+				src, ok := pool.lookup(cfg.Source)
+				if !ok || !pool.Ready(src) {
+					return false
+				}
+			}
+			return pool.archives.loaded(repo)
+		},
+	})
+}
+
+// decodeArchiveConfig parses and validates an archive repository's settings
+func decodeArchiveConfig(repo *Repository, raw json.RawMessage) (interface{}, error) {
+	var cfg ArchiveConfig
+	if err := decodeConfig(repo, raw, &cfg); err != nil {
+		return nil, err
+	}
+	if repo.Path == "" {
+		return nil, fmt.Errorf("repository %s: archive repo requires 'path'", repo.Name)
+	}
+	if cfg.Format == "" {
+		cfg.Format = archiveFormat(repo.Path)
+	}
+	switch cfg.Format {
+	case "tar", "zip":
+	case "tar.gz", "tgz":
+		cfg.Format = "tar.gz"
+	case "":
+		return nil, fmt.Errorf("repository %s: can't tell the archive format of %s, set 'format' to tar, tar.gz or zip", repo.Name, repo.Path)
+	default:
+		return nil, fmt.Errorf("repository %s: unknown archive format %s (expected tar, tar.gz or zip)", repo.Name, cfg.Format)
+	}
+	if cfg.Source == repo.Name {
+		return nil, fmt.Errorf("repository %s: archive repo can't be its own source", repo.Name)
+	}
+	return &cfg, nil
+}
+
+// archiveFormat picks an archive format from a file name
+func archiveFormat(name string) string {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return "tar.gz"
+	case strings.HasSuffix(lower, ".tar"):
+		return "tar"
+	case strings.HasSuffix(lower, ".zip"), strings.HasSuffix(lower, ".jar"), strings.HasSuffix(lower, ".whl"):
+		return "zip"
+	}
+	return ""
+}
+
+// archiveEntry is one file, directory or link in an archive. It implements fs.FileInfo.
+type archiveEntry struct {
+	name     string
+	size     int64
+	mode     fs.FileMode
+	modTime  time.Time
+	link     string    // symlink target, or the path a tar hard link refers to
+	offset   int64     // start of the file's data in a tar archive
+	zip      *zip.File // the file in a zip archive
+	children []string  // sorted entry names, directories only
+}
+
+func (e *archiveEntry) Name() string       { return e.name }
+func (e *archiveEntry) Size() int64        { return e.size }
+func (e *archiveEntry) Mode() fs.FileMode  { return e.mode }
+func (e *archiveEntry) ModTime() time.Time { return e.modTime }
+func (e *archiveEntry) IsDir() bool        { return e.mode.IsDir() }
+func (e *archiveEntry) Sys() interface{}   { return nil }
+
+// ArchiveFS implements FileSystem over a tar, tar.gz or zip archive. Entries are indexed
+// in memory when the archive is opened; file contents are read from the archive on demand.
+type ArchiveFS struct {
+	basePath string
+	format   string
+	source   string                   // repository the archive was read from; "" for a local file
+	data     *os.File                 // the archive file, or its spooled copy
+	entries  map[string]*archiveEntry // keyed by slash-separated path, "." is the root
+	size     int64                    // size and modification time of the archive file,
+	modTime  time.Time                // to notice when it is replaced
+
+	mu      sync.Mutex
+	readers int  // reads of data in progress
+	retired bool // replaced or no longer configured; data is closed once readers drops to 0
+}
+
+// errArchiveReplaced is returned by reads of an archive that was replaced meanwhile
+var errArchiveReplaced = errors.New("archive was replaced or removed; try again")
+
+// acquire marks a read of the archive file in progress, failing if the archive is retired
+func (a *ArchiveFS) acquire(p string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.retired {
+		return &fs.PathError{Op: "read", Path: p, Err: errArchiveReplaced}
+	}
+	a.readers++
+	return nil
+}
+
+// release ends a read started by acquire
+func (a *ArchiveFS) release() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.readers--
+	if a.retired && a.readers == 0 {
+		a.data.Close()
+	}
+}
+
+// retire closes the archive file once the reads in progress finish
+func (a *ArchiveFS) retire() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.retired {
+		return
+	}
+	a.retired = true
+	if a.readers == 0 {
+		a.data.Close()
+	}
+}
+
+// archiveKey cleans a path relative to the archive root into an entry key
+func archiveKey(p string) string {
+	return path.Clean(filepath.ToSlash(p))
+}
+
+// lookup returns the entry at a path without following symlinks
+func (a *ArchiveFS) lookup(op, p string) (string, *archiveEntry, error) {
+	key := archiveKey(p)
+	entry, ok := a.entries[key]
+	if !ok {
+		return "", nil, &fs.PathError{Op: op, Path: p, Err: fs.ErrNotExist}
+	}
+	return key, entry, nil
+}
+
+// resolve returns the entry at a path, following symlinks within the archive
+func (a *ArchiveFS) resolve(op, p string) (*archiveEntry, error) {
+	key, entry, err := a.lookup(op, p)
+	if err != nil {
+		return nil, err
+	}
+	for hops := 0; entry.mode&fs.ModeSymlink != 0; hops++ {
+		if hops == 40 || path.IsAbs(entry.link) {
+			return nil, &fs.PathError{Op: op, Path: p, Err: fs.ErrNotExist}
+		}
+		key = path.Join(path.Dir(key), entry.link)
+		var ok bool
+		if entry, ok = a.entries[key]; !ok {
+			return nil, &fs.PathError{Op: op, Path: p, Err: fs.ErrNotExist}
+		}
+	}
+	return entry, nil
+}
+
+func (a *ArchiveFS) ReadFile(ctx context.Context, p string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	entry, err := a.resolve("open", p)
+	if err != nil {
+		return nil, err
+	}
+	if entry.IsDir() {
+		return nil, &fs.PathError{Op: "read", Path: p, Err: errors.New("is a directory")}
+	}
+	if err := a.acquire(p); err != nil {
+		return nil, err
+	}
+	defer a.release()
+
+	if entry.zip != nil {
+		r, err := entry.zip.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return io.ReadAll(io.LimitReader(&contextReader{ctx: ctx, r: r}, entry.size))
+	}
+
+	data := make([]byte, entry.size)
+	if _, err := a.data.ReadAt(data, entry.offset); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (a *ArchiveFS) ReadDir(ctx context.Context, p string) ([]fs.DirEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	entry, err := a.resolve("readdir", p)
+	if err != nil {
+		return nil, err
+	}
+	if !entry.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: p, Err: errors.New("not a directory")}
+	}
+
+	dir := archiveKey(p)
+	entries := make([]fs.DirEntry, 0, len(entry.children))
+	for _, name := range entry.children {
+		entries = append(entries, fs.FileInfoToDirEntry(a.entries[path.Join(dir, name)]))
+	}
+	return entries, nil
+}
+
+func (a *ArchiveFS) Stat(ctx context.Context, p string) (fs.FileInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return a.resolve("stat", p)
+}
+
+func (a *ArchiveFS) Readlink(ctx context.Context, p string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	_, entry, err := a.lookup("readlink", p)
+	if err != nil {
+		return "", err
+	}
+	if entry.mode&fs.ModeSymlink == 0 {
+		return "", &fs.PathError{Op: "readlink", Path: p, Err: errors.New("not a symbolic link")}
+	}
+	return entry.link, nil
+}
+
+// Walk walks the entries below root like filepath.Walk, without following symlinks
+func (a *ArchiveFS) Walk(ctx context.Context, root string, fn filepath.WalkFunc) error {
+	fullPath := filepath.Join(a.basePath, root)
+	key, entry, err := a.lookup("lstat", root)
+	if err != nil {
+		err = fn(fullPath, nil, err)
+	} else {
+		err = a.walk(ctx, key, fullPath, entry, fn)
+	}
+	if err == filepath.SkipDir || err == filepath.SkipAll {
+		return nil
+	}
+	return err
+}
+
+func (a *ArchiveFS) walk(ctx context.Context, key, fullPath string, entry *archiveEntry, fn filepath.WalkFunc) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if !entry.IsDir() {
+		return fn(fullPath, entry, nil)
+	}
+	if err := fn(fullPath, entry, nil); err != nil {
+		return err
+	}
+	for _, name := range entry.children {
+		childKey := path.Join(key, name)
+		child := a.entries[childKey]
+		if err := a.walk(ctx, childKey, filepath.Join(fullPath, name), child, fn); err != nil {
+			if !child.IsDir() || err != filepath.SkipDir {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (a *ArchiveFS) BasePath() string {
+	return a.basePath
+}
+
+func (a *ArchiveFS) Type() string {
+	return "archive"
+}
+
+func (a *ArchiveFS) Info() map[string]string {
+	info := map[string]string{
+		"type":    "archive",
+		"path":    a.basePath,
+		"format":  a.format,
+		"entries": fmt.Sprintf("%d", len(a.entries)-1),
+	}
+	if a.source != "" {
+		info["source"] = a.source
+	}
+	return info
+}
+
+// archiveIndex builds the entry index of an archive
+type archiveIndex struct {
+	entries  map[string]*archiveEntry
+	children map[string]map[string]bool
+	modTime  time.Time
+}
+
+func newArchiveIndex(modTime time.Time) *archiveIndex {
+	idx := &archiveIndex{
+		entries:  make(map[string]*archiveEntry),
+		children: make(map[string]map[string]bool),
+		modTime:  modTime,
+	}
+	idx.entries["."] = &archiveEntry{name: ".", mode: fs.ModeDir | 0555, modTime: modTime}
+	return idx
+}
+
+// add records an entry under its archive name. Names that would escape the archive root
+// are ignored; later entries replace earlier ones with the same name, as when extracting.
+func (idx *archiveIndex) add(name string, entry *archiveEntry) error {
+	key := path.Clean(strings.TrimLeft(strings.ReplaceAll(name, "\\", "/"), "/"))
+	if key == "." || key == ".." || strings.HasPrefix(key, "../") {
+		return nil
+	}
+	if len(idx.entries) > maxArchiveEntries {
+		return fmt.Errorf("archive has more than %d entries", maxArchiveEntries)
+	}
+
+	entry.name = path.Base(key)
+	idx.entries[key] = entry
+
+	// Archives often omit directory entries, so create missing parents
+	for child := key; child != "."; {
+		parent := path.Dir(child)
+		if _, ok := idx.entries[parent]; !ok {
+			idx.entries[parent] = &archiveEntry{name: path.Base(parent), mode: fs.ModeDir | 0755, modTime: idx.modTime}
+		}
+		if idx.children[parent] == nil {
+			idx.children[parent] = make(map[string]bool)
+		}
+		idx.children[parent][path.Base(child)] = true
+		child = parent
+	}
+	return nil
+}
+
+// finish resolves tar hard links and sorts directory listings
+func (idx *archiveIndex) finish() map[string]*archiveEntry {
+	for key, entry := range idx.entries {
+		if entry.mode.IsRegular() && entry.link != "" {
+			target, ok := idx.entries[path.Clean(strings.TrimLeft(entry.link, "/"))]
+			if !ok || !target.mode.IsRegular() || target.link != "" {
+				delete(idx.entries, key)
+				delete(idx.children[path.Dir(key)], entry.name)
+				continue
+			}
+			entry.offset, entry.size, entry.link = target.offset, target.size, ""
+		}
+	}
+	for dir, names := range idx.children {
+		entry, ok := idx.entries[dir]
+		if !ok || !entry.IsDir() {
+			continue
+		}
+		entry.children = make([]string, 0, len(names))
+		for name := range names {
+			if _, ok := idx.entries[path.Join(dir, name)]; ok {
+				entry.children = append(entry.children, name)
+			}
+		}
+		sort.Strings(entry.children)
+	}
+	return idx.entries
+}
+
+// countingReader counts the bytes read through it, to find where tar entries start
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// contextReader stops reading once its context is cancelled
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c *contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
+
+// indexTar indexes an uncompressed tar archive
+func indexTar(data io.ReaderAt, size int64, idx *archiveIndex) error {
+	counter := &countingReader{r: io.NewSectionReader(data, 0, size)}
+	tr := tar.NewReader(counter)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read tar archive: %w", err)
+		}
+
+		entry := &archiveEntry{mode: hdr.FileInfo().Mode(), modTime: hdr.ModTime}
+		switch hdr.Typeflag {
+		case tar.TypeReg, tar.TypeRegA:
+			entry.size = hdr.Size
+			entry.offset = counter.n
+		case tar.TypeLink, tar.TypeSymlink:
+			entry.link = hdr.Linkname
+		case tar.TypeDir:
+		default:
+			// Devices, FIFOs and sparse files aren't useful to browse
+			continue
+		}
+		if err := idx.add(hdr.Name, entry); err != nil {
+			return err
+		}
+	}
+}
+
+// indexZip indexes a zip archive
+func indexZip(data io.ReaderAt, size int64, idx *archiveIndex) error {
+	zr, err := zip.NewReader(data, size)
+	if err != nil {
+		return fmt.Errorf("failed to read zip archive: %w", err)
+	}
+	for _, f := range zr.File {
+		entry := &archiveEntry{mode: f.Mode(), modTime: f.Modified, size: int64(f.UncompressedSize64), zip: f}
+		if entry.IsDir() {
+			entry.size, entry.zip = 0, nil
+		}
+		if entry.mode&fs.ModeSymlink != 0 {
+			// Zip stores a symlink's target as its content
+			r, err := f.Open()
+			if err != nil {
+				continue
+			}
+			target, err := io.ReadAll(io.LimitReader(r, 4096))
+			r.Close()
+			if err != nil {
+				continue
+			}
+			entry.link, entry.size, entry.zip = string(target), int64(len(target)), nil
+		}
+		if err := idx.add(f.Name, entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// spool copies r to an unlinked temporary file, so archives that can't be read in place
+// (compressed, or on another machine) can be read at random offsets
+func spool(r io.Reader) (*os.File, error) {
+	f, err := os.CreateTemp("", "fs-mcp-archive-*")
+	if err != nil {
+		return nil, err
+	}
+	// The file stays readable through f; removing it now means nothing is left behind
+	os.Remove(f.Name())
+
+	n, err := io.Copy(f, io.LimitReader(r, maxArchiveSpool+1))
+	if err == nil && n > maxArchiveSpool {
+		err = fmt.Errorf("archive is larger than %d bytes", int64(maxArchiveSpool))
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// archiveSource is where an archive repository's file lives
+type archiveSource struct {
+	fs       FileSystem // repository holding the archive; nil for a local file
+	path     string     // path of the archive, relative to fs's root if fs is set
+	basePath string
+	info     fs.FileInfo
+}
+
+// locateArchive finds and stats the archive file of a repository
+func locateArchive(ctx context.Context, archivePath string, cfg *ArchiveConfig, pool *Pool) (*archiveSource, error) {
+	if cfg.Source == "" {
+		abs, err := filepath.Abs(archivePath)
+		if err != nil {
+			return nil, err
+		}
+		info, err := os.Stat(abs)
+		if err != nil {
+			return nil, fmt.Errorf("archive not found: %w", err)
+		}
+		return &archiveSource{path: abs, basePath: abs, info: info}, nil
+	}
+
+	src, err := pool.OpenNamed(ctx, cfg.Source)
+	if err != nil {
+		return nil, fmt.Errorf("archive source: %w", err)
+	}
+	if src.Type() == "archive" {
+		return nil, fmt.Errorf("archive source %s is itself an archive", cfg.Source)
+	}
+	relPath, err := policy.ValidatePath(src.BasePath(), archivePath)
+	if err != nil {
+		return nil, err
+	}
+	info, err := src.Stat(ctx, relPath)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("archive not found in %s: %s", cfg.Source, archivePath)
+	}
+	return &archiveSource{fs: src, path: relPath, basePath: filepath.Join(src.BasePath(), relPath), info: info}, nil
+}
+
+// open returns a reader for the archive file. Local files are returned as *os.File.
+func (s *archiveSource) open(ctx context.Context) (io.ReadCloser, error) {
+	// Archives are streamed from the backend itself, not read whole through the cache
+	switch src := unwrap(s.fs).(type) {
+	case nil:
+		return os.Open(s.path)
+	case *LocalFS:
+		return os.Open(filepath.Join(src.BasePath(), s.path))
+	case *RemoteFS:
+		return src.Open(ctx, s.path)
+	}
+	data, err := s.fs.ReadFile(ctx, s.path)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// loadArchive opens and indexes an archive repository. Cancelling ctx stops spooling a
+// compressed or remote archive.
+func loadArchive(ctx context.Context, cfg *ArchiveConfig, src *archiveSource) (*ArchiveFS, error) {
+	rc, err := src.open(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open archive: %w", err)
+	}
+
+	var r io.Reader = rc
+	if cfg.Format == "tar.gz" {
+		gz, err := gzip.NewReader(rc)
+		if err != nil {
+			rc.Close()
+			return nil, fmt.Errorf("failed to read tar.gz archive: %w", err)
+		}
+		r = gz
+	}
+
+	// Uncompressed local archives are read in place; everything else is spooled
+	f, ok := r.(*os.File)
+	if !ok {
+		f, err = spool(&contextReader{ctx: ctx, r: r})
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read archive: %w", err)
+		}
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	idx := newArchiveIndex(src.info.ModTime())
+	if cfg.Format == "zip" {
+		err = indexZip(f, info.Size(), idx)
+	} else {
+		err = indexTar(f, info.Size(), idx)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &ArchiveFS{
+		basePath: src.basePath,
+		format:   cfg.Format,
+		source:   cfg.Source,
+		data:     f,
+		entries:  idx.finish(),
+		size:     src.info.Size(),
+		modTime:  src.info.ModTime(),
+	}, nil
+}
+
+// archiveCache keeps opened archives so they're only indexed once, and re-opens them
+// when the archive file changes
+type archiveCache struct {
+	mu    sync.Mutex
+	slots map[string]*archiveSlot
+}
+
+type archiveSlot struct {
+	mu      sync.Mutex
+	fs      *ArchiveFS
+	removed bool // the repository is no longer configured
+}
+
+// remove retires the slot's archive. It waits for a load in progress, so it is run in the
+// background rather than hold up a reload.
+func (s *archiveSlot) remove() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.removed = true
+	if s.fs != nil {
+		s.fs.retire()
+		s.fs = nil
+	}
+}
+
+// archiveCacheKey identifies an archive repository's configuration
+func archiveCacheKey(repo *Repository) string {
+	cfg := repo.Config.(*ArchiveConfig)
+	return fmt.Sprintf("%s\x00%s\x00%s", cfg.Source, repo.Path, cfg.Format)
+}
+
+// get returns the ArchiveFS for a repository, indexing the archive on first use
+func (c *archiveCache) get(ctx context.Context, repo *Repository, pool *Pool) (*ArchiveFS, error) {
+	cfg := repo.Config.(*ArchiveConfig)
+	src, err := locateArchive(ctx, repo.Path, cfg, pool)
+	if err != nil {
+		return nil, err
+	}
+
+	key := archiveCacheKey(repo)
+	c.mu.Lock()
+	slot, ok := c.slots[key]
+	if !ok {
+		slot = &archiveSlot{}
+		c.slots[key] = slot
+	}
+	c.mu.Unlock()
+
+	slot.mu.Lock()
+	defer slot.mu.Unlock()
+	if slot.removed {
+		return nil, fmt.Errorf("repository %s was reconfigured; try again", repo.Name)
+	}
+	if slot.fs != nil && slot.fs.size == src.info.Size() && slot.fs.modTime.Equal(src.info.ModTime()) {
+		return slot.fs, nil
+	}
+	a, err := loadArchive(ctx, cfg, src)
+	if err != nil {
+		return nil, err
+	}
+	// The replaced archive's file is closed once no call is reading it
+	if slot.fs != nil {
+		slot.fs.retire()
+	}
+	slot.fs = a
+	return a, nil
+}
+
+// loaded reports whether a repository's archive is indexed, and not being loaded again
+func (c *archiveCache) loaded(repo *Repository) bool {
+	c.mu.Lock()
+	slot, ok := c.slots[archiveCacheKey(repo)]
+	c.mu.Unlock()
+	if !ok || !slot.mu.TryLock() {
+		return false
+	}
+	defer slot.mu.Unlock()
+	return slot.fs != nil
+}
+
+// sync forgets archives that are no longer configured and closes their files
+func (c *archiveCache) sync(repositories map[string]*Repository) {
+	keep := make(map[string]bool)
+	for _, repo := range repositories {
+		if repo.Type == "archive" {
+			keep[archiveCacheKey(repo)] = true
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, slot := range c.slots {
+		if !keep[key] {
+			delete(c.slots, key)
+			go slot.remove()
+		}
+	}
+}
@@ -0,0 +1,191 @@
+// Package backends provides the FileSystem abstraction over repositories and the
+// repository types that implement it: local directories, SSH hosts, archives, exec
+// targets, S3 buckets, WebDAV shares, HTTP directory listings and out-of-process backends.
+package backends
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Backend is a repository type. Each backend decodes and validates the type-specific part
+// of a repository's config and opens a FileSystem for it.
+type Backend struct {
+	// Decode parses the type-specific settings from a repository's raw config. The common
+	// fields (type, path, ...) are already set on repo and may be defaulted or checked here.
+	Decode func(repo *Repository, raw json.RawMessage) (interface{}, error)
+
+	// Open returns a FileSystem for a repository decoded by this backend. Connections and
+	// caches shared between repositories belong to pool. ctx bounds connecting, not the
+	// FileSystem's later use.
+	Open func(ctx context.Context, repo *Repository, pool *Pool) (FileSystem, error)
+
+	// Location describes where a repository lives, for listings that can't afford to open
+	// it (optional, default: the repository's path)
+	Location func(repo *Repository) string
+
+	// Ready reports whether Open would return without connecting to a host, starting a
+	// process or fetching an archive, because what it needs is already open (optional,
+	// default: Open never does any of these)
+	Ready func(repo *Repository, pool *Pool) bool
+
+	// Cached backends pay a round trip for every operation, so their repositories are
+	// served through the read-through cache unless their "cache" setting disables it
+	Cached bool
+
+	// ListsTree backends list a whole tree in a single request or command, so cached
+	// repositories walk through the backend instead of listing each directory
+	ListsTree bool
+}
+
+var (
+	backendsMu sync.RWMutex
+	backends   = make(map[string]*Backend)
+)
+
+// RegisterBackend makes a repository type available to the config. Built-in backends
+// register themselves from init.
+func RegisterBackend(name string, b *Backend) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	backends[name] = b
+}
+
+// LookupBackend returns the backend registered for a repository type
+func LookupBackend(name string) (*Backend, bool) {
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+	b, ok := backends[name]
+	return b, ok
+}
+
+// BackendNames returns the registered repository types, sorted
+func BackendNames() []string {
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+	names := make([]string, 0, len(backends))
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// decodeConfig unmarshals a repository's raw config into a backend's settings struct
+func decodeConfig(repo *Repository, raw json.RawMessage, config interface{}) error {
+	if err := json.Unmarshal(raw, config); err != nil {
+		return fmt.Errorf("failed to parse repository %s: %w", repo.Name, err)
+	}
+	return nil
+}
+
+// Pool opens repositories and owns what their FileSystems share: SSH connections, indexed
+// archives, running out-of-process backends, mirrors and the read-through cache
+type Pool struct {
+	ssh      *SSHPool
+	archives *archiveCache
+	plugins  *pluginPool
+	mirrors  *mirrorPool
+	cache    *readCache
+	lookup   func(name string) (*Repository, bool)
+}
+
+// NewPool creates a Pool. lookup finds other configured repositories by name, for
+// archives read from another repository.
+func NewPool(lookup func(name string) (*Repository, bool)) *Pool {
+	return &Pool{
+		ssh:      NewSSHPool(),
+		archives: &archiveCache{slots: make(map[string]*archiveSlot)},
+		plugins:  &pluginPool{slots: make(map[string]*pluginSlot)},
+		mirrors:  &mirrorPool{mirrors: make(map[string]*mirror)},
+		cache:    newReadCache(),
+		lookup:   lookup,
+	}
+}
+
+// Open returns a FileSystem for a repository, served through the read-through cache if
+// the repository is cached. If the repository has a timeout, it bounds opening and each
+// operation on the FileSystem.
+func (p *Pool) Open(ctx context.Context, repo *Repository) (FileSystem, error) {
+	if repo.Timeout <= 0 {
+		fs, err := repo.backend.Open(ctx, repo, p)
+		if err != nil {
+			return nil, err
+		}
+		return p.cache.wrap(repo, fs), nil
+	}
+	timeout := time.Duration(repo.Timeout) * time.Second
+	openCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	fs, err := repo.backend.Open(openCtx, repo, p)
+	if err != nil {
+		return nil, timeoutError(openCtx, err, timeout)
+	}
+	return &timeoutFS{fs: p.cache.wrap(repo, fs), timeout: timeout}, nil
+}
+
+// Ready reports whether opening a repository is cheap: it needs no new connection, backend
+// process or archive download
+func (p *Pool) Ready(repo *Repository) bool {
+	if repo.backend.Ready == nil {
+		return true
+	}
+	return repo.backend.Ready(repo, p)
+}
+
+// unwrap returns the FileSystem a backend opened, without the layers Pool.Open adds
+func unwrap(fs FileSystem) FileSystem {
+	for {
+		switch layer := fs.(type) {
+		case *timeoutFS:
+			fs = layer.fs
+		case *cachingFS:
+			fs = layer.fs
+		default:
+			return fs
+		}
+	}
+}
+
+// ConfigureCache sizes the read-through cache shared by all repositories. Cached file
+// contents are dropped if the sizes change.
+func (p *Pool) ConfigureCache(opts CacheOptions) {
+	p.cache.configure(opts)
+}
+
+// CacheStats returns the cache statistics of a repository, if it is cached and has been
+// opened
+func (p *Pool) CacheStats(name string) (CacheStats, bool) {
+	return p.cache.stats(name)
+}
+
+// OpenNamed returns a FileSystem for a configured repository
+func (p *Pool) OpenNamed(ctx context.Context, name string) (FileSystem, error) {
+	repo, ok := p.lookup(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown repository: %s", name)
+	}
+	return p.Open(ctx, repo)
+}
+
+// Sync forgets archives and stops backends and mirrors of repositories that are no longer
+// configured or have changed, and starts mirrors of new ones (called whenever the config
+// is loaded)
+func (p *Pool) Sync(repositories map[string]*Repository) {
+	p.archives.sync(repositories)
+	p.plugins.sync(repositories)
+	p.mirrors.sync(repositories, p.ssh)
+	p.cache.sync(repositories)
+}
+
+// Close closes archives, stops all backends and mirrors and closes all connections
+func (p *Pool) Close() {
+	p.archives.sync(nil)
+	p.plugins.sync(nil)
+	p.mirrors.sync(nil, p.ssh)
+	p.ssh.Close()
+}
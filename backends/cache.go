@@ -0,0 +1,654 @@
+package backends
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// defaultCacheMemoryMB bounds cached file contents held in memory
+	defaultCacheMemoryMB = 64
+	// defaultCacheDiskMB bounds cached file contents kept on disk, when enabled
+	defaultCacheDiskMB = 1024
+	// defaultDirTTL is how long a cached directory listing is reused
+	defaultDirTTL = 10 * time.Second
+	// defaultStatTTL is how long cached file metadata is trusted before cached content is
+	// revalidated against the repository
+	defaultStatTTL = 2 * time.Second
+	// maxCachedPaths bounds the listings and metadata cached for one repository
+	maxCachedPaths = 20000
+)
+
+// CacheConfig is a repository's "cache" setting. Repositories of backends marked Cached
+// are cached unless disabled; others only if enabled.
+type CacheConfig struct {
+	Enabled *bool `json:"enabled"`
+	DirTTL  *int  `json:"dir_ttl"`  // Seconds a directory listing is reused (default 10)
+	StatTTL *int  `json:"stat_ttl"` // Seconds file metadata is reused before cached content is revalidated (default 2)
+}
+
+// CacheOptions sizes the file content cache shared by all repositories (the top-level
+// "cache" setting)
+type CacheOptions struct {
+	MemoryMB int    `json:"memory_mb"` // Memory for cached file contents (default 64)
+	Disk     bool   `json:"disk"`      // Also keep file contents on disk, surviving restarts
+	Dir      string `json:"dir"`       // Directory for the disk cache (default ~/.cache/fs-mcp)
+	DiskMB   int    `json:"disk_mb"`   // Disk space for cached file contents (default 1024)
+}
+
+// CacheStats counts how a repository's cache has been used
+type CacheStats struct {
+	FileHits   int64 `json:"file_hits"`
+	DiskHits   int64 `json:"disk_hits"` // file hits served from the disk cache
+	FileMisses int64 `json:"file_misses"`
+	DirHits    int64 `json:"dir_hits"`
+	DirMisses  int64 `json:"dir_misses"`
+	StatHits   int64 `json:"stat_hits"`
+	StatMisses int64 `json:"stat_misses"`
+}
+
+// validate checks a repository's cache setting
+func (c *CacheConfig) validate(repoName string) error {
+	if c == nil {
+		return nil
+	}
+	if c.DirTTL != nil && *c.DirTTL < 0 || c.StatTTL != nil && *c.StatTTL < 0 {
+		return fmt.Errorf("repository %s: cache TTLs must not be negative", repoName)
+	}
+	return nil
+}
+
+// ttl reads an optional TTL in seconds
+func ttl(seconds *int, def time.Duration) time.Duration {
+	if seconds == nil {
+		return def
+	}
+	return time.Duration(*seconds) * time.Second
+}
+
+// readCache is the Pool's read-through cache: file contents shared by all repositories,
+// and each cached repository's listings, metadata and statistics
+type readCache struct {
+	mu       sync.Mutex
+	opts     CacheOptions
+	contents *contentStore
+	repos    map[string]*repoCache // by repository name
+}
+
+func newReadCache() *readCache {
+	return &readCache{
+		contents: newContentStore(CacheOptions{}),
+		repos:    make(map[string]*repoCache),
+	}
+}
+
+// configure applies new cache sizes, dropping the cached contents if they changed
+func (c *readCache) configure(opts CacheOptions) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if opts == c.opts {
+		return
+	}
+	c.opts = opts
+	c.contents = newContentStore(opts)
+}
+
+// wrap returns fs served through the repository's cache, or fs itself if the repository
+// isn't cached. A mirror is already local, so it is served as is.
+func (c *readCache) wrap(repo *Repository, fs FileSystem) FileSystem {
+	enabled := repo.backend.Cached
+	if repo.Cache != nil && repo.Cache.Enabled != nil {
+		enabled = *repo.Cache.Enabled
+	}
+	if _, mirrored := fs.(*MirrorFS); !enabled || mirrored {
+		return fs
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := repo.Name + "\x00" + repo.Key()
+	rc, ok := c.repos[repo.Name]
+	if !ok || rc.key != key {
+		rc = &repoCache{
+			key:   key,
+			dirs:  make(map[string]cachedDir),
+			infos: make(map[string]cachedInfo),
+		}
+		c.repos[repo.Name] = rc
+	}
+	var settings CacheConfig
+	if repo.Cache != nil {
+		settings = *repo.Cache
+	}
+	rc.mu.Lock()
+	rc.dirTTL = ttl(settings.DirTTL, defaultDirTTL)
+	rc.statTTL = ttl(settings.StatTTL, defaultStatTTL)
+	rc.mu.Unlock()
+	return &cachingFS{fs: fs, cache: rc, contents: c.contents, listsTree: repo.backend.ListsTree}
+}
+
+// sync forgets the caches of repositories that are no longer configured or have changed
+func (c *readCache) sync(repositories map[string]*Repository) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for name, rc := range c.repos {
+		repo, ok := repositories[name]
+		if !ok || rc.key != repo.Name+"\x00"+repo.Key() {
+			delete(c.repos, name)
+		}
+	}
+}
+
+// stats returns a repository's cache statistics
+func (c *readCache) stats(name string) (CacheStats, bool) {
+	c.mu.Lock()
+	rc, ok := c.repos[name]
+	c.mu.Unlock()
+	if !ok {
+		return CacheStats{}, false
+	}
+	return CacheStats{
+		FileHits:   rc.fileHits.Load(),
+		DiskHits:   rc.diskHits.Load(),
+		FileMisses: rc.fileMisses.Load(),
+		DirHits:    rc.dirHits.Load(),
+		DirMisses:  rc.dirMisses.Load(),
+		StatHits:   rc.statHits.Load(),
+		StatMisses: rc.statMisses.Load(),
+	}, true
+}
+
+// cachedDir is a directory listing and when it was read
+type cachedDir struct {
+	entries []fs.DirEntry
+	at      time.Time
+}
+
+// cachedInfo is a path's metadata and when it was read
+type cachedInfo struct {
+	info fs.FileInfo
+	at   time.Time
+}
+
+// repoCache holds one repository's cached listings and metadata. File contents live in
+// the shared contentStore, keyed by the repository, path, size and modification time.
+type repoCache struct {
+	key string // repository name and settings; a change drops the cache
+
+	mu      sync.Mutex
+	dirTTL  time.Duration
+	statTTL time.Duration
+	dirs    map[string]cachedDir
+	infos   map[string]cachedInfo
+
+	fileHits, diskHits, fileMisses atomic.Int64
+	dirHits, dirMisses             atomic.Int64
+	statHits, statMisses           atomic.Int64
+}
+
+// dir returns a cached listing younger than maxAge
+func (rc *repoCache) dir(p string, maxAge time.Duration) ([]fs.DirEntry, bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	d, ok := rc.dirs[p]
+	if !ok || time.Since(d.at) >= maxAge {
+		return nil, false
+	}
+	return d.entries, true
+}
+
+// info returns cached metadata younger than the stat TTL, looking in the parent's listing
+// if the path itself wasn't stat'ed. Symlinks in listings describe the link, not its target.
+func (rc *repoCache) info(p string) (fs.FileInfo, bool) {
+	rc.mu.Lock()
+	maxAge := rc.statTTL
+	if i, ok := rc.infos[p]; ok && time.Since(i.at) < maxAge {
+		rc.mu.Unlock()
+		return i.info, true
+	}
+	rc.mu.Unlock()
+
+	if p == "." {
+		return nil, false
+	}
+	entries, ok := rc.dir(path.Dir(p), maxAge)
+	if !ok {
+		return nil, false
+	}
+	name := path.Base(p)
+	i := sort.Search(len(entries), func(i int) bool { return entries[i].Name() >= name })
+	if i == len(entries) || entries[i].Name() != name || entries[i].Type()&fs.ModeSymlink != 0 {
+		return nil, false
+	}
+	info, err := entries[i].Info()
+	return info, err == nil
+}
+
+// putDir caches a listing, sorted by name
+func (rc *repoCache) putDir(p string, entries []fs.DirEntry) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if len(rc.dirs) >= maxCachedPaths {
+		rc.dirs = pruneExpired(rc.dirs, func(d cachedDir) bool { return time.Since(d.at) >= rc.dirTTL })
+	}
+	rc.dirs[p] = cachedDir{entries: entries, at: time.Now()}
+}
+
+// putInfo caches a path's metadata
+func (rc *repoCache) putInfo(p string, info fs.FileInfo) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if len(rc.infos) >= maxCachedPaths {
+		rc.infos = pruneExpired(rc.infos, func(i cachedInfo) bool { return time.Since(i.at) >= rc.statTTL })
+	}
+	rc.infos[p] = cachedInfo{info: info, at: time.Now()}
+}
+
+// pruneExpired drops expired entries from a full map, or starts over if none had expired
+func pruneExpired[T any](m map[string]T, expired func(T) bool) map[string]T {
+	for k, v := range m {
+		if expired(v) {
+			delete(m, k)
+		}
+	}
+	if len(m) >= maxCachedPaths {
+		return make(map[string]T)
+	}
+	return m
+}
+
+// contentKey identifies a version of a file's content
+func (rc *repoCache) contentKey(p string, info fs.FileInfo) string {
+	return fmt.Sprintf("%s\x00%s\x00%d\x00%d", rc.key, p, info.Size(), info.ModTime().UnixNano())
+}
+
+// cachingFS serves a repository through its repoCache: listings and metadata for a short
+// TTL, file contents for as long as their size and modification time don't change
+type cachingFS struct {
+	fs        FileSystem
+	cache     *repoCache
+	contents  *contentStore
+	listsTree bool // the backend's Walk is one listing, cheaper than a ReadDir per directory
+}
+
+// cacheKey normalizes a path relative to the repository root
+func cacheKey(p string) string {
+	return path.Clean(filepath.ToSlash(p))
+}
+
+func (c *cachingFS) ReadFile(ctx context.Context, p string) ([]byte, error) {
+	info, err := c.Stat(ctx, p)
+	if err != nil || !info.Mode().IsRegular() {
+		return c.fs.ReadFile(ctx, p)
+	}
+
+	key := c.cache.contentKey(cacheKey(p), info)
+	if data, fromDisk, ok := c.contents.get(key); ok {
+		c.cache.fileHits.Add(1)
+		if fromDisk {
+			c.cache.diskHits.Add(1)
+		}
+		return data, nil
+	}
+	c.cache.fileMisses.Add(1)
+	data, err := c.fs.ReadFile(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	// A file that changed since it was stat'ed is returned but not cached under the old key
+	if int64(len(data)) == info.Size() {
+		c.contents.put(key, data)
+	}
+	return data, nil
+}
+
+func (c *cachingFS) ReadDir(ctx context.Context, p string) ([]fs.DirEntry, error) {
+	key := cacheKey(p)
+	c.cache.mu.Lock()
+	maxAge := c.cache.dirTTL
+	c.cache.mu.Unlock()
+	if entries, ok := c.cache.dir(key, maxAge); ok {
+		c.cache.dirHits.Add(1)
+		return append([]fs.DirEntry(nil), entries...), nil
+	}
+	c.cache.dirMisses.Add(1)
+	entries, err := c.fs.ReadDir(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	c.cache.putDir(key, append([]fs.DirEntry(nil), entries...))
+	return entries, nil
+}
+
+func (c *cachingFS) Stat(ctx context.Context, p string) (fs.FileInfo, error) {
+	key := cacheKey(p)
+	if info, ok := c.cache.info(key); ok {
+		c.cache.statHits.Add(1)
+		return info, nil
+	}
+	c.cache.statMisses.Add(1)
+	info, err := c.fs.Stat(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	c.cache.putInfo(key, info)
+	return info, nil
+}
+
+func (c *cachingFS) Readlink(ctx context.Context, p string) (string, error) {
+	return c.fs.Readlink(ctx, p)
+}
+
+// Walk lists directories through the cache, so that repeated walks within the directory
+// TTL don't touch the repository. Backends that list a whole tree at once walk it
+// themselves, uncached.
+func (c *cachingFS) Walk(ctx context.Context, root string, fn filepath.WalkFunc) error {
+	if c.listsTree {
+		return c.fs.Walk(ctx, root, fn)
+	}
+	fullPath := path.Join(c.fs.BasePath(), filepath.ToSlash(root))
+	info, err := c.Stat(ctx, root)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		return fn(fullPath, nil, err)
+	}
+	err = walkReadDir(ctx, fullPath, cacheKey(root), info, c.ReadDir, fn)
+	if err == filepath.SkipDir || err == filepath.SkipAll {
+		return nil
+	}
+	return err
+}
+
+func (c *cachingFS) BasePath() string {
+	return c.fs.BasePath()
+}
+
+func (c *cachingFS) Type() string {
+	return c.fs.Type()
+}
+
+func (c *cachingFS) Info() map[string]string {
+	return c.fs.Info()
+}
+
+// cachedContent is one file's content in the memory LRU
+type cachedContent struct {
+	key  string
+	data []byte
+}
+
+// contentStore is a size-bounded LRU of file contents in memory, optionally backed by a
+// larger one on disk
+type contentStore struct {
+	mu    sync.Mutex
+	limit int64
+	used  int64
+	order *list.List // of *cachedContent, most recently used first
+	items map[string]*list.Element
+	disk  *diskStore
+}
+
+func newContentStore(opts CacheOptions) *contentStore {
+	memoryMB := opts.MemoryMB
+	if memoryMB <= 0 {
+		memoryMB = defaultCacheMemoryMB
+	}
+	s := &contentStore{
+		limit: int64(memoryMB) << 20,
+		order: list.New(),
+		items: make(map[string]*list.Element),
+	}
+	if opts.Disk {
+		disk, err := openDiskStore(opts)
+		if err != nil {
+			log.Printf("Disk cache disabled: %v", err)
+		} else {
+			s.disk = disk
+		}
+	}
+	return s
+}
+
+// get returns cached content and whether it came from disk
+func (s *contentStore) get(key string) ([]byte, bool, bool) {
+	s.mu.Lock()
+	if el, ok := s.items[key]; ok {
+		s.order.MoveToFront(el)
+		data := el.Value.(*cachedContent).data
+		s.mu.Unlock()
+		return data, false, true
+	}
+	s.mu.Unlock()
+
+	if s.disk == nil {
+		return nil, false, false
+	}
+	data, ok := s.disk.get(key)
+	if !ok {
+		return nil, false, false
+	}
+	s.putMemory(key, data)
+	return data, true, true
+}
+
+// put caches content in memory and, if enabled, on disk
+func (s *contentStore) put(key string, data []byte) {
+	s.putMemory(key, data)
+	if s.disk != nil {
+		s.disk.put(key, data)
+	}
+}
+
+// putMemory adds content to the memory LRU, evicting the least recently used. Files
+// larger than a quarter of the memory are left to the disk cache.
+func (s *contentStore) putMemory(key string, data []byte) {
+	size := int64(len(data))
+	if size > s.limit/4 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if el, ok := s.items[key]; ok {
+		s.order.MoveToFront(el)
+		return
+	}
+	s.items[key] = s.order.PushFront(&cachedContent{key: key, data: data})
+	s.used += size
+	for s.used > s.limit {
+		oldest := s.order.Back()
+		item := oldest.Value.(*cachedContent)
+		s.order.Remove(oldest)
+		delete(s.items, item.key)
+		s.used -= int64(len(item.data))
+	}
+}
+
+// diskFile is one file in the disk cache
+type diskFile struct {
+	name string
+	size int64
+}
+
+// diskStore is a size-bounded LRU of file contents in a directory. Files are named by the
+// SHA-256 of their key; their modification time records when they were last used, so the
+// order survives restarts.
+type diskStore struct {
+	dir   string
+	limit int64
+
+	mu    sync.Mutex
+	used  int64
+	order *list.List // of *diskFile, most recently used first
+	files map[string]*list.Element
+}
+
+// openDiskStore opens the disk cache directory and indexes what it already holds
+func openDiskStore(opts CacheOptions) (*diskStore, error) {
+	dir := opts.Dir
+	if dir == "" {
+		cacheDir, err := os.UserCacheDir()
+		if err != nil {
+			return nil, err
+		}
+		dir = filepath.Join(cacheDir, "fs-mcp")
+	} else if strings.HasPrefix(dir, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		dir = filepath.Join(home, dir[2:])
+	}
+	diskMB := opts.DiskMB
+	if diskMB <= 0 {
+		diskMB = defaultCacheDiskMB
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	type existing struct {
+		diskFile
+		used time.Time
+	}
+	var found []existing
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		if strings.HasPrefix(entry.Name(), ".tmp-") {
+			os.Remove(filepath.Join(dir, entry.Name()))
+			continue
+		}
+		found = append(found, existing{diskFile{entry.Name(), info.Size()}, info.ModTime()})
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].used.After(found[j].used) })
+
+	d := &diskStore{
+		dir:   dir,
+		limit: int64(diskMB) << 20,
+		order: list.New(),
+		files: make(map[string]*list.Element),
+	}
+	for _, f := range found {
+		file := f.diskFile
+		d.files[file.name] = d.order.PushBack(&file)
+		d.used += file.size
+	}
+	d.evict()
+	return d, nil
+}
+
+// diskName is the file name content is stored under
+func diskName(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func (d *diskStore) get(key string) ([]byte, bool) {
+	name := diskName(key)
+	d.mu.Lock()
+	el, ok := d.files[name]
+	if ok {
+		d.order.MoveToFront(el)
+	}
+	d.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+	full := filepath.Join(d.dir, name)
+	data, err := os.ReadFile(full)
+	if err != nil {
+		d.remove(name)
+		return nil, false
+	}
+	now := time.Now()
+	os.Chtimes(full, now, now)
+	return data, true
+}
+
+func (d *diskStore) put(key string, data []byte) {
+	size := int64(len(data))
+	if size > d.limit/4 {
+		return
+	}
+	name := diskName(key)
+	d.mu.Lock()
+	_, ok := d.files[name]
+	d.mu.Unlock()
+	if ok {
+		return
+	}
+
+	// Write under a temporary name so that a crash never leaves a truncated entry
+	tmp, err := os.CreateTemp(d.dir, ".tmp-")
+	if err != nil {
+		log.Printf("Failed to write disk cache: %v", err)
+		return
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filepath.Join(d.dir, name))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		log.Printf("Failed to write disk cache: %v", err)
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.files[name]; ok {
+		return
+	}
+	d.files[name] = d.order.PushFront(&diskFile{name: name, size: size})
+	d.used += size
+	d.evict()
+}
+
+// remove forgets a file that can no longer be read
+func (d *diskStore) remove(name string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if el, ok := d.files[name]; ok {
+		d.used -= el.Value.(*diskFile).size
+		d.order.Remove(el)
+		delete(d.files, name)
+	}
+	os.Remove(filepath.Join(d.dir, name))
+}
+
+// evict deletes the least recently used files until the cache fits; the caller holds d.mu
+func (d *diskStore) evict() {
+	for d.used > d.limit {
+		oldest := d.order.Back()
+		file := oldest.Value.(*diskFile)
+		d.order.Remove(oldest)
+		delete(d.files, file.name)
+		d.used -= file.size
+		os.Remove(filepath.Join(d.dir, file.name))
+	}
+}
@@ -0,0 +1,378 @@
+package backends
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// execTimeout bounds a single command run for an exec repository
+	execTimeout = 30 * time.Second
+	// execNotExist is the exit status of a script whose path doesn't exist. Errors of the
+	// command template itself, such as a missing container, must not look like that, so
+	// it isn't recognized by the error message.
+	execNotExist = 66
+)
+
+// lsLine matches one entry of `ls -ln` output in the C locale: mode, link count, uid, gid,
+// size, date and name. Device files, whose size column is "major, minor", don't match.
+var lsLine = regexp.MustCompile(`^([-bcdlps])([-rwxsStT]{9})\S*\s+\d+\s+\S+\s+\S+\s+(\d+)\s+([A-Z][a-z]{2})\s+(\d{1,2})\s+(\d{1,2}:\d{2}|\d{4}) (.*)$`)
+
+// execFileInfo implements fs.FileInfo for an entry parsed from ls output
+type execFileInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+	link    string // symlink target
+}
+
+func (i *execFileInfo) Name() string       { return i.name }
+func (i *execFileInfo) Size() int64        { return i.size }
+func (i *execFileInfo) Mode() fs.FileMode  { return i.mode }
+func (i *execFileInfo) ModTime() time.Time { return i.modTime }
+func (i *execFileInfo) IsDir() bool        { return i.mode.IsDir() }
+func (i *execFileInfo) Sys() interface{}   { return nil }
+
+// parseLsMode converts an ls type character and permission string to a FileMode
+func parseLsMode(kind byte, perms string) fs.FileMode {
+	var mode fs.FileMode
+	switch kind {
+	case 'd':
+		mode = fs.ModeDir
+	case 'l':
+		mode = fs.ModeSymlink
+	case 'p':
+		mode = fs.ModeNamedPipe
+	case 's':
+		mode = fs.ModeSocket
+	case 'b':
+		mode = fs.ModeDevice
+	case 'c':
+		mode = fs.ModeDevice | fs.ModeCharDevice
+	}
+	for i, c := range perms {
+		if c != '-' && c != 'S' && c != 'T' {
+			mode |= 1 << uint(8-i)
+		}
+	}
+	if perms[2] == 's' || perms[2] == 'S' {
+		mode |= fs.ModeSetuid
+	}
+	if perms[5] == 's' || perms[5] == 'S' {
+		mode |= fs.ModeSetgid
+	}
+	if perms[8] == 't' || perms[8] == 'T' {
+		mode |= fs.ModeSticky
+	}
+	return mode
+}
+
+// parseLsTime parses an ls date. Recent files show a time instead of a year, so the year
+// is the current one unless that would put the date in the future.
+func parseLsTime(month, day, timeOrYear string, now time.Time) time.Time {
+	if strings.Contains(timeOrYear, ":") {
+		t, err := time.Parse("Jan 2 15:04 2006", fmt.Sprintf("%s %s %s %d", month, day, timeOrYear, now.Year()))
+		if err != nil {
+			return time.Time{}
+		}
+		if t.After(now.Add(24 * time.Hour)) {
+			t = t.AddDate(-1, 0, 0)
+		}
+		return t
+	}
+	t, err := time.Parse("Jan 2 2006", fmt.Sprintf("%s %s %s", month, day, timeOrYear))
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// parseLsLine parses one line of `ls -ln` output; ok is false for lines that aren't entries
+func parseLsLine(line string, now time.Time) (*execFileInfo, bool) {
+	m := lsLine.FindStringSubmatch(line)
+	if m == nil {
+		return nil, false
+	}
+	size, _ := strconv.ParseInt(m[3], 10, 64)
+	info := &execFileInfo{
+		name:    m[7],
+		size:    size,
+		mode:    parseLsMode(m[1][0], m[2]),
+		modTime: parseLsTime(m[4], m[5], m[6], now),
+	}
+	if info.mode&fs.ModeSymlink != 0 {
+		if i := strings.Index(info.name, " -> "); i >= 0 {
+			info.name, info.link = info.name[:i], info.name[i+4:]
+		}
+	}
+	return info, true
+}
+
+// shellQuote quotes s for a POSIX shell
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// ExecConfig holds the settings of an exec repository; its path is the absolute root on
+// the target
+type ExecConfig struct {
+	Command []string `json:"command"` // Runs a shell script on the target, "{script}" marks where it goes
+}
+
+func init() {
+	RegisterBackend("exec", &Backend{
+		Decode: decodeExecConfig,
+		Open: func(ctx context.Context, repo *Repository, pool *Pool) (FileSystem, error) {
+			return NewExecFS(repo.Path, repo.Config.(*ExecConfig)), nil
+		},
+		ListsTree: true,
+	})
+}
+
+// decodeExecConfig parses and validates an exec repository's settings
+func decodeExecConfig(repo *Repository, raw json.RawMessage) (interface{}, error) {
+	var cfg ExecConfig
+	if err := decodeConfig(repo, raw, &cfg); err != nil {
+		return nil, err
+	}
+	if len(cfg.Command) == 0 {
+		return nil, fmt.Errorf("repository %s: exec repo requires 'command'", repo.Name)
+	}
+	if repo.Path == "" {
+		return nil, fmt.Errorf("repository %s: exec repo requires 'path'", repo.Name)
+	}
+	if !path.IsAbs(repo.Path) {
+		return nil, fmt.Errorf("repository %s: exec repo 'path' must be absolute", repo.Name)
+	}
+	return &cfg, nil
+}
+
+// ExecFS implements FileSystem by running shell commands through a configured command,
+// such as `docker exec` or `kubectl exec`, and parsing the output of ls and cat
+type ExecFS struct {
+	basePath string
+	command  []string
+}
+
+func NewExecFS(basePath string, cfg *ExecConfig) *ExecFS {
+	return &ExecFS{basePath: basePath, command: cfg.Command}
+}
+
+// fullPath returns the path of a repository-relative path on the target
+func (e *ExecFS) fullPath(p string) string {
+	return path.Join(e.basePath, filepath.ToSlash(p))
+}
+
+// existing prefixes a script with a check that a path exists, exiting with execNotExist if
+// it doesn't. A symlink itself counts unless follow is set.
+func existing(fullPath string, follow bool, script string) string {
+	test := fmt.Sprintf("[ -e %s ]", shellQuote(fullPath))
+	if !follow {
+		test += fmt.Sprintf(" || [ -L %s ]", shellQuote(fullPath))
+	}
+	return fmt.Sprintf("{ %s; } || exit %d; %s", test, execNotExist, script)
+}
+
+// run runs a shell script through the command template and returns its output. The script
+// replaces "{script}" in the template's arguments, or is appended when there is none.
+func (e *ExecFS) run(ctx context.Context, op, p, script string) ([]byte, error) {
+	script = "LC_ALL=C TZ=UTC; export LC_ALL TZ; " + script
+	args := make([]string, 0, len(e.command)+1)
+	placed := false
+	for _, arg := range e.command {
+		if strings.Contains(arg, "{script}") {
+			arg = strings.ReplaceAll(arg, "{script}", script)
+			placed = true
+		}
+		args = append(args, arg)
+	}
+	if !placed {
+		args = append(args, script)
+	}
+
+	runCtx, cancel := context.WithTimeout(ctx, execTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(runCtx, args[0], args[1:]...)
+	// Children of a killed command may hold its output open; don't wait for them
+	cmd.WaitDelay = time.Second
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if runCtx.Err() == context.DeadlineExceeded {
+			return nil, &fs.PathError{Op: op, Path: p, Err: fmt.Errorf("command timed out after %s", execTimeout)}
+		}
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == execNotExist {
+			return nil, &fs.PathError{Op: op, Path: p, Err: fs.ErrNotExist}
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, &fs.PathError{Op: op, Path: p, Err: errors.New(msg)}
+		}
+		return nil, &fs.PathError{Op: op, Path: p, Err: err}
+	}
+	return stdout.Bytes(), nil
+}
+
+// stat runs `ls -lnd` on a path, following a final symlink when follow is set
+func (e *ExecFS) stat(ctx context.Context, op, p string, follow bool) (*execFileInfo, error) {
+	flags := "-lnd"
+	if follow {
+		flags = "-lndL"
+	}
+	fullPath := e.fullPath(p)
+	out, err := e.run(ctx, op, p, existing(fullPath, follow, fmt.Sprintf("ls %s -- %s", flags, shellQuote(fullPath))))
+	if err != nil {
+		return nil, err
+	}
+	info, ok := parseLsLine(strings.TrimRight(string(out), "\n"), time.Now())
+	if !ok {
+		return nil, &fs.PathError{Op: op, Path: p, Err: fmt.Errorf("unexpected ls output: %q", out)}
+	}
+	info.name = path.Base(e.fullPath(p))
+	return info, nil
+}
+
+func (e *ExecFS) ReadFile(ctx context.Context, p string) ([]byte, error) {
+	fullPath := e.fullPath(p)
+	return e.run(ctx, "open", p, existing(fullPath, true, "cat -- "+shellQuote(fullPath)))
+}
+
+func (e *ExecFS) ReadDir(ctx context.Context, p string) ([]fs.DirEntry, error) {
+	fullPath := e.fullPath(p)
+	out, err := e.run(ctx, "readdir", p, existing(fullPath, true, fmt.Sprintf("cd -- %s && ls -lna", shellQuote(fullPath))))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var entries []fs.DirEntry
+	for _, line := range strings.Split(string(out), "\n") {
+		info, ok := parseLsLine(line, now)
+		if !ok || info.name == "." || info.name == ".." {
+			continue
+		}
+		entries = append(entries, fs.FileInfoToDirEntry(info))
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+func (e *ExecFS) Stat(ctx context.Context, p string) (fs.FileInfo, error) {
+	return e.stat(ctx, "stat", p, true)
+}
+
+func (e *ExecFS) Readlink(ctx context.Context, p string) (string, error) {
+	info, err := e.stat(ctx, "readlink", p, false)
+	if err != nil {
+		return "", err
+	}
+	if info.mode&fs.ModeSymlink == 0 {
+		return "", &fs.PathError{Op: "readlink", Path: p, Err: errors.New("not a symbolic link")}
+	}
+	return info.link, nil
+}
+
+// Walk lists the whole tree with a single `ls -lnaR` and walks it like filepath.Walk
+func (e *ExecFS) Walk(ctx context.Context, root string, fn filepath.WalkFunc) error {
+	fullPath := e.fullPath(root)
+	info, err := e.stat(ctx, "lstat", root, false)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		return fn(fullPath, nil, err)
+	}
+	if !info.IsDir() {
+		return fn(fullPath, info, nil)
+	}
+
+	out, err := e.run(ctx, "walk", root, existing(fullPath, true, fmt.Sprintf("cd -- %s && ls -lnaR .", shellQuote(fullPath))))
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		return fn(fullPath, info, err)
+	}
+
+	// Output is a section per directory, each headed by "dir:" and separated by blank lines
+	now := time.Now()
+	dirs := make(map[string][]*execFileInfo)
+	dir := ""
+	header := true
+	for _, line := range strings.Split(string(out), "\n") {
+		switch {
+		case line == "":
+			header = true
+		case header && strings.HasSuffix(line, ":"):
+			dir = path.Clean(strings.TrimSuffix(line, ":"))
+			header = false
+		default:
+			header = false
+			if entry, ok := parseLsLine(line, now); ok && entry.name != "." && entry.name != ".." {
+				dirs[dir] = append(dirs[dir], entry)
+			}
+		}
+	}
+	for _, entries := range dirs {
+		sort.Slice(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+	}
+
+	err = e.walk(ctx, ".", fullPath, info, dirs, fn)
+	if err == filepath.SkipDir || err == filepath.SkipAll {
+		return nil
+	}
+	return err
+}
+
+func (e *ExecFS) walk(ctx context.Context, rel, fullPath string, info *execFileInfo, dirs map[string][]*execFileInfo, fn filepath.WalkFunc) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fn(fullPath, info, nil)
+	}
+	if err := fn(fullPath, info, nil); err != nil {
+		return err
+	}
+	for _, child := range dirs[rel] {
+		if err := e.walk(ctx, path.Join(rel, child.name), path.Join(fullPath, child.name), child, dirs, fn); err != nil {
+			if !child.IsDir() || err != filepath.SkipDir {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (e *ExecFS) BasePath() string {
+	return e.basePath
+}
+
+func (e *ExecFS) Type() string {
+	return "exec"
+}
+
+func (e *ExecFS) Info() map[string]string {
+	return map[string]string{
+		"type":    "exec",
+		"command": strings.Join(e.command, " "),
+		"path":    e.basePath,
+	}
+}
@@ -0,0 +1,312 @@
+package backends
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestExecFS creates a tree in a temporary directory and an ExecFS over it that runs
+// scripts with sh -c. The tree has names containing spaces and symlinks to a file and a
+// directory.
+func newTestExecFS(t *testing.T) (*ExecFS, string) {
+	t.Helper()
+	root := t.TempDir()
+	files := map[string]string{
+		"top.txt":                  "top\n",
+		"sub dir/file one.txt":     "hello\n",
+		"sub dir/deeper/inner.txt": "inner\n",
+	}
+	for name, content := range files {
+		p := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("top.txt", filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("sub dir", filepath.Join(root, "dir link")); err != nil {
+		t.Fatal(err)
+	}
+	return NewExecFS(root, &ExecConfig{Command: []string{"sh", "-c", "{script}"}}), root
+}
+
+func TestExecFSStat(t *testing.T) {
+	e, _ := newTestExecFS(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		path  string
+		name  string
+		size  int64
+		isDir bool
+	}{
+		{"top.txt", "top.txt", 4, false},
+		{"sub dir", "sub dir", -1, true},
+		{"sub dir/file one.txt", "file one.txt", 6, false},
+		{"link", "link", 4, false}, // Stat follows the link
+		{".", filepath.Base(e.BasePath()), -1, true},
+	}
+	for _, tt := range tests {
+		info, err := e.Stat(ctx, tt.path)
+		if err != nil {
+			t.Errorf("Stat(%q): %v", tt.path, err)
+			continue
+		}
+		if info.Name() != tt.name {
+			t.Errorf("Stat(%q).Name() = %q, want %q", tt.path, info.Name(), tt.name)
+		}
+		if info.IsDir() != tt.isDir {
+			t.Errorf("Stat(%q).IsDir() = %v, want %v", tt.path, info.IsDir(), tt.isDir)
+		}
+		if tt.size >= 0 && info.Size() != tt.size {
+			t.Errorf("Stat(%q).Size() = %d, want %d", tt.path, info.Size(), tt.size)
+		}
+		if info.Mode()&fs.ModeSymlink != 0 {
+			t.Errorf("Stat(%q) returned a symlink mode", tt.path)
+		}
+		if time.Since(info.ModTime()) > time.Hour {
+			t.Errorf("Stat(%q).ModTime() = %v, want about now", tt.path, info.ModTime())
+		}
+	}
+
+	for _, p := range []string{"missing", "sub dir/missing file", "missing dir/x"} {
+		if _, err := e.Stat(ctx, p); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("Stat(%q) error = %v, want fs.ErrNotExist", p, err)
+		}
+	}
+}
+
+func TestExecFSReadDir(t *testing.T) {
+	e, _ := newTestExecFS(t)
+	ctx := context.Background()
+
+	entries, err := e.ReadDir(ctx, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	modes := make(map[string]fs.FileMode)
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+		modes[entry.Name()] = entry.Type()
+	}
+	if want := []string{"dir link", "link", "sub dir", "top.txt"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("ReadDir(.) = %q, want %q", names, want)
+	}
+	for name, want := range map[string]fs.FileMode{"dir link": fs.ModeSymlink, "link": fs.ModeSymlink, "sub dir": fs.ModeDir, "top.txt": 0} {
+		if modes[name] != want {
+			t.Errorf("ReadDir(.) type of %q = %v, want %v", name, modes[name], want)
+		}
+	}
+
+	entries, err = e.ReadDir(ctx, "sub dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	names = nil
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if want := []string{"deeper", "file one.txt"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("ReadDir(sub dir) = %q, want %q", names, want)
+	}
+
+	if _, err := e.ReadDir(ctx, "missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("ReadDir(missing) error = %v, want fs.ErrNotExist", err)
+	}
+}
+
+func TestExecFSReadFile(t *testing.T) {
+	e, _ := newTestExecFS(t)
+	ctx := context.Background()
+
+	for p, want := range map[string]string{
+		"top.txt":                  "top\n",
+		"sub dir/file one.txt":     "hello\n",
+		"sub dir/deeper/inner.txt": "inner\n",
+		"link":                     "top\n",
+		"dir link/file one.txt":    "hello\n",
+	} {
+		data, err := e.ReadFile(ctx, p)
+		if err != nil {
+			t.Errorf("ReadFile(%q): %v", p, err)
+			continue
+		}
+		if string(data) != want {
+			t.Errorf("ReadFile(%q) = %q, want %q", p, data, want)
+		}
+	}
+
+	if _, err := e.ReadFile(ctx, "missing.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("ReadFile(missing.txt) error = %v, want fs.ErrNotExist", err)
+	}
+}
+
+func TestExecFSReadlink(t *testing.T) {
+	e, _ := newTestExecFS(t)
+	ctx := context.Background()
+
+	for p, want := range map[string]string{"link": "top.txt", "dir link": "sub dir"} {
+		target, err := e.Readlink(ctx, p)
+		if err != nil {
+			t.Errorf("Readlink(%q): %v", p, err)
+			continue
+		}
+		if target != want {
+			t.Errorf("Readlink(%q) = %q, want %q", p, target, want)
+		}
+	}
+	if _, err := e.Readlink(ctx, "top.txt"); err == nil {
+		t.Error("Readlink(top.txt) succeeded on a regular file")
+	}
+	if _, err := e.Readlink(ctx, "missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Readlink(missing) error = %v, want fs.ErrNotExist", err)
+	}
+}
+
+func TestExecFSWalk(t *testing.T) {
+	e, root := newTestExecFS(t)
+	ctx := context.Background()
+
+	walk := func(start string, skip string) []string {
+		t.Helper()
+		var visited []string
+		err := e.Walk(ctx, start, func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				t.Fatalf("Walk(%q) callback error for %s: %v", start, p, err)
+			}
+			rel, _ := filepath.Rel(root, p)
+			if info.Mode()&fs.ModeSymlink != 0 {
+				rel += "@"
+			} else if info.IsDir() {
+				rel += "/"
+			}
+			visited = append(visited, rel)
+			if info.IsDir() && info.Name() == skip {
+				return filepath.SkipDir
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Walk(%q): %v", start, err)
+		}
+		return visited
+	}
+
+	// Symlinks are reported, not followed
+	want := []string{
+		"./",
+		"dir link@",
+		"link@",
+		"sub dir/",
+		"sub dir/deeper/",
+		"sub dir/deeper/inner.txt",
+		"sub dir/file one.txt",
+		"top.txt",
+	}
+	if got := walk(".", ""); !reflect.DeepEqual(got, want) {
+		t.Errorf("Walk(.) visited\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	want = []string{"sub dir/", "sub dir/deeper/", "sub dir/file one.txt"}
+	if got := walk("sub dir", "deeper"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Walk(sub dir) with SkipDir visited %q, want %q", got, want)
+	}
+
+	want = []string{"top.txt"}
+	if got := walk("top.txt", ""); !reflect.DeepEqual(got, want) {
+		t.Errorf("Walk(top.txt) visited %q, want %q", got, want)
+	}
+
+	var walkErr error
+	err := e.Walk(ctx, "missing", func(p string, info os.FileInfo, err error) error {
+		walkErr = err
+		return nil
+	})
+	if err != nil {
+		t.Errorf("Walk(missing) = %v, want the callback's nil", err)
+	}
+	if !errors.Is(walkErr, fs.ErrNotExist) {
+		t.Errorf("Walk(missing) passed %v to the callback, want fs.ErrNotExist", walkErr)
+	}
+}
+
+func TestExecFSCommandTemplate(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "it's here.txt"), []byte("quoted\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// Without "{script}" the script is appended as the last argument
+	e := NewExecFS(root, &ExecConfig{Command: []string{"sh", "-c"}})
+	data, err := e.ReadFile(ctx, "it's here.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "quoted\n" {
+		t.Errorf("ReadFile = %q, want %q", data, "quoted\n")
+	}
+
+	e = NewExecFS(root, &ExecConfig{Command: []string{"sh", "-c", "echo boom >&2; exit 3", "{script}"}})
+	if _, err := e.ReadFile(ctx, "it's here.txt"); err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("ReadFile through a failing command = %v, want its stderr", err)
+	}
+
+	// The command's own failures aren't a missing path, whatever they say
+	e = NewExecFS(root, &ExecConfig{Command: []string{"sh", "-c", "echo 'docker: open /var/run/docker.sock: no such file or directory' >&2; echo \"can't cd\" >&2; exit 1", "{script}"}})
+	for name, op := range map[string]func() error{
+		"Stat":    func() error { _, err := e.Stat(ctx, "it's here.txt"); return err },
+		"ReadDir": func() error { _, err := e.ReadDir(ctx, "."); return err },
+	} {
+		if err := op(); err == nil || errors.Is(err, fs.ErrNotExist) || !strings.Contains(err.Error(), "docker.sock") {
+			t.Errorf("%s through a broken command = %v, want its stderr and not fs.ErrNotExist", name, err)
+		}
+	}
+}
+
+func TestParseLsLine(t *testing.T) {
+	now := time.Date(2025, time.March, 10, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		line    string
+		name    string
+		link    string
+		size    int64
+		mode    fs.FileMode
+		modTime time.Time
+	}{
+		{"-rw-r--r-- 1 1000 1000 1234 Mar  9 08:15 notes.txt", "notes.txt", "", 1234, 0644, time.Date(2025, time.March, 9, 8, 15, 0, 0, time.UTC)},
+		{"drwxr-xr-x 2 0 0 4096 Dec 31  2023 a dir", "a dir", "", 4096, fs.ModeDir | 0755, time.Date(2023, time.December, 31, 0, 0, 0, 0, time.UTC)},
+		{"lrwxrwxrwx 1 0 0 7 Mar 10 11:00 my link -> my file", "my link", "my file", 7, fs.ModeSymlink | 0777, time.Date(2025, time.March, 10, 11, 0, 0, 0, time.UTC)},
+		// A recent date later in the year than now is from last year
+		{"-rwsr-xr-T 1 0 0 0 Dec 20 10:00 old", "old", "", 0, fs.ModeSetuid | fs.ModeSticky | 0754, time.Date(2024, time.December, 20, 10, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		info, ok := parseLsLine(tt.line, now)
+		if !ok {
+			t.Errorf("parseLsLine(%q) didn't match", tt.line)
+			continue
+		}
+		if info.name != tt.name || info.link != tt.link || info.size != tt.size || info.mode != tt.mode || !info.modTime.Equal(tt.modTime) {
+			t.Errorf("parseLsLine(%q) = {%q %q %d %v %v}, want {%q %q %d %v %v}", tt.line,
+				info.name, info.link, info.size, info.mode, info.modTime, tt.name, tt.link, tt.size, tt.mode, tt.modTime)
+		}
+	}
+
+	for _, line := range []string{"total 12", "", "crw-rw-rw- 1 0 0 1, 3 Mar  9 08:15 null"} {
+		if _, ok := parseLsLine(line, now); ok {
+			t.Errorf("parseLsLine(%q) matched", line)
+		}
+	}
+}
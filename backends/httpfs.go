@@ -0,0 +1,523 @@
+package backends
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// httpTimeout bounds a single request to a WebDAV or HTTP repository
+	httpTimeout = 30 * time.Second
+	// httpCacheSize bounds the bytes of response bodies kept for revalidation
+	httpCacheSize = 32 << 20
+	// httpCacheMaxEntry is the largest response body that is cached
+	httpCacheMaxEntry = 4 << 20
+)
+
+var httpRepoClient = &http.Client{Timeout: httpTimeout}
+
+// httpResponse is a fully read response
+type httpResponse struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+// httpCacheEntry is a cached GET response and what's needed to revalidate it
+type httpCacheEntry struct {
+	body         []byte
+	header       http.Header
+	etag         string
+	lastModified string
+	expires      time.Time // fresh until then; after that it must be revalidated
+}
+
+// httpCache keeps GET responses of WebDAV and HTTP repositories according to their
+// Cache-Control, ETag and Last-Modified headers. The oldest entries are dropped first.
+type httpCache struct {
+	mu      sync.Mutex
+	entries map[string]*httpCacheEntry
+	order   []string
+	size    int
+}
+
+var httpResponses = &httpCache{entries: make(map[string]*httpCacheEntry)}
+
+func (c *httpCache) get(key string) *httpCacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.entries[key]
+}
+
+func (c *httpCache) put(key string, entry *httpCacheEntry) {
+	if len(entry.body) > httpCacheMaxEntry {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if prev, ok := c.entries[key]; ok {
+		c.size -= len(prev.body)
+	} else {
+		c.order = append(c.order, key)
+	}
+	c.entries[key] = entry
+	c.size += len(entry.body)
+	for c.size > httpCacheSize && len(c.order) > 0 {
+		oldest := c.order[0]
+		c.order = c.order[1:]
+		if e, ok := c.entries[oldest]; ok {
+			c.size -= len(e.body)
+			delete(c.entries, oldest)
+		}
+	}
+}
+
+// cachePolicy reads Cache-Control: whether a response may be stored, and how long it is
+// fresh without revalidation
+func cachePolicy(header http.Header) (bool, time.Duration) {
+	var maxAge time.Duration
+	for _, directive := range strings.Split(strings.ToLower(header.Get("Cache-Control")), ",") {
+		directive = strings.TrimSpace(directive)
+		switch {
+		case directive == "no-store":
+			return false, 0
+		case directive == "no-cache":
+			maxAge = 0
+		case strings.HasPrefix(directive, "max-age="):
+			if seconds, err := strconv.Atoi(strings.TrimPrefix(directive, "max-age=")); err == nil {
+				maxAge = time.Duration(seconds) * time.Second
+			}
+		}
+	}
+	return true, maxAge
+}
+
+// HTTPConfig holds the settings of a webdav or http repository
+type HTTPConfig struct {
+	URL            string `json:"url"`
+	User           string `json:"user"`            // Basic auth user (default <credentials_env>_USERNAME)
+	CredentialsEnv string `json:"credentials_env"` // Prefix of the credential variables, e.g. "DOCS" for DOCS_TOKEN
+}
+
+func init() {
+	RegisterBackend("http", &Backend{
+		Decode: decodeHTTPConfig,
+		Open: func(ctx context.Context, repo *Repository, pool *Pool) (FileSystem, error) {
+			return NewHTTPIndexFS(repo.Config.(*HTTPConfig))
+		},
+		Location: httpLocation,
+		Cached:   true,
+	})
+	RegisterBackend("webdav", &Backend{
+		Decode: decodeHTTPConfig,
+		Open: func(ctx context.Context, repo *Repository, pool *Pool) (FileSystem, error) {
+			return NewWebDAVFS(repo.Config.(*HTTPConfig))
+		},
+		Location: httpLocation,
+		Cached:   true,
+	})
+}
+
+// decodeHTTPConfig parses and validates a webdav or http repository's settings
+func decodeHTTPConfig(repo *Repository, raw json.RawMessage) (interface{}, error) {
+	var cfg HTTPConfig
+	if err := decodeConfig(repo, raw, &cfg); err != nil {
+		return nil, err
+	}
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("repository %s: %s repo requires 'url'", repo.Name, repo.Type)
+	}
+	return &cfg, nil
+}
+
+func httpLocation(repo *Repository) string {
+	return repo.Config.(*HTTPConfig).URL
+}
+
+// httpClient sends authenticated requests for one WebDAV or HTTP repository
+type httpClient struct {
+	base     *url.URL // always ends in "/"
+	user     string
+	password string
+	token    string
+}
+
+// newHTTPClient parses a repository's URL and reads its credentials from the environment:
+// <credentials_env>_TOKEN for a bearer token, or <credentials_env>_USERNAME (or the
+// configured user) and <credentials_env>_PASSWORD for basic auth
+func newHTTPClient(cfg *HTTPConfig) (*httpClient, error) {
+	base, err := url.Parse(cfg.URL)
+	if err != nil || (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" {
+		return nil, fmt.Errorf("invalid URL: %s", cfg.URL)
+	}
+	if !strings.HasSuffix(base.Path, "/") {
+		base.Path += "/"
+		base.RawPath = ""
+	}
+
+	c := &httpClient{base: base, user: cfg.User}
+	if cfg.CredentialsEnv != "" {
+		c.token = os.Getenv(cfg.CredentialsEnv + "_TOKEN")
+		if c.user == "" {
+			c.user = os.Getenv(cfg.CredentialsEnv + "_USERNAME")
+		}
+		c.password = os.Getenv(cfg.CredentialsEnv + "_PASSWORD")
+	}
+	return c, nil
+}
+
+// resolve returns the URL of a repository-relative path; directories end in "/"
+func (c *httpClient) resolve(p string, dir bool) string {
+	rel := path.Clean(filepath.ToSlash(p))
+	if rel == "." {
+		return c.base.String()
+	}
+	segments := strings.Split(rel, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	escaped := strings.Join(segments, "/")
+	if dir {
+		escaped += "/"
+	}
+	ref, _ := url.Parse(escaped)
+	return c.base.ResolveReference(ref).String()
+}
+
+// do sends a request and reads the response. GET responses are cached and revalidated
+// as their caching headers allow.
+func (c *httpClient) do(ctx context.Context, method, target string, header http.Header, body string) (*httpResponse, error) {
+	cacheKey := ""
+	var cached *httpCacheEntry
+	if method == http.MethodGet {
+		cacheKey = c.user + "\x00" + c.token + "\x00" + target
+		if cached = httpResponses.get(cacheKey); cached != nil && time.Now().Before(cached.expires) {
+			return &httpResponse{status: http.StatusOK, header: cached.header, body: cached.body}, nil
+		}
+	}
+
+	var reqBody io.Reader
+	if body != "" {
+		reqBody = strings.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	switch {
+	case c.token != "":
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	case c.user != "":
+		req.SetBasicAuth(c.user, c.password)
+	}
+	if cached != nil {
+		if cached.etag != "" {
+			req.Header.Set("If-None-Match", cached.etag)
+		}
+		if cached.lastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.lastModified)
+		}
+	}
+
+	resp, err := httpRepoClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if cached != nil && resp.StatusCode == http.StatusNotModified {
+		if _, maxAge := cachePolicy(resp.Header); maxAge > 0 {
+			refreshed := *cached
+			refreshed.expires = time.Now().Add(maxAge)
+			httpResponses.put(cacheKey, &refreshed)
+		}
+		return &httpResponse{status: http.StatusOK, header: cached.header, body: cached.body}, nil
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	result := &httpResponse{status: resp.StatusCode, header: resp.Header, body: data}
+
+	if cacheKey != "" && resp.StatusCode == http.StatusOK {
+		store, maxAge := cachePolicy(resp.Header)
+		entry := &httpCacheEntry{
+			body:         data,
+			header:       resp.Header,
+			etag:         resp.Header.Get("ETag"),
+			lastModified: resp.Header.Get("Last-Modified"),
+			expires:      time.Now().Add(maxAge),
+		}
+		if store && (maxAge > 0 || entry.etag != "" || entry.lastModified != "") {
+			httpResponses.put(cacheKey, entry)
+		}
+	}
+	return result, nil
+}
+
+// statusError turns an unexpected status into an error
+func statusError(op, p string, resp *httpResponse) error {
+	switch resp.status {
+	case http.StatusNotFound, http.StatusGone:
+		return &fs.PathError{Op: op, Path: p, Err: fs.ErrNotExist}
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return &fs.PathError{Op: op, Path: p, Err: fs.ErrPermission}
+	}
+	return &fs.PathError{Op: op, Path: p, Err: fmt.Errorf("unexpected response: %d %s", resp.status, http.StatusText(resp.status))}
+}
+
+// httpInfo implements fs.FileInfo for a WebDAV resource or an autoindex entry
+type httpInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+func (i *httpInfo) Name() string       { return i.name }
+func (i *httpInfo) Size() int64        { return i.size }
+func (i *httpInfo) ModTime() time.Time { return i.modTime }
+func (i *httpInfo) IsDir() bool        { return i.dir }
+func (i *httpInfo) Sys() interface{}   { return nil }
+func (i *httpInfo) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+// walkReadDir walks a directory tree like filepath.Walk, listing each directory with readDir
+// only when it is entered
+func walkReadDir(ctx context.Context, fullPath, rel string, info fs.FileInfo, readDir func(context.Context, string) ([]fs.DirEntry, error), fn filepath.WalkFunc) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fn(fullPath, info, nil)
+	}
+	if err := fn(fullPath, info, nil); err != nil {
+		return err
+	}
+	entries, err := readDir(ctx, rel)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		return fn(fullPath, info, err)
+	}
+	for _, entry := range entries {
+		child, _ := entry.Info()
+		if err := walkReadDir(ctx, path.Join(fullPath, entry.Name()), path.Join(rel, entry.Name()), child, readDir, fn); err != nil {
+			if !child.IsDir() || err != filepath.SkipDir {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// indexLink matches a link in an autoindex page and the text up to the next tag, where
+// nginx puts the date and size
+var indexLink = regexp.MustCompile(`(?is)<a\s[^>]*?href\s*=\s*["']([^"']+)["'][^>]*>.*?</a>([^<]*)`)
+
+// nginxDetails matches the date and size nginx prints after each link
+var nginxDetails = regexp.MustCompile(`(\d{2}-[A-Z][a-z]{2}-\d{4} \d{2}:\d{2})\s+(\d+|-)`)
+
+// apacheRow matches the date and size cells that follow a link in an Apache index table
+var apacheRow = regexp.MustCompile(`(?is)^</a>\s*</td>\s*<td[^>]*>\s*(\d{4}-\d{2}-\d{2} \d{2}:\d{2})\s*</td>\s*<td[^>]*>\s*([\d.]+[KMG]?|-)\s*</td>`)
+
+// parseApacheSize converts Apache's human-readable sizes (1.2K, 3M) to an approximate byte count
+func parseApacheSize(s string) int64 {
+	multiplier := 1.0
+	switch {
+	case strings.HasSuffix(s, "K"):
+		multiplier = 1 << 10
+	case strings.HasSuffix(s, "M"):
+		multiplier = 1 << 20
+	case strings.HasSuffix(s, "G"):
+		multiplier = 1 << 30
+	}
+	n, err := strconv.ParseFloat(strings.TrimRight(s, "KMG"), 64)
+	if err != nil {
+		return 0
+	}
+	return int64(n * multiplier)
+}
+
+// parseAutoindex extracts the entries of a directory listing page. Only links to direct
+// children of dir are entries, which drops parent, sort-order and navigation links.
+func parseAutoindex(page string, dir *url.URL) []*httpInfo {
+	var entries []*httpInfo
+	seen := make(map[string]bool)
+	for _, loc := range indexLink.FindAllStringSubmatchIndex(page, -1) {
+		href := html.UnescapeString(page[loc[2]:loc[3]])
+		ref, err := url.Parse(href)
+		if err != nil || ref.RawQuery != "" || ref.Fragment != "" {
+			continue
+		}
+		target := dir.ResolveReference(ref)
+		if target.Scheme != dir.Scheme || target.Host != dir.Host || !strings.HasPrefix(target.Path, dir.Path) {
+			continue
+		}
+		name := strings.TrimPrefix(target.Path, dir.Path)
+		isDir := strings.HasSuffix(name, "/")
+		name = strings.TrimSuffix(name, "/")
+		if name == "" || strings.Contains(name, "/") || seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		info := &httpInfo{name: name, dir: isDir}
+		if m := nginxDetails.FindStringSubmatch(page[loc[4]:loc[5]]); m != nil {
+			info.modTime, _ = time.Parse("02-Jan-2006 15:04", m[1])
+			info.size, _ = strconv.ParseInt(m[2], 10, 64)
+		} else if m := apacheRow.FindStringSubmatch(page[loc[4]-len("</a>"):]); m != nil {
+			info.modTime, _ = time.Parse("2006-01-02 15:04", m[1])
+			info.size = parseApacheSize(m[2])
+		}
+		if info.dir {
+			info.size = 0
+		}
+		entries = append(entries, info)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+	return entries
+}
+
+// HTTPIndexFS implements FileSystem over a web server's generated directory listings
+// (nginx autoindex, Apache mod_autoindex, python -m http.server). Files are fetched with
+// GET; directories are recognized by a trailing "/" in their links.
+type HTTPIndexFS struct {
+	client *httpClient
+}
+
+func NewHTTPIndexFS(cfg *HTTPConfig) (*HTTPIndexFS, error) {
+	client, err := newHTTPClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &HTTPIndexFS{client: client}, nil
+}
+
+// list fetches and parses the listing of a directory
+func (h *HTTPIndexFS) list(ctx context.Context, op, p string) ([]*httpInfo, error) {
+	target := h.client.resolve(p, true)
+	resp, err := h.client.do(ctx, http.MethodGet, target, nil, "")
+	if err != nil {
+		return nil, &fs.PathError{Op: op, Path: p, Err: err}
+	}
+	if resp.status != http.StatusOK {
+		return nil, statusError(op, p, resp)
+	}
+	dirURL, _ := url.Parse(target)
+	return parseAutoindex(string(resp.body), dirURL), nil
+}
+
+func (h *HTTPIndexFS) ReadFile(ctx context.Context, p string) ([]byte, error) {
+	resp, err := h.client.do(ctx, http.MethodGet, h.client.resolve(p, false), nil, "")
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: p, Err: err}
+	}
+	if resp.status != http.StatusOK {
+		return nil, statusError("open", p, resp)
+	}
+	return resp.body, nil
+}
+
+func (h *HTTPIndexFS) ReadDir(ctx context.Context, p string) ([]fs.DirEntry, error) {
+	infos, err := h.list(ctx, "readdir", p)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]fs.DirEntry, len(infos))
+	for i, info := range infos {
+		entries[i] = fs.FileInfoToDirEntry(info)
+	}
+	return entries, nil
+}
+
+// Stat looks a path up in its parent's listing, which is the only place the server says
+// whether it is a directory
+func (h *HTTPIndexFS) Stat(ctx context.Context, p string) (fs.FileInfo, error) {
+	rel := path.Clean(filepath.ToSlash(p))
+	if rel == "." {
+		return &httpInfo{name: path.Base(h.BasePath()), dir: true}, nil
+	}
+	infos, err := h.list(ctx, "stat", path.Dir(rel))
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		// Only a missing parent (404 or 410) means p doesn't exist; keep any other failure
+		var pathErr *fs.PathError
+		if errors.As(err, &pathErr) {
+			err = pathErr.Err
+		}
+		return nil, &fs.PathError{Op: "stat", Path: p, Err: err}
+	}
+	for _, info := range infos {
+		if info.name == path.Base(rel) {
+			return info, nil
+		}
+	}
+	return nil, &fs.PathError{Op: "stat", Path: p, Err: fs.ErrNotExist}
+}
+
+func (h *HTTPIndexFS) Readlink(ctx context.Context, p string) (string, error) {
+	return "", &fs.PathError{Op: "readlink", Path: p, Err: errors.New("HTTP repositories have no symbolic links")}
+}
+
+func (h *HTTPIndexFS) Walk(ctx context.Context, root string, fn filepath.WalkFunc) error {
+	fullPath := path.Join(h.BasePath(), filepath.ToSlash(root))
+	info, err := h.Stat(ctx, root)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		return fn(fullPath, nil, err)
+	}
+	err = walkReadDir(ctx, fullPath, path.Clean(filepath.ToSlash(root)), info, h.ReadDir, fn)
+	if err == filepath.SkipDir || err == filepath.SkipAll {
+		return nil
+	}
+	return err
+}
+
+// BasePath is the path of the repository's URL
+func (h *HTTPIndexFS) BasePath() string {
+	return path.Clean(h.client.base.Path)
+}
+
+func (h *HTTPIndexFS) Type() string {
+	return "http"
+}
+
+func (h *HTTPIndexFS) Info() map[string]string {
+	return map[string]string{
+		"type": "http",
+		"url":  h.client.base.String(),
+	}
+}
@@ -0,0 +1,403 @@
+package backends
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const nginxIndex = `<html>
+<head><title>Index of /files/</title></head>
+<body>
+<h1>Index of /files/</h1><hr><pre><a href="../">../</a>
+<a href="docs/">docs/</a>                                              12-Mar-2024 10:15                   -
+<a href="my%20notes.txt">my notes.txt</a>                                       01-Feb-2024 08:00                1234
+<a href="readme.md">readme.md</a>                                          28-Feb-2024 23:59                  42
+</pre><hr></body>
+</html>
+`
+
+const apacheIndex = `<!DOCTYPE HTML PUBLIC "-//W3C//DTD HTML 3.2 Final//EN">
+<html>
+ <head>
+  <title>Index of /files</title>
+ </head>
+ <body>
+<h1>Index of /files</h1>
+  <table>
+   <tr><th valign="top"><img src="/icons/blank.gif" alt="[ICO]"></th><th><a href="?C=N;O=D">Name</a></th><th><a href="?C=M;O=A">Last modified</a></th><th><a href="?C=S;O=A">Size</a></th><th><a href="?C=D;O=A">Description</a></th></tr>
+   <tr><th colspan="5"><hr></th></tr>
+<tr><td valign="top"><img src="/icons/back.gif" alt="[PARENTDIR]"></td><td><a href="/">Parent Directory</a></td><td>&nbsp;</td><td align="right">  - </td><td>&nbsp;</td></tr>
+<tr><td valign="top"><img src="/icons/folder.gif" alt="[DIR]"></td><td><a href="docs/">docs/</a></td><td align="right">2024-03-12 10:15  </td><td align="right">  - </td><td>&nbsp;</td></tr>
+<tr><td valign="top"><img src="/icons/text.gif" alt="[TXT]"></td><td><a href="my%20notes.txt">my notes.txt</a></td><td align="right">2024-02-01 08:00  </td><td align="right">1.2K</td><td>&nbsp;</td></tr>
+<tr><td valign="top"><img src="/icons/unknown.gif" alt="[   ]"></td><td><a href="readme.md">readme.md</a></td><td align="right">2024-02-28 23:59  </td><td align="right"> 42 </td><td>&nbsp;</td></tr>
+   <tr><th colspan="5"><hr></th></tr>
+</table>
+</body></html>
+`
+
+func TestParseAutoindex(t *testing.T) {
+	dir, _ := url.Parse("http://example.com/files/")
+	type entry struct {
+		name    string
+		dir     bool
+		size    int64
+		modTime string
+	}
+	tests := []struct {
+		server string
+		page   string
+		want   []entry
+	}{
+		{"nginx", nginxIndex, []entry{
+			{"docs", true, 0, "2024-03-12 10:15"},
+			{"my notes.txt", false, 1234, "2024-02-01 08:00"},
+			{"readme.md", false, 42, "2024-02-28 23:59"},
+		}},
+		{"apache", apacheIndex, []entry{
+			{"docs", true, 0, "2024-03-12 10:15"},
+			{"my notes.txt", false, 1228, "2024-02-01 08:00"}, // 1.2K
+			{"readme.md", false, 42, "2024-02-28 23:59"},
+		}},
+	}
+	for _, tt := range tests {
+		var got []entry
+		for _, info := range parseAutoindex(tt.page, dir) {
+			got = append(got, entry{info.name, info.dir, info.size, info.modTime.Format("2006-01-02 15:04")})
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: parseAutoindex = %v, want %v", tt.server, got, tt.want)
+		}
+	}
+}
+
+// newIndexServer serves an nginx-style tree below /files/, plus directories that fail
+// with the given status below /files/<status>/
+func newIndexServer(t *testing.T, auth func(*http.Request) bool) *httptest.Server {
+	t.Helper()
+	pages := map[string]string{
+		"/files/":              nginxIndex,
+		"/files/docs/":         `<pre><a href="../">../</a><a href="guide.md">guide.md</a> 12-Mar-2024 10:15 7</pre>`,
+		"/files/readme.md":     "# readme\n",
+		"/files/my notes.txt":  "notes\n",
+		"/files/docs/guide.md": "guide\n",
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth != nil && !auth(r) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		for _, status := range []int{http.StatusForbidden, http.StatusGone, http.StatusInternalServerError} {
+			if strings.HasPrefix(r.URL.Path, fmt.Sprintf("/files/%d/", status)) {
+				w.WriteHeader(status)
+				return
+			}
+		}
+		page, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		fmt.Fprint(w, page)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestHTTPIndexFS(t *testing.T) {
+	server := newIndexServer(t, nil)
+	h, err := NewHTTPIndexFS(&HTTPConfig{URL: server.URL + "/files"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	entries, err := h.ReadDir(ctx, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if want := []string{"docs", "my notes.txt", "readme.md"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("ReadDir(.) = %q, want %q", names, want)
+	}
+
+	for p, want := range map[string]string{"readme.md": "# readme\n", "my notes.txt": "notes\n", "docs/guide.md": "guide\n"} {
+		data, err := h.ReadFile(ctx, p)
+		if err != nil || string(data) != want {
+			t.Errorf("ReadFile(%q) = %q, %v, want %q", p, data, err, want)
+		}
+	}
+
+	info, err := h.Stat(ctx, "docs")
+	if err != nil || !info.IsDir() {
+		t.Errorf("Stat(docs) = %v, %v, want a directory", info, err)
+	}
+	info, err = h.Stat(ctx, "my notes.txt")
+	if err != nil || info.IsDir() || info.Size() != 1234 {
+		t.Errorf("Stat(my notes.txt) = %v, %v, want a 1234 byte file", info, err)
+	}
+
+	var visited []string
+	err = h.Walk(ctx, ".", func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		visited = append(visited, strings.TrimPrefix(p, h.BasePath()))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"", "/docs", "/docs/guide.md", "/my notes.txt", "/readme.md"}; !reflect.DeepEqual(visited, want) {
+		t.Errorf("Walk(.) visited %q, want %q", visited, want)
+	}
+}
+
+// TestHTTPIndexFSStatErrors checks that only a missing parent makes Stat report a path
+// as not existing
+func TestHTTPIndexFSStatErrors(t *testing.T) {
+	server := newIndexServer(t, nil)
+	h, err := NewHTTPIndexFS(&HTTPConfig{URL: server.URL + "/files/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	for _, p := range []string{"missing.txt", "missing/x", "410/x"} {
+		if _, err := h.Stat(ctx, p); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("Stat(%q) error = %v, want fs.ErrNotExist", p, err)
+		}
+	}
+
+	if _, err := h.Stat(ctx, "403/x"); !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("Stat(403/x) error = %v, want fs.ErrPermission", err)
+	}
+	_, err = h.Stat(ctx, "500/x")
+	if err == nil || errors.Is(err, fs.ErrNotExist) || !strings.Contains(err.Error(), "500") {
+		t.Errorf("Stat(500/x) error = %v, want the server error", err)
+	}
+	var pathErr *fs.PathError
+	if !errors.As(err, &pathErr) || pathErr.Op != "stat" || pathErr.Path != "500/x" {
+		t.Errorf("Stat(500/x) error = %#v, want a stat error for 500/x", err)
+	}
+
+	server.Close()
+	if _, err := h.Stat(ctx, "readme.md"); err == nil || errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Stat(readme.md) with the server down = %v, want a request error", err)
+	}
+}
+
+func TestHTTPClientAuth(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("bearer", func(t *testing.T) {
+		server := newIndexServer(t, func(r *http.Request) bool {
+			return r.Header.Get("Authorization") == "Bearer sesame"
+		})
+		t.Setenv("FSTEST_TOKEN", "sesame")
+		h, err := NewHTTPIndexFS(&HTTPConfig{URL: server.URL + "/files", CredentialsEnv: "FSTEST"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := h.ReadFile(ctx, "readme.md"); err != nil {
+			t.Errorf("ReadFile with a bearer token: %v", err)
+		}
+
+		anonymous, _ := NewHTTPIndexFS(&HTTPConfig{URL: server.URL + "/files"})
+		if _, err := anonymous.ReadFile(ctx, "readme.md"); !errors.Is(err, fs.ErrPermission) {
+			t.Errorf("ReadFile without credentials error = %v, want fs.ErrPermission", err)
+		}
+	})
+
+	t.Run("basic", func(t *testing.T) {
+		server := newIndexServer(t, func(r *http.Request) bool {
+			user, password, ok := r.BasicAuth()
+			return ok && user == "alice" && password == "secret"
+		})
+		t.Setenv("FSTEST_USERNAME", "mallory")
+		t.Setenv("FSTEST_PASSWORD", "secret")
+
+		// The configured user wins over <credentials_env>_USERNAME
+		h, err := NewHTTPIndexFS(&HTTPConfig{URL: server.URL + "/files", User: "alice", CredentialsEnv: "FSTEST"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := h.ReadFile(ctx, "readme.md"); err != nil {
+			t.Errorf("ReadFile with basic auth: %v", err)
+		}
+
+		h, _ = NewHTTPIndexFS(&HTTPConfig{URL: server.URL + "/files", CredentialsEnv: "FSTEST"})
+		if _, err := h.ReadFile(ctx, "readme.md"); !errors.Is(err, fs.ErrPermission) {
+			t.Errorf("ReadFile as the wrong user error = %v, want fs.ErrPermission", err)
+		}
+	})
+}
+
+// revalidationServer serves one document whose body and validators the test controls,
+// and counts full and not-modified responses
+type revalidationServer struct {
+	mu           sync.Mutex
+	body         string
+	etag         string
+	lastModified string
+	cacheControl string
+	full         int
+	notModified  int
+	conditional  []string // If-None-Match and If-Modified-Since of each request
+}
+
+func (s *revalidationServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conditional = append(s.conditional, r.Header.Get("If-None-Match")+"|"+r.Header.Get("If-Modified-Since"))
+	if s.cacheControl != "" {
+		w.Header().Set("Cache-Control", s.cacheControl)
+	}
+	if s.etag != "" {
+		w.Header().Set("ETag", s.etag)
+	}
+	if s.lastModified != "" {
+		w.Header().Set("Last-Modified", s.lastModified)
+	}
+	switch {
+	case s.etag != "" && r.Header.Get("If-None-Match") == s.etag,
+		s.etag == "" && s.lastModified != "" && r.Header.Get("If-Modified-Since") == s.lastModified:
+		s.notModified++
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	s.full++
+	fmt.Fprint(w, s.body)
+}
+
+func TestHTTPClientRevalidation(t *testing.T) {
+	ctx := context.Background()
+	get := func(t *testing.T, c *httpClient, target, want string) {
+		t.Helper()
+		resp, err := c.do(ctx, http.MethodGet, target, nil, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.status != http.StatusOK || string(resp.body) != want {
+			t.Fatalf("GET = %d %q, want 200 %q", resp.status, resp.body, want)
+		}
+	}
+	setup := func(t *testing.T, rs *revalidationServer) (*httpClient, string) {
+		t.Helper()
+		server := httptest.NewServer(rs)
+		t.Cleanup(server.Close)
+		c, err := newHTTPClient(&HTTPConfig{URL: server.URL})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c, c.resolve("doc.txt", false)
+	}
+
+	t.Run("etag", func(t *testing.T) {
+		rs := &revalidationServer{body: "v1", etag: `"1"`, cacheControl: "no-cache"}
+		c, target := setup(t, rs)
+		get(t, c, target, "v1")
+		get(t, c, target, "v1") // answered 304 from the cached body
+		rs.mu.Lock()
+		rs.body, rs.etag = "v2", `"2"`
+		rs.mu.Unlock()
+		get(t, c, target, "v2")
+		get(t, c, target, "v2")
+
+		if rs.full != 2 || rs.notModified != 2 {
+			t.Errorf("server sent %d full and %d not-modified responses, want 2 and 2", rs.full, rs.notModified)
+		}
+		if want := []string{"|", `"1"|`, `"1"|`, `"2"|`}; !reflect.DeepEqual(rs.conditional, want) {
+			t.Errorf("conditional headers = %q, want %q", rs.conditional, want)
+		}
+	})
+
+	t.Run("last-modified", func(t *testing.T) {
+		modified := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC).Format(http.TimeFormat)
+		rs := &revalidationServer{body: "dated", lastModified: modified}
+		c, target := setup(t, rs)
+		get(t, c, target, "dated")
+		get(t, c, target, "dated")
+		if rs.full != 1 || rs.notModified != 1 {
+			t.Errorf("server sent %d full and %d not-modified responses, want 1 and 1", rs.full, rs.notModified)
+		}
+		if got := rs.conditional[1]; got != "|"+modified {
+			t.Errorf("second request's conditional headers = %q, want If-Modified-Since %q", got, modified)
+		}
+	})
+
+	t.Run("max-age", func(t *testing.T) {
+		rs := &revalidationServer{body: "fresh", etag: `"f"`, cacheControl: "max-age=60"}
+		c, target := setup(t, rs)
+		get(t, c, target, "fresh")
+		get(t, c, target, "fresh")
+		if len(rs.conditional) != 1 {
+			t.Errorf("server got %d requests, want 1 while the response is fresh", len(rs.conditional))
+		}
+	})
+
+	t.Run("no-store", func(t *testing.T) {
+		rs := &revalidationServer{body: "private", etag: `"p"`, cacheControl: "no-store"}
+		c, target := setup(t, rs)
+		get(t, c, target, "private")
+		get(t, c, target, "private")
+		if rs.full != 2 || rs.conditional[1] != "|" {
+			t.Errorf("server sent %d full responses with conditional headers %q, want 2 unconditional", rs.full, rs.conditional)
+		}
+	})
+
+	t.Run("per credentials", func(t *testing.T) {
+		rs := &revalidationServer{body: "shared", etag: `"s"`, cacheControl: "max-age=60"}
+		c, target := setup(t, rs)
+		get(t, c, target, "shared")
+		other := *c
+		other.token = "someone else"
+		get(t, &other, target, "shared")
+		if len(rs.conditional) != 2 {
+			t.Errorf("server got %d requests, want a separate one for other credentials", len(rs.conditional))
+		}
+	})
+}
+
+func TestHTTPClientResolve(t *testing.T) {
+	c, err := newHTTPClient(&HTTPConfig{URL: "https://example.com/share"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path string
+		dir  bool
+		want string
+	}{
+		{".", true, "https://example.com/share/"},
+		{"a b/c#d.txt", false, "https://example.com/share/a%20b/c%23d.txt"},
+		{filepath.Join("docs", "sub"), true, "https://example.com/share/docs/sub/"},
+		{"50%.txt", false, "https://example.com/share/50%25.txt"},
+	}
+	for _, tt := range tests {
+		if got := c.resolve(tt.path, tt.dir); got != tt.want {
+			t.Errorf("resolve(%q, %v) = %q, want %q", tt.path, tt.dir, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"ftp://example.com/", "not a url", "https://"} {
+		if _, err := newHTTPClient(&HTTPConfig{URL: bad}); err == nil {
+			t.Errorf("newHTTPClient(%q) succeeded", bad)
+		}
+	}
+}
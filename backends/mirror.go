@@ -0,0 +1,453 @@
+package backends
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vimalk78/fs-mcp/policy"
+)
+
+const (
+	// defaultMirrorInterval is how often a mirror is synced with its repository
+	defaultMirrorInterval = 5 * time.Minute
+	// mirrorRetryInterval is how long an unreachable repository is served from its mirror
+	// before connecting is tried again
+	mirrorRetryInterval = 30 * time.Second
+	// mirrorStateFile records the last sync in the mirror directory. Hidden files are never
+	// mirrored or served, so it can't collide with the repository's own files.
+	mirrorStateFile = ".fs-mcp-mirror.json"
+	// mirrorTempPrefix names files being downloaded
+	mirrorTempPrefix = ".fs-mcp-download-"
+)
+
+// MirrorConfig is an ssh repository's "mirror" setting: a local copy that is kept in sync
+// in the background and served while the host is unreachable
+type MirrorConfig struct {
+	Dir      string   `json:"dir"`      // Local directory (default ~/.cache/fs-mcp/mirrors/<repository>)
+	Interval int      `json:"interval"` // Seconds between syncs (default 300)
+	Exclude  []string `json:"exclude"`  // Glob patterns of paths or names not to mirror, besides hidden files and node_modules
+}
+
+// decodeMirrorConfig defaults and validates a repository's mirror setting
+func decodeMirrorConfig(repo *Repository, cfg *MirrorConfig) error {
+	if cfg.Interval < 0 {
+		return fmt.Errorf("repository %s: mirror interval must not be negative", repo.Name)
+	}
+	for _, pattern := range cfg.Exclude {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("repository %s: invalid mirror exclude pattern %q", repo.Name, pattern)
+		}
+	}
+	switch {
+	case cfg.Dir == "":
+		cacheDir, err := os.UserCacheDir()
+		if err != nil {
+			return fmt.Errorf("repository %s: mirror requires 'dir': %w", repo.Name, err)
+		}
+		cfg.Dir = filepath.Join(cacheDir, "fs-mcp", "mirrors", url.PathEscape(repo.Name))
+	case strings.HasPrefix(cfg.Dir, "~"):
+		if homeDir, err := os.UserHomeDir(); err == nil {
+			cfg.Dir = filepath.Join(homeDir, cfg.Dir[1:])
+		}
+	}
+	return nil
+}
+
+// MirrorFS serves a repository from its mirror while the repository is unreachable
+type MirrorFS struct {
+	*LocalFS
+	repo   *Repository
+	synced time.Time
+}
+
+func (m *MirrorFS) Type() string {
+	return m.repo.Type
+}
+
+func (m *MirrorFS) Info() map[string]string {
+	cfg := m.repo.Config.(*SSHConfig)
+	return map[string]string{
+		"type":      m.repo.Type,
+		"host":      cfg.Host,
+		"user":      cfg.User,
+		"path":      m.repo.Path,
+		"mirror":    m.BasePath(),
+		"offline":   "true",
+		"last_sync": m.synced.Format(time.RFC3339),
+	}
+}
+
+// Stale reports whether fs serves an offline mirror of its repository rather than the
+// repository itself, and when the mirror was last synced
+func Stale(fs FileSystem) (time.Time, bool) {
+	if m, ok := unwrap(fs).(*MirrorFS); ok {
+		return m.synced, true
+	}
+	return time.Time{}, false
+}
+
+// mirror keeps one repository's local copy in sync and decides when to serve it
+type mirror struct {
+	repo *Repository
+	cfg  *MirrorConfig
+	ssh  *SSHPool
+	key  string
+	stop context.CancelFunc
+	done chan struct{}
+
+	mu           sync.Mutex
+	synced       time.Time // last completed sync; zero until the mirror has content
+	offlineUntil time.Time // serve the mirror without trying to connect until then
+}
+
+// open returns the repository, or its mirror if the host can't be reached and the mirror
+// has been synced at least once
+func (m *mirror) open(ctx context.Context) (FileSystem, error) {
+	m.mu.Lock()
+	offline := time.Now().Before(m.offlineUntil)
+	m.mu.Unlock()
+	if offline {
+		if local := m.local(); local != nil {
+			return local, nil
+		}
+	}
+
+	remote, err := m.ssh.GetRemoteFS(ctx, m.repo)
+	if err == nil {
+		return remote, nil
+	}
+	if ctx.Err() == context.Canceled {
+		return nil, err
+	}
+	m.offline()
+	local := m.local()
+	if local == nil {
+		return nil, err
+	}
+	log.Printf("Repository %s is unreachable, serving its mirror synced %s: %v", m.repo.Name, local.synced.Format(time.RFC3339), err)
+	return local, nil
+}
+
+// serving reports whether open returns the mirror without trying the host
+func (m *mirror) serving() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return time.Now().Before(m.offlineUntil) && !m.synced.IsZero()
+}
+
+// local returns the mirror as a FileSystem, or nil if it was never synced
+func (m *mirror) local() *MirrorFS {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.synced.IsZero() {
+		return nil
+	}
+	return &MirrorFS{LocalFS: NewLocalFS(m.cfg.Dir), repo: m.repo, synced: m.synced}
+}
+
+// offline marks the repository unreachable for mirrorRetryInterval
+func (m *mirror) offline() {
+	m.mu.Lock()
+	m.offlineUntil = time.Now().Add(mirrorRetryInterval)
+	m.mu.Unlock()
+}
+
+// run syncs the mirror now and then every interval until ctx is done
+func (m *mirror) run(ctx context.Context) {
+	defer close(m.done)
+	m.loadState()
+
+	interval := defaultMirrorInterval
+	if m.cfg.Interval > 0 {
+		interval = time.Duration(m.cfg.Interval) * time.Second
+	}
+	for {
+		start := time.Now()
+		copied, removed, err := m.sync(ctx)
+		switch {
+		case ctx.Err() != nil:
+			return
+		case err != nil:
+			log.Printf("Failed to sync mirror of %s: %v", m.repo.Name, err)
+		case copied > 0 || removed > 0:
+			log.Printf("Synced mirror of %s: %d files copied, %d removed in %s", m.repo.Name, copied, removed, time.Since(start).Round(time.Millisecond))
+		}
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// mirrorState is the content of mirrorStateFile
+type mirrorState struct {
+	LastSync time.Time `json:"last_sync"`
+}
+
+// loadState picks up the last sync of a mirror left by an earlier run
+func (m *mirror) loadState() {
+	data, err := os.ReadFile(filepath.Join(m.cfg.Dir, mirrorStateFile))
+	if err != nil {
+		return
+	}
+	var state mirrorState
+	if json.Unmarshal(data, &state) == nil {
+		m.mu.Lock()
+		m.synced = state.LastSync
+		m.mu.Unlock()
+	}
+}
+
+// excluded reports whether a path, relative to the repository root, is not mirrored
+func (m *mirror) excluded(rel string) bool {
+	if policy.ShouldSkip(rel) {
+		return true
+	}
+	for _, pattern := range m.cfg.Exclude {
+		if ok, _ := path.Match(pattern, rel); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, path.Base(rel)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// sync brings the mirror up to date: files whose size or modification time differ are
+// downloaded, and files no longer in the repository are removed. If part of the
+// repository can't be read, nothing is removed, so an error never empties the mirror.
+func (m *mirror) sync(ctx context.Context) (copied, removed int, err error) {
+	remote, err := m.ssh.GetRemoteFS(ctx, m.repo)
+	if err != nil {
+		m.offline()
+		return 0, 0, err
+	}
+	m.mu.Lock()
+	m.offlineUntil = time.Time{}
+	m.mu.Unlock()
+
+	if err := os.MkdirAll(m.cfg.Dir, 0700); err != nil {
+		return 0, 0, err
+	}
+
+	seen := map[string]bool{".": true}
+	complete := true
+	basePath := strings.ReplaceAll(filepath.Join(remote.BasePath(), "."), "\\", "/")
+	err = remote.Walk(ctx, ".", func(p string, info fs.FileInfo, err error) error {
+		rel := strings.TrimPrefix(strings.TrimPrefix(p, basePath), "/")
+		if rel == "" {
+			rel = "."
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if rel == "." {
+				return err
+			}
+			log.Printf("Mirror of %s: %s: %v", m.repo.Name, rel, err)
+			complete = false
+			return nil
+		}
+		if rel == "." {
+			return nil
+		}
+		if m.excluded(rel) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		seen[rel] = true
+
+		local := filepath.Join(m.cfg.Dir, filepath.FromSlash(rel))
+		if info.IsDir() {
+			if err := replaceConflicting(local, true); err != nil {
+				log.Printf("Mirror of %s: %v", m.repo.Name, err)
+				complete = false
+				return filepath.SkipDir
+			}
+			if err := os.MkdirAll(local, 0700); err != nil {
+				log.Printf("Mirror of %s: %v", m.repo.Name, err)
+				complete = false
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		if have, err := os.Lstat(local); err == nil && have.Mode().IsRegular() &&
+			have.Size() == info.Size() && have.ModTime().Equal(info.ModTime()) {
+			return nil
+		}
+		if err := replaceConflicting(local, false); err != nil {
+			log.Printf("Mirror of %s: %v", m.repo.Name, err)
+			complete = false
+			return nil
+		}
+		if err := download(ctx, remote, rel, local, info.ModTime()); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			log.Printf("Mirror of %s: failed to copy %s: %v", m.repo.Name, rel, err)
+			complete = false
+			return nil
+		}
+		copied++
+		return nil
+	})
+	if err != nil {
+		return copied, 0, err
+	}
+
+	if complete {
+		removed = m.prune(seen)
+	}
+	now := time.Now()
+	m.mu.Lock()
+	m.synced = now
+	m.mu.Unlock()
+	state, _ := json.Marshal(mirrorState{LastSync: now})
+	if err := os.WriteFile(filepath.Join(m.cfg.Dir, mirrorStateFile), state, 0600); err != nil {
+		log.Printf("Mirror of %s: failed to record sync: %v", m.repo.Name, err)
+	}
+	return copied, removed, nil
+}
+
+// replaceConflicting removes what the mirror has at local if it is a file where the
+// repository now has a directory, or the other way round
+func replaceConflicting(local string, dir bool) error {
+	have, err := os.Lstat(local)
+	if err != nil {
+		return nil
+	}
+	if dir && have.IsDir() || !dir && have.Mode().IsRegular() {
+		return nil
+	}
+	return os.RemoveAll(local)
+}
+
+// download copies a remote file into the mirror, replacing the old copy only once the new
+// one is complete
+func download(ctx context.Context, remote *RemoteFS, rel, local string, modTime time.Time) error {
+	rc, err := remote.Open(ctx, rel)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	// Closing the handle fails a read in progress when ctx is cancelled
+	stop := context.AfterFunc(ctx, func() { rc.Close() })
+	defer stop()
+
+	tmp, err := os.CreateTemp(filepath.Dir(local), mirrorTempPrefix)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(tmp, rc)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chtimes(tmp.Name(), modTime, modTime)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), local)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// prune removes everything from the mirror that the last sync didn't see, along with
+// downloads left over from an interrupted sync
+func (m *mirror) prune(seen map[string]bool) int {
+	removed := 0
+	filepath.Walk(m.cfg.Dir, func(p string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		rel, _ := filepath.Rel(m.cfg.Dir, p)
+		rel = filepath.ToSlash(rel)
+		if rel == "." || rel == mirrorStateFile {
+			return nil
+		}
+		if strings.HasPrefix(path.Base(rel), mirrorTempPrefix) || !seen[rel] {
+			if os.RemoveAll(p) == nil && !info.IsDir() {
+				removed++
+			}
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+		}
+		return nil
+	})
+	return removed
+}
+
+// mirrorPool runs the mirrors of all repositories that have one
+type mirrorPool struct {
+	mu      sync.Mutex
+	mirrors map[string]*mirror // by repository name
+}
+
+// get returns the mirror of a repository, or nil if it has none
+func (p *mirrorPool) get(repo *Repository) *mirror {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	m, ok := p.mirrors[repo.Name]
+	if !ok || m.key != repo.Key() {
+		return nil
+	}
+	return m
+}
+
+// sync starts mirrors of newly configured repositories and stops those of repositories
+// that are gone or have changed
+func (p *mirrorPool) sync(repositories map[string]*Repository, ssh *SSHPool) {
+	p.mu.Lock()
+	var stopped []*mirror
+	for name, m := range p.mirrors {
+		if repo, ok := repositories[name]; !ok || repo.Key() != m.key {
+			m.stop()
+			stopped = append(stopped, m)
+			delete(p.mirrors, name)
+		}
+	}
+	for name, repo := range repositories {
+		cfg, ok := repo.Config.(*SSHConfig)
+		if !ok || cfg.Mirror == nil {
+			continue
+		}
+		if _, running := p.mirrors[name]; running {
+			continue
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		m := &mirror{repo: repo, cfg: cfg.Mirror, ssh: ssh, key: repo.Key(), stop: cancel, done: make(chan struct{})}
+		p.mirrors[name] = m
+		go m.run(ctx)
+	}
+	p.mu.Unlock()
+
+	// Wait outside the lock, so that repositories can be opened meanwhile
+	for _, m := range stopped {
+		<-m.done
+	}
+}
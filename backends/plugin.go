@@ -0,0 +1,484 @@
+package backends
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Out-of-process backends serve the repository types declared in the config's "backends"
+// section (see ParseRepository). A backend's command is started once per repository and spoken to in JSON-RPC
+// 2.0 over its stdin and stdout, one message per line; its stderr goes to the server log.
+//
+// Methods take repository-relative, slash-separated paths ("." is the root):
+//
+//	initialize {"repository", "path", "config"} -> {"info": {...}} (optional extra list_repos fields)
+//	stat       {"path"}                         -> fileInfo, following symlinks
+//	read_dir   {"path"}                         -> {"entries": [fileInfo, ...]}
+//	read_file  {"path"}                         -> {"content": "<base64>"}
+//	readlink   {"path"}                         -> {"target": "..."}
+//
+// A fileInfo is {"name", "size", "type": "file"|"dir"|"symlink", "mode": permission bits,
+// "mod_time": RFC 3339}. Errors with code -32001 mean the path doesn't exist and -32002
+// that access is denied.
+
+const (
+	// pluginTimeout bounds a single call to an out-of-process backend
+	pluginTimeout = 30 * time.Second
+
+	pluginErrNotExist   = -32001
+	pluginErrPermission = -32002
+)
+
+// PluginBackendConfig declares an out-of-process backend in the config
+type PluginBackendConfig struct {
+	Command []string          `json:"command"`
+	Env     map[string]string `json:"env"` // Added to the server's environment
+}
+
+// PluginConfig holds the settings of a repository served by an out-of-process backend.
+// Everything in the repository's config is passed on to the backend as-is.
+type PluginConfig struct {
+	Command []string          `json:"command"`
+	Env     map[string]string `json:"env"`
+	Options json.RawMessage   `json:"options"`
+}
+
+func newPluginBackend(def PluginBackendConfig) *Backend {
+	return &Backend{
+		Decode: func(repo *Repository, raw json.RawMessage) (interface{}, error) {
+			return &PluginConfig{Command: def.Command, Env: def.Env, Options: raw}, nil
+		},
+		Open: func(ctx context.Context, repo *Repository, pool *Pool) (FileSystem, error) {
+			proc, err := pool.plugins.get(ctx, repo)
+			if err != nil {
+				return nil, err
+			}
+			return &PluginFS{proc: proc, repo: repo, basePath: path.Join("/", filepath.ToSlash(repo.Path))}, nil
+		},
+		Ready: func(repo *Repository, pool *Pool) bool {
+			return pool.plugins.running(repo)
+		},
+		Cached: true,
+	}
+}
+
+// pluginError is an error returned by a backend
+type pluginError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *pluginError) Error() string {
+	return e.Message
+}
+
+// Unwrap lets errors.Is recognize the error codes for missing and forbidden paths
+func (e *pluginError) Unwrap() error {
+	switch e.Code {
+	case pluginErrNotExist:
+		return fs.ErrNotExist
+	case pluginErrPermission:
+		return fs.ErrPermission
+	}
+	return nil
+}
+
+type pluginRequest struct {
+	JSONRPC string      `json:"jsonrpc"`
+	ID      int64       `json:"id"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+}
+
+type pluginResponse struct {
+	ID     int64           `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *pluginError    `json:"error"`
+}
+
+// pluginProcess is a running backend serving one repository
+type pluginProcess struct {
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	info  map[string]string
+
+	writeMu sync.Mutex
+	mu      sync.Mutex
+	nextID  int64
+	pending map[int64]chan *pluginResponse
+
+	done chan struct{} // closed when the backend exits
+	err  error         // why it exited, set before done is closed
+}
+
+// startPlugin starts a repository's backend and initializes it
+func startPlugin(ctx context.Context, repo *Repository) (*pluginProcess, error) {
+	cfg := repo.Config.(*PluginConfig)
+	cmd := exec.Command(cfg.Command[0], cfg.Command[1:]...)
+	cmd.Env = os.Environ()
+	for key, value := range cfg.Env {
+		cmd.Env = append(cmd.Env, key+"="+value)
+	}
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start backend for %s: %w", repo.Name, err)
+	}
+
+	p := &pluginProcess{
+		cmd:     cmd,
+		stdin:   stdin,
+		pending: make(map[int64]chan *pluginResponse),
+		done:    make(chan struct{}),
+	}
+	go p.read(stdout)
+
+	var init struct {
+		Info map[string]string `json:"info"`
+	}
+	params := map[string]interface{}{
+		"repository": repo.Name,
+		"path":       repo.Path,
+		"config":     cfg.Options,
+	}
+	if err := p.call(ctx, "initialize", params, &init); err != nil {
+		p.close()
+		return nil, fmt.Errorf("backend for %s failed to initialize: %w", repo.Name, err)
+	}
+	p.info = init.Info
+	log.Printf("Started backend %s for %s", strings.Join(cfg.Command, " "), repo.Name)
+	return p, nil
+}
+
+// read delivers responses to their callers until the backend closes its output
+func (p *pluginProcess) read(stdout io.Reader) {
+	r := bufio.NewReader(stdout)
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(strings.TrimSpace(string(line))) > 0 {
+			var resp pluginResponse
+			if jsonErr := json.Unmarshal(line, &resp); jsonErr != nil {
+				log.Printf("Ignoring invalid message from backend: %v", jsonErr)
+			} else {
+				p.mu.Lock()
+				ch, ok := p.pending[resp.ID]
+				delete(p.pending, resp.ID)
+				p.mu.Unlock()
+				if ok {
+					ch <- &resp
+				}
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	if err := p.cmd.Wait(); err != nil {
+		p.err = fmt.Errorf("backend exited: %w", err)
+	} else {
+		p.err = errors.New("backend exited")
+	}
+	close(p.done)
+}
+
+// call sends a request and decodes its result into result. If ctx is cancelled first, the
+// backend's eventual answer is dropped.
+func (p *pluginProcess) call(ctx context.Context, method string, params, result interface{}) error {
+	p.mu.Lock()
+	p.nextID++
+	id := p.nextID
+	ch := make(chan *pluginResponse, 1)
+	p.pending[id] = ch
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		delete(p.pending, id)
+		p.mu.Unlock()
+	}()
+
+	line, err := json.Marshal(pluginRequest{JSONRPC: "2.0", ID: id, Method: method, Params: params})
+	if err != nil {
+		return err
+	}
+	p.writeMu.Lock()
+	_, err = p.stdin.Write(append(line, '\n'))
+	p.writeMu.Unlock()
+	if err != nil {
+		if p.exited() {
+			return p.err
+		}
+		return fmt.Errorf("failed to write to backend: %w", err)
+	}
+
+	timer := time.NewTimer(pluginTimeout)
+	defer timer.Stop()
+	select {
+	case resp := <-ch:
+		if resp.Error != nil {
+			return resp.Error
+		}
+		if result == nil {
+			return nil
+		}
+		if err := json.Unmarshal(resp.Result, result); err != nil {
+			return fmt.Errorf("invalid %s result from backend: %w", method, err)
+		}
+		return nil
+	case <-p.done:
+		return p.err
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return fmt.Errorf("backend did not answer %s within %s", method, pluginTimeout)
+	}
+}
+
+func (p *pluginProcess) exited() bool {
+	select {
+	case <-p.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// close asks the backend to exit by closing its input, and kills it if it doesn't
+func (p *pluginProcess) close() {
+	p.stdin.Close()
+	go func() {
+		select {
+		case <-p.done:
+		case <-time.After(5 * time.Second):
+			p.cmd.Process.Kill()
+		}
+	}()
+}
+
+// pluginPool keeps one running backend per repository, restarting it if it exits
+type pluginPool struct {
+	mu    sync.Mutex
+	slots map[string]*pluginSlot
+}
+
+// pluginSlot holds the backend of one repository configuration. Its lock is held while
+// the backend starts, so a slow start only holds up calls to that repository.
+type pluginSlot struct {
+	key     string // Repository.Key of the repository
+	mu      sync.Mutex
+	proc    *pluginProcess
+	removed bool // the repository was removed or changed
+}
+
+// remove stops the slot's backend. It waits for a start in progress, so it is run in the
+// background rather than hold up a reload.
+func (s *pluginSlot) remove() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.removed = true
+	if s.proc != nil {
+		s.proc.close()
+		s.proc = nil
+	}
+}
+
+// get returns the running backend of a repository, starting it if needed
+func (p *pluginPool) get(ctx context.Context, repo *Repository) (*pluginProcess, error) {
+	key := repo.Key()
+	p.mu.Lock()
+	slot, ok := p.slots[repo.Name]
+	if !ok || slot.key != key {
+		if ok {
+			go slot.remove()
+		}
+		slot = &pluginSlot{key: key}
+		p.slots[repo.Name] = slot
+	}
+	p.mu.Unlock()
+
+	slot.mu.Lock()
+	defer slot.mu.Unlock()
+	if slot.removed {
+		return nil, fmt.Errorf("repository %s was reconfigured; try again", repo.Name)
+	}
+	if proc := slot.proc; proc != nil {
+		if !proc.exited() {
+			return proc, nil
+		}
+		log.Printf("Backend for %s stopped (%v), restarting...", repo.Name, proc.err)
+		proc.close()
+		slot.proc = nil
+	}
+
+	proc, err := startPlugin(ctx, repo)
+	if err != nil {
+		return nil, err
+	}
+	slot.proc = proc
+	return proc, nil
+}
+
+// running reports whether a repository's backend is up, and not being started
+func (p *pluginPool) running(repo *Repository) bool {
+	p.mu.Lock()
+	slot, ok := p.slots[repo.Name]
+	p.mu.Unlock()
+	if !ok || slot.key != repo.Key() || !slot.mu.TryLock() {
+		return false
+	}
+	defer slot.mu.Unlock()
+	return slot.proc != nil && !slot.proc.exited()
+}
+
+// sync stops the backends of repositories that were removed or changed
+func (p *pluginPool) sync(repositories map[string]*Repository) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for name, slot := range p.slots {
+		if repo, ok := repositories[name]; !ok || repo.Key() != slot.key {
+			delete(p.slots, name)
+			go slot.remove()
+		}
+	}
+}
+
+// pluginFileInfo is a file's metadata as a backend sends it
+type pluginFileInfo struct {
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	Type    string    `json:"type"`
+	Mode    uint32    `json:"mode"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+func (i *pluginFileInfo) fileInfo() fs.FileInfo {
+	mode := fs.FileMode(i.Mode) & fs.ModePerm
+	switch i.Type {
+	case "dir":
+		mode |= fs.ModeDir
+	case "symlink":
+		mode |= fs.ModeSymlink
+	}
+	return &execFileInfo{name: i.Name, size: i.Size, mode: mode, modTime: i.ModTime}
+}
+
+// PluginFS implements FileSystem by calling an out-of-process backend
+type PluginFS struct {
+	proc     *pluginProcess
+	repo     *Repository
+	basePath string
+}
+
+func (p *PluginFS) call(ctx context.Context, op, method, rel string, result interface{}) error {
+	params := map[string]string{"path": path.Clean(filepath.ToSlash(rel))}
+	if err := p.proc.call(ctx, method, params, result); err != nil {
+		return &fs.PathError{Op: op, Path: rel, Err: err}
+	}
+	return nil
+}
+
+func (p *PluginFS) ReadFile(ctx context.Context, rel string) ([]byte, error) {
+	var result struct {
+		Content []byte `json:"content"`
+	}
+	if err := p.call(ctx, "open", "read_file", rel, &result); err != nil {
+		return nil, err
+	}
+	return result.Content, nil
+}
+
+func (p *PluginFS) ReadDir(ctx context.Context, rel string) ([]fs.DirEntry, error) {
+	var result struct {
+		Entries []pluginFileInfo `json:"entries"`
+	}
+	if err := p.call(ctx, "readdir", "read_dir", rel, &result); err != nil {
+		return nil, err
+	}
+	entries := make([]fs.DirEntry, 0, len(result.Entries))
+	for i := range result.Entries {
+		entries = append(entries, fs.FileInfoToDirEntry(result.Entries[i].fileInfo()))
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+func (p *PluginFS) Stat(ctx context.Context, rel string) (fs.FileInfo, error) {
+	var result pluginFileInfo
+	if err := p.call(ctx, "stat", "stat", rel, &result); err != nil {
+		return nil, err
+	}
+	if result.Name == "" {
+		result.Name = path.Base(path.Join(p.basePath, filepath.ToSlash(rel)))
+	}
+	return result.fileInfo(), nil
+}
+
+func (p *PluginFS) Readlink(ctx context.Context, rel string) (string, error) {
+	var result struct {
+		Target string `json:"target"`
+	}
+	if err := p.call(ctx, "readlink", "readlink", rel, &result); err != nil {
+		return "", err
+	}
+	return result.Target, nil
+}
+
+// Walk lists one directory per call, as it's entered
+func (p *PluginFS) Walk(ctx context.Context, root string, fn filepath.WalkFunc) error {
+	fullPath := path.Join(p.basePath, filepath.ToSlash(root))
+	info, err := p.Stat(ctx, root)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		return fn(fullPath, nil, err)
+	}
+	err = walkReadDir(ctx, fullPath, path.Clean(filepath.ToSlash(root)), info, p.ReadDir, fn)
+	if err == filepath.SkipDir || err == filepath.SkipAll {
+		return nil
+	}
+	return err
+}
+
+func (p *PluginFS) BasePath() string {
+	return p.basePath
+}
+
+func (p *PluginFS) Type() string {
+	return p.repo.Type
+}
+
+func (p *PluginFS) Info() map[string]string {
+	info := map[string]string{
+		"type":    p.repo.Type,
+		"path":    p.repo.Path,
+		"backend": strings.Join(p.repo.Config.(*PluginConfig).Command, " "),
+	}
+	for key, value := range p.proc.info {
+		if _, ok := info[key]; !ok {
+			info[key] = value
+		}
+	}
+	return info
+}
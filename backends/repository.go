@@ -0,0 +1,184 @@
+package backends
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Repository represents a configured repository. Type-specific settings are decoded by
+// the repository's backend into Config.
+type Repository struct {
+	Name           string       `json:"-"`
+	Type           string       `json:"type"`             // Backend name: "local", "ssh", "archive", ... or one from "backends"
+	Path           string       `json:"path"`             // Root of the repository: local path, remote path, archive file, ...
+	MaxResults     int          `json:"max_results"`      // Page size for listing and search tools (overrides server default)
+	Index          bool         `json:"index"`            // Maintain a trigram index for content search
+	IndexRefresh   int          `json:"index_refresh"`    // Seconds between index re-scans when fsnotify is unavailable (default 300)
+	Timeout        int          `json:"timeout"`          // Seconds a single operation (connect, read, walk) may take (default: no limit)
+	Cache          *CacheConfig `json:"cache"`            // Read-through cache of listings and file contents
+	AuditHashPaths bool         `json:"audit_hash_paths"` // Record hashes instead of paths in the audit log
+	Config         interface{}  `json:"-"`                // Type-specific settings, e.g. *SSHConfig
+
+	backend *Backend
+}
+
+// FileSystem interface abstracts local and remote file operations. Operations stop early
+// with the context's error when it is cancelled; a Walk stops between entries.
+type FileSystem interface {
+	ReadFile(ctx context.Context, path string) ([]byte, error)
+	ReadDir(ctx context.Context, path string) ([]fs.DirEntry, error)
+	Stat(ctx context.Context, path string) (fs.FileInfo, error)
+	Readlink(ctx context.Context, path string) (string, error)
+	Walk(ctx context.Context, root string, fn filepath.WalkFunc) error
+	BasePath() string
+	Type() string
+	Info() map[string]string
+}
+
+// LocalFS implements FileSystem for local repositories
+type LocalFS struct {
+	basePath string
+}
+
+func NewLocalFS(basePath string) *LocalFS {
+	return &LocalFS{basePath: basePath}
+}
+
+func (l *LocalFS) ReadFile(ctx context.Context, path string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	fullPath := filepath.Join(l.basePath, path)
+	return os.ReadFile(fullPath)
+}
+
+func (l *LocalFS) ReadDir(ctx context.Context, path string) ([]fs.DirEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	fullPath := filepath.Join(l.basePath, path)
+	return os.ReadDir(fullPath)
+}
+
+func (l *LocalFS) Stat(ctx context.Context, path string) (fs.FileInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	fullPath := filepath.Join(l.basePath, path)
+	return os.Stat(fullPath)
+}
+
+func (l *LocalFS) Readlink(ctx context.Context, path string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	fullPath := filepath.Join(l.basePath, path)
+	return os.Readlink(fullPath)
+}
+
+func (l *LocalFS) Walk(ctx context.Context, root string, fn filepath.WalkFunc) error {
+	fullPath := filepath.Join(l.basePath, root)
+	return filepath.Walk(fullPath, func(path string, info fs.FileInfo, err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		return fn(path, info, err)
+	})
+}
+
+func (l *LocalFS) BasePath() string {
+	return l.basePath
+}
+
+func (l *LocalFS) Type() string {
+	return "local"
+}
+
+func (l *LocalFS) Info() map[string]string {
+	return map[string]string{
+		"type": "local",
+		"path": l.basePath,
+	}
+}
+
+func init() {
+	RegisterBackend("local", &Backend{
+		Decode: func(repo *Repository, raw json.RawMessage) (interface{}, error) {
+			return nil, nil
+		},
+		Open: func(ctx context.Context, repo *Repository, pool *Pool) (FileSystem, error) {
+			return NewLocalFS(repo.Path), nil
+		},
+	})
+}
+
+// ParseRepository parses a repository config value which can be either:
+// - a string (legacy local path)
+// - an object with type, path and the settings of its type
+//
+// Types not registered with RegisterBackend may be declared in plugins, to be served by
+// out-of-process backends.
+func ParseRepository(name string, raw json.RawMessage, plugins map[string]PluginBackendConfig) (*Repository, error) {
+	repo := Repository{Name: name}
+
+	// Try to parse as string first (legacy format)
+	var pathStr string
+	if err := json.Unmarshal(raw, &pathStr); err == nil {
+		repo.Type = "local"
+		repo.Path = pathStr
+		raw = nil
+	} else if err := json.Unmarshal(raw, &repo); err != nil {
+		return nil, fmt.Errorf("failed to parse repository %s: %w", name, err)
+	}
+
+	// Set defaults
+	if repo.Type == "" {
+		repo.Type = "local"
+	}
+	if repo.Timeout < 0 {
+		return nil, fmt.Errorf("repository %s: timeout must not be negative", name)
+	}
+	if err := repo.Cache.validate(name); err != nil {
+		return nil, err
+	}
+
+	backend, ok := LookupBackend(repo.Type)
+	if def, isPlugin := plugins[repo.Type]; !ok && isPlugin {
+		backend, ok = newPluginBackend(def), true
+	}
+	if !ok {
+		types := BackendNames()
+		for pluginType := range plugins {
+			types = append(types, pluginType)
+		}
+		return nil, fmt.Errorf("repository %s: unknown type %s (available: %s)", name, repo.Type, strings.Join(types, ", "))
+	}
+	config, err := backend.Decode(&repo, raw)
+	if err != nil {
+		return nil, err
+	}
+	repo.Config = config
+	repo.backend = backend
+
+	return &repo, nil
+}
+
+// Location describes where the repository lives without opening it
+func (r *Repository) Location() string {
+	if r.backend.Location != nil {
+		return r.backend.Location(r)
+	}
+	return r.Path
+}
+
+// Key identifies a repository's type, path and settings, for caches that must be dropped
+// when any of them change
+func (r *Repository) Key() string {
+	config, _ := json.Marshal(r.Config)
+	return fmt.Sprintf("%s:%s:%s", r.Type, r.Path, config)
+}
@@ -0,0 +1,637 @@
+package backends
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// s3ChunkSize is the size of each ranged GET when reading an object
+	s3ChunkSize = 8 << 20
+	// s3Concurrency bounds the ranged GETs in flight for one object
+	s3Concurrency = 4
+	// s3Timeout bounds a single S3 request
+	s3Timeout = 30 * time.Second
+	// emptySHA256 is the hex SHA-256 of an empty request body
+	emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+var s3Client = &http.Client{Timeout: s3Timeout}
+
+// s3Credentials are the keys requests are signed with. Without an access key, requests
+// are sent unsigned, which works for public buckets.
+type s3Credentials struct {
+	accessKey    string
+	secretKey    string
+	sessionToken string
+}
+
+// firstEnv returns the value of the first set environment variable
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// s3Info implements fs.FileInfo for an object or a virtual directory
+type s3Info struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+func (i *s3Info) Name() string       { return i.name }
+func (i *s3Info) Size() int64        { return i.size }
+func (i *s3Info) ModTime() time.Time { return i.modTime }
+func (i *s3Info) IsDir() bool        { return i.dir }
+func (i *s3Info) Sys() interface{}   { return nil }
+func (i *s3Info) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+// S3FS implements FileSystem over a bucket of an S3-compatible object store. Keys below
+// the repository's prefix are files; directories are implied by "/" in key names.
+type S3FS struct {
+	endpoint  *url.URL
+	bucket    string
+	prefix    string // "" or ending in "/"
+	region    string
+	pathStyle bool
+	creds     s3Credentials
+}
+
+// S3Config holds the settings of an s3 repository; its path is the key prefix
+type S3Config struct {
+	Bucket         string `json:"bucket"`
+	Endpoint       string `json:"endpoint"`        // S3-compatible endpoint URL (default AWS_ENDPOINT_URL or AWS)
+	Region         string `json:"region"`          // default AWS_REGION or us-east-1
+	CredentialsEnv string `json:"credentials_env"` // Prefix of the credential variables, e.g. "MINIO" for MINIO_ACCESS_KEY_ID
+}
+
+func init() {
+	RegisterBackend("s3", &Backend{
+		Decode: func(repo *Repository, raw json.RawMessage) (interface{}, error) {
+			var cfg S3Config
+			if err := decodeConfig(repo, raw, &cfg); err != nil {
+				return nil, err
+			}
+			if cfg.Bucket == "" {
+				return nil, fmt.Errorf("repository %s: s3 repo requires 'bucket'", repo.Name)
+			}
+			return &cfg, nil
+		},
+		Open: func(ctx context.Context, repo *Repository, pool *Pool) (FileSystem, error) {
+			return NewS3FS(repo.Path, repo.Config.(*S3Config))
+		},
+		Location: func(repo *Repository) string {
+			return fmt.Sprintf("s3://%s/%s", repo.Config.(*S3Config).Bucket, strings.Trim(repo.Path, "/"))
+		},
+		ListsTree: true,
+	})
+}
+
+// NewS3FS creates an S3FS for a bucket and key prefix. The endpoint, region and credentials not set
+// in cfg come from the standard AWS environment variables.
+func NewS3FS(prefix string, cfg *S3Config) (*S3FS, error) {
+	region := cfg.Region
+	if region == "" {
+		region = firstEnv("AWS_REGION", "AWS_DEFAULT_REGION")
+	}
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	// AWS endpoints address buckets by host name; custom endpoints (MinIO, Ceph, ...) by path
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = firstEnv("AWS_ENDPOINT_URL_S3", "AWS_ENDPOINT_URL")
+	}
+	pathStyle := endpoint != ""
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", region)
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint: %s", endpoint)
+	}
+
+	accessEnv, secretEnv := "AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY"
+	if cfg.CredentialsEnv != "" {
+		accessEnv, secretEnv = cfg.CredentialsEnv+"_ACCESS_KEY_ID", cfg.CredentialsEnv+"_SECRET_ACCESS_KEY"
+	}
+	creds := s3Credentials{accessKey: os.Getenv(accessEnv), secretKey: os.Getenv(secretEnv)}
+	if cfg.CredentialsEnv == "" {
+		creds.sessionToken = os.Getenv("AWS_SESSION_TOKEN")
+	} else {
+		creds.sessionToken = os.Getenv(cfg.CredentialsEnv + "_SESSION_TOKEN")
+	}
+	if creds.accessKey != "" && creds.secretKey == "" {
+		return nil, fmt.Errorf("%s is set but %s is not", accessEnv, secretEnv)
+	}
+
+	prefix = strings.Trim(prefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	return &S3FS{
+		endpoint:  u,
+		bucket:    cfg.Bucket,
+		prefix:    prefix,
+		region:    region,
+		pathStyle: pathStyle,
+		creds:     creds,
+	}, nil
+}
+
+// s3Escape percent-encodes a string as SigV4 requires, leaving "/" alone when path is set
+func s3Escape(s string, path bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && path:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// objectURL returns the host and escaped path of a key
+func (s *S3FS) objectURL(key string) (string, string) {
+	if s.pathStyle {
+		return s.endpoint.Host, s3Escape(path.Join("/", s.endpoint.Path, s.bucket)+"/"+key, true)
+	}
+	return s.bucket + "." + s.endpoint.Host, s3Escape(path.Join("/", s.endpoint.Path)+"/"+key, true)
+}
+
+// canonicalQuery encodes query parameters sorted by name, as SigV4 signs them
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	params := make([]string, 0, len(keys))
+	for _, key := range keys {
+		params = append(params, s3Escape(key, false)+"="+s3Escape(query.Get(key), false))
+	}
+	return strings.Join(params, "&")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// sign adds AWS Signature Version 4 headers to a request with an empty body
+func (s *S3FS) sign(req *http.Request, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	day := amzDate[:8]
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", emptySHA256)
+	if s.creds.sessionToken != "" {
+		req.Header.Set("x-amz-security-token", s.creds.sessionToken)
+	}
+
+	// Sign the host, the range and every x-amz-* header
+	headers := map[string]string{"host": req.Host}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		if lower == "range" || strings.HasPrefix(lower, "x-amz-") {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", name, headers[name])
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		emptySHA256,
+	}, "\n")
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", day, s.region)
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := fmt.Sprintf("AWS4-HMAC-SHA256\n%s\n%s\n%s", amzDate, scope, hex.EncodeToString(requestHash[:]))
+
+	key := hmacSHA256([]byte("AWS4"+s.creds.secretKey), day)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.creds.accessKey, scope, signedHeaders, signature))
+}
+
+// s3Error is the error document S3 returns
+type s3Error struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// do sends a request for a key (or the bucket, with an empty key and query parameters)
+func (s *S3FS) do(ctx context.Context, method, key string, query url.Values, header http.Header) (*http.Response, error) {
+	host, escapedPath := s.objectURL(key)
+	// Send the path and query escaped exactly as they are signed
+	u := &url.URL{Scheme: s.endpoint.Scheme, Host: host, RawPath: escapedPath, RawQuery: canonicalQuery(query)}
+	u.Path, _ = url.PathUnescape(escapedPath)
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if s.creds.accessKey != "" {
+		s.sign(req, time.Now())
+	}
+	resp, err := s3Client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("S3 request failed: %w", err)
+	}
+	return resp, nil
+}
+
+// responseError turns an unsuccessful response into an error, closing its body
+func responseError(op, p string, resp *http.Response) error {
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return &fs.PathError{Op: op, Path: p, Err: fs.ErrNotExist}
+	}
+	var e s3Error
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if xml.Unmarshal(body, &e) == nil && e.Code != "" {
+		return &fs.PathError{Op: op, Path: p, Err: fmt.Errorf("S3 %s: %s", e.Code, e.Message)}
+	}
+	return &fs.PathError{Op: op, Path: p, Err: fmt.Errorf("S3 request failed: %s", resp.Status)}
+}
+
+// listResult is a ListObjectsV2 response page
+type listResult struct {
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+	Contents              []struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+	CommonPrefixes []struct {
+		Prefix string `xml:"Prefix"`
+	} `xml:"CommonPrefixes"`
+}
+
+// list lists the keys below a prefix, calling page for every response. With delimiter set
+// only one level is listed and deeper keys are rolled up into common prefixes.
+func (s *S3FS) list(ctx context.Context, op, p, prefix string, delimiter bool, maxKeys int, page func(*listResult) bool) error {
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if delimiter {
+			query.Set("delimiter", "/")
+		}
+		if maxKeys > 0 {
+			query.Set("max-keys", strconv.Itoa(maxKeys))
+		}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		resp, err := s.do(ctx, http.MethodGet, "", query, nil)
+		if err != nil {
+			return &fs.PathError{Op: op, Path: p, Err: err}
+		}
+		if resp.StatusCode != http.StatusOK {
+			err := responseError(op, p, resp)
+			if errors.Is(err, fs.ErrNotExist) {
+				return &fs.PathError{Op: op, Path: p, Err: fmt.Errorf("bucket %s not found", s.bucket)}
+			}
+			return err
+		}
+		var result listResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return &fs.PathError{Op: op, Path: p, Err: fmt.Errorf("invalid S3 listing: %w", err)}
+		}
+		if !page(&result) || !result.IsTruncated || result.NextContinuationToken == "" {
+			return nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// objectKey returns the key of a repository-relative path
+func (s *S3FS) objectKey(p string) string {
+	key := path.Clean(filepath.ToSlash(p))
+	if key == "." {
+		return strings.TrimSuffix(s.prefix, "/")
+	}
+	return s.prefix + key
+}
+
+// dirPrefix returns the listing prefix of a repository-relative directory
+func (s *S3FS) dirPrefix(p string) string {
+	if path.Clean(filepath.ToSlash(p)) == "." {
+		return s.prefix
+	}
+	return s.objectKey(p) + "/"
+}
+
+func (s *S3FS) ReadFile(ctx context.Context, p string) ([]byte, error) {
+	key := s.objectKey(p)
+	if path.Clean(filepath.ToSlash(p)) == "." {
+		return nil, &fs.PathError{Op: "read", Path: p, Err: errors.New("is a directory")}
+	}
+
+	first, total, err := s.getRange(ctx, p, key, 0)
+	if err != nil {
+		return nil, err
+	}
+	if total <= int64(len(first)) {
+		return first, nil
+	}
+
+	// Fetch the remaining chunks concurrently
+	data := make([]byte, total)
+	copy(data, first)
+	var wg sync.WaitGroup
+	var errMu sync.Mutex
+	var firstErr error
+	sem := make(chan struct{}, s3Concurrency)
+	for offset := int64(len(first)); offset < total && ctx.Err() == nil; offset += s3ChunkSize {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(offset int64) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			chunk, _, err := s.getRange(ctx, p, key, offset)
+			if err == nil && offset+int64(len(chunk)) > total {
+				err = fmt.Errorf("object changed while reading")
+			}
+			if err != nil {
+				errMu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				errMu.Unlock()
+				return
+			}
+			copy(data[offset:], chunk)
+		}(offset)
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return data, nil
+}
+
+// getRange fetches up to s3ChunkSize bytes of an object from offset, and returns them with
+// the object's total size
+func (s *S3FS) getRange(ctx context.Context, p, key string, offset int64) ([]byte, int64, error) {
+	header := http.Header{"Range": {fmt.Sprintf("bytes=%d-%d", offset, offset+s3ChunkSize-1)}}
+	resp, err := s.do(ctx, http.MethodGet, key, nil, header)
+	if err != nil {
+		return nil, 0, &fs.PathError{Op: "open", Path: p, Err: err}
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		// The server ignored the range and sent the whole object
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		return data, int64(len(data)), err
+	case http.StatusPartialContent:
+		defer resp.Body.Close()
+		// Content-Range: bytes 0-8388607/12345678
+		contentRange := resp.Header.Get("Content-Range")
+		i := strings.LastIndex(contentRange, "/")
+		total, err := strconv.ParseInt(contentRange[i+1:], 10, 64)
+		if i < 0 || err != nil {
+			return nil, 0, &fs.PathError{Op: "open", Path: p, Err: fmt.Errorf("invalid Content-Range: %q", contentRange)}
+		}
+		data, err := io.ReadAll(io.LimitReader(resp.Body, s3ChunkSize))
+		return data, total, err
+	case http.StatusRequestedRangeNotSatisfiable:
+		// Only an empty object has no byte 0
+		resp.Body.Close()
+		if offset == 0 {
+			return []byte{}, 0, nil
+		}
+		return nil, 0, &fs.PathError{Op: "open", Path: p, Err: fmt.Errorf("object changed while reading")}
+	}
+	return nil, 0, responseError("open", p, resp)
+}
+
+func (s *S3FS) ReadDir(ctx context.Context, p string) ([]fs.DirEntry, error) {
+	prefix := s.dirPrefix(p)
+	var entries []fs.DirEntry
+	found := false
+	err := s.list(ctx, "readdir", p, prefix, true, 0, func(result *listResult) bool {
+		for _, cp := range result.CommonPrefixes {
+			found = true
+			name := strings.TrimSuffix(strings.TrimPrefix(cp.Prefix, prefix), "/")
+			if name != "" {
+				entries = append(entries, fs.FileInfoToDirEntry(&s3Info{name: name, dir: true}))
+			}
+		}
+		for _, obj := range result.Contents {
+			found = true
+			name := strings.TrimPrefix(obj.Key, prefix)
+			// "dir/" keys are folder markers created by consoles, not files
+			if name == "" {
+				continue
+			}
+			entries = append(entries, fs.FileInfoToDirEntry(&s3Info{name: name, size: obj.Size, modTime: obj.LastModified}))
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !found && prefix != s.prefix {
+		return nil, &fs.PathError{Op: "readdir", Path: p, Err: fs.ErrNotExist}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+func (s *S3FS) Stat(ctx context.Context, p string) (fs.FileInfo, error) {
+	name := path.Base(path.Join(s.BasePath(), filepath.ToSlash(p)))
+	if path.Clean(filepath.ToSlash(p)) == "." {
+		return &s3Info{name: name, dir: true}, nil
+	}
+
+	resp, err := s.do(ctx, http.MethodHead, s.objectKey(p), nil, nil)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: p, Err: err}
+	}
+	if resp.StatusCode == http.StatusOK {
+		resp.Body.Close()
+		modTime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+		return &s3Info{name: name, size: resp.ContentLength, modTime: modTime}, nil
+	}
+	if err := responseError("stat", p, resp); !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	// Not an object, so a directory if any key lies below it
+	found := false
+	err = s.list(ctx, "stat", p, s.dirPrefix(p), false, 1, func(result *listResult) bool {
+		found = len(result.Contents) > 0
+		return false
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, &fs.PathError{Op: "stat", Path: p, Err: fs.ErrNotExist}
+	}
+	return &s3Info{name: name, dir: true}, nil
+}
+
+func (s *S3FS) Readlink(ctx context.Context, p string) (string, error) {
+	return "", &fs.PathError{Op: "readlink", Path: p, Err: errors.New("object storage has no symbolic links")}
+}
+
+// Walk lists every key below root in one flat listing and walks the implied tree like
+// filepath.Walk
+func (s *S3FS) Walk(ctx context.Context, root string, fn filepath.WalkFunc) error {
+	fullPath := path.Join(s.BasePath(), filepath.ToSlash(root))
+	info, err := s.Stat(ctx, root)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		return fn(fullPath, nil, err)
+	}
+	if !info.IsDir() {
+		return fn(fullPath, info, nil)
+	}
+
+	prefix := s.dirPrefix(root)
+	dirs := map[string][]*s3Info{}
+	seen := map[string]bool{".": true}
+	err = s.list(ctx, "walk", root, prefix, false, 0, func(result *listResult) bool {
+		for _, obj := range result.Contents {
+			rel := strings.TrimPrefix(obj.Key, prefix)
+			if rel == "" || strings.HasSuffix(rel, "/") {
+				rel = strings.TrimSuffix(rel, "/")
+				if rel == "" {
+					continue
+				}
+			} else {
+				dir := path.Dir(rel)
+				dirs[dir] = append(dirs[dir], &s3Info{name: path.Base(rel), size: obj.Size, modTime: obj.LastModified})
+				rel = dir
+			}
+			// Add the directories leading to the key
+			for rel != "." && !seen[rel] {
+				seen[rel] = true
+				parent := path.Dir(rel)
+				dirs[parent] = append(dirs[parent], &s3Info{name: path.Base(rel), dir: true})
+				rel = parent
+			}
+		}
+		return true
+	})
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		return fn(fullPath, info, err)
+	}
+	for _, entries := range dirs {
+		sort.Slice(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+	}
+
+	err = s.walk(ctx, ".", fullPath, info.(*s3Info), dirs, fn)
+	if err == filepath.SkipDir || err == filepath.SkipAll {
+		return nil
+	}
+	return err
+}
+
+func (s *S3FS) walk(ctx context.Context, rel, fullPath string, info *s3Info, dirs map[string][]*s3Info, fn filepath.WalkFunc) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if !info.dir {
+		return fn(fullPath, info, nil)
+	}
+	if err := fn(fullPath, info, nil); err != nil {
+		return err
+	}
+	for _, child := range dirs[rel] {
+		if err := s.walk(ctx, path.Join(rel, child.name), path.Join(fullPath, child.name), child, dirs, fn); err != nil {
+			if !child.dir || err != filepath.SkipDir {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// BasePath is "/bucket/prefix", which keeps paths of different buckets apart
+func (s *S3FS) BasePath() string {
+	return path.Join("/", s.bucket, s.prefix)
+}
+
+func (s *S3FS) Type() string {
+	return "s3"
+}
+
+func (s *S3FS) Info() map[string]string {
+	return map[string]string{
+		"type":     "s3",
+		"endpoint": s.endpoint.String(),
+		"bucket":   s.bucket,
+		"prefix":   s.prefix,
+		"region":   s.region,
+	}
+}
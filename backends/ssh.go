@@ -0,0 +1,455 @@
+package backends
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// SSHConfig holds the settings of an ssh repository
+type SSHConfig struct {
+	Host    string        `json:"host"`
+	Port    int           `json:"port"` // default 22
+	User    string        `json:"user"`
+	KeyFile string        `json:"key"`    // default ~/.ssh/id_rsa
+	Mirror  *MirrorConfig `json:"mirror"` // Local copy served while the host is unreachable
+}
+
+func init() {
+	RegisterBackend("ssh", &Backend{
+		Decode: decodeSSHConfig,
+		Open: func(ctx context.Context, repo *Repository, pool *Pool) (FileSystem, error) {
+			if m := pool.mirrors.get(repo); m != nil {
+				return m.open(ctx)
+			}
+			return pool.ssh.GetRemoteFS(ctx, repo)
+		},
+		Location: func(repo *Repository) string {
+			cfg := repo.Config.(*SSHConfig)
+			return fmt.Sprintf("%s@%s:%s", cfg.User, cfg.Host, repo.Path)
+		},
+		Ready: func(repo *Repository, pool *Pool) bool {
+			if m := pool.mirrors.get(repo); m != nil && m.serving() {
+				return true
+			}
+			return pool.ssh.connected(repo.Config.(*SSHConfig))
+		},
+		Cached: true,
+	})
+}
+
+// decodeSSHConfig parses and validates an ssh repository's settings
+func decodeSSHConfig(repo *Repository, raw json.RawMessage) (interface{}, error) {
+	var cfg SSHConfig
+	if err := decodeConfig(repo, raw, &cfg); err != nil {
+		return nil, err
+	}
+
+	// Set defaults
+	if cfg.Port == 0 {
+		cfg.Port = 22
+	}
+	if cfg.KeyFile == "" {
+		cfg.KeyFile = "~/.ssh/id_rsa"
+	}
+
+	// Expand ~ in key file path
+	if strings.HasPrefix(cfg.KeyFile, "~") {
+		homeDir, err := os.UserHomeDir()
+		if err == nil {
+			cfg.KeyFile = filepath.Join(homeDir, cfg.KeyFile[1:])
+		}
+	}
+
+	if cfg.Host == "" {
+		return nil, fmt.Errorf("repository %s: SSH repo requires 'host'", repo.Name)
+	}
+	if cfg.User == "" {
+		return nil, fmt.Errorf("repository %s: SSH repo requires 'user'", repo.Name)
+	}
+	if repo.Path == "" {
+		return nil, fmt.Errorf("repository %s: SSH repo requires 'path'", repo.Name)
+	}
+	if cfg.Mirror != nil {
+		if err := decodeMirrorConfig(repo, cfg.Mirror); err != nil {
+			return nil, err
+		}
+	}
+	return &cfg, nil
+}
+
+// SSHPool manages SSH connections to remote hosts
+type SSHPool struct {
+	mu    sync.RWMutex
+	conns map[string]*SSHConnection
+}
+
+// SSHConnection holds an SSH client and SFTP client
+type SSHConnection struct {
+	client *ssh.Client
+	sftp   *sftp.Client
+}
+
+// NewSSHPool creates a new SSH connection pool
+func NewSSHPool() *SSHPool {
+	return &SSHPool{
+		conns: make(map[string]*SSHConnection),
+	}
+}
+
+// connectionKey returns a unique key for a repository connection
+func connectionKey(cfg *SSHConfig) string {
+	return fmt.Sprintf("%s@%s:%d", cfg.User, cfg.Host, cfg.Port)
+}
+
+// GetRemoteFS returns a RemoteFS for the given repository
+func (p *SSHPool) GetRemoteFS(ctx context.Context, repo *Repository) (*RemoteFS, error) {
+	cfg := repo.Config.(*SSHConfig)
+	conn, err := p.getConnection(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &RemoteFS{
+		conn:     conn,
+		basePath: repo.Path,
+		config:   cfg,
+	}, nil
+}
+
+// connected reports whether there is a connection to a repository's host
+func (p *SSHPool) connected(cfg *SSHConfig) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	_, ok := p.conns[connectionKey(cfg)]
+	return ok
+}
+
+// getConnection gets or creates an SSH connection for a repository
+func (p *SSHPool) getConnection(ctx context.Context, cfg *SSHConfig) (*SSHConnection, error) {
+	key := connectionKey(cfg)
+
+	// Check if connection exists
+	p.mu.RLock()
+	conn, ok := p.conns[key]
+	p.mu.RUnlock()
+
+	if ok {
+		// Verify connection is still alive
+		_, err := sftpCall(ctx, func() (bool, error) {
+			ok, _, err := conn.client.SendRequest("keepalive@openssh.com", true, nil)
+			return ok, err
+		})
+		if err == nil {
+			return conn, nil
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		// Connection dead, remove it
+		p.mu.Lock()
+		delete(p.conns, key)
+		p.mu.Unlock()
+		log.Printf("SSH connection to %s died, reconnecting...", key)
+	}
+
+	// Create new connection
+	conn, err := p.connect(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	p.conns[key] = conn
+	p.mu.Unlock()
+
+	return conn, nil
+}
+
+// connect creates a new SSH connection. Cancelling ctx aborts dialing and the handshake.
+func (p *SSHPool) connect(ctx context.Context, cfg *SSHConfig) (*SSHConnection, error) {
+	// Read SSH key
+	keyPath := cfg.KeyFile
+	keyData, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read SSH key %s: %w", keyPath, err)
+	}
+
+	// Parse private key
+	signer, err := ssh.ParsePrivateKey(keyData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse SSH key %s: %w", keyPath, err)
+	}
+
+	// SSH config
+	config := &ssh.ClientConfig{
+		User: cfg.User,
+		Auth: []ssh.AuthMethod{
+			ssh.PublicKeys(signer),
+		},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(), // TODO: proper host key verification
+		Timeout:         10 * time.Second,
+	}
+
+	// Connect
+	addr := fmt.Sprintf("%s:%d", cfg.Host, cfg.Port)
+	log.Printf("Connecting to SSH %s...", addr)
+	dialer := net.Dialer{Timeout: config.Timeout}
+	netConn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+	stop := context.AfterFunc(ctx, func() { netConn.Close() })
+	netConn.SetDeadline(time.Now().Add(config.Timeout))
+	c, chans, reqs, err := ssh.NewClientConn(netConn, addr, config)
+	if !stop() {
+		if err == nil {
+			c.Close()
+		}
+		return nil, fmt.Errorf("failed to connect to %s: %w", addr, ctx.Err())
+	}
+	if err != nil {
+		netConn.Close()
+		return nil, fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+	netConn.SetDeadline(time.Time{})
+	client := ssh.NewClient(c, chans, reqs)
+
+	// Create SFTP client
+	sftpClient, err := sftp.NewClient(client)
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to create SFTP client: %w", err)
+	}
+
+	log.Printf("SSH connection established to %s", addr)
+	return &SSHConnection{
+		client: client,
+		sftp:   sftpClient,
+	}, nil
+}
+
+// Close closes all connections in the pool
+func (p *SSHPool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for key, conn := range p.conns {
+		conn.sftp.Close()
+		conn.client.Close()
+		log.Printf("Closed SSH connection to %s", key)
+	}
+	p.conns = make(map[string]*SSHConnection)
+}
+
+// RemoteFS implements FileSystem for SSH/SFTP repositories
+type RemoteFS struct {
+	conn     *SSHConnection
+	basePath string
+	config   *SSHConfig
+}
+
+// sftpCall runs an SFTP request, returning early with ctx's error if ctx is cancelled
+// first. SFTP requests can't be withdrawn, so an abandoned call finishes in the background.
+func sftpCall[T any](ctx context.Context, call func() (T, error)) (T, error) {
+	type result struct {
+		value T
+		err   error
+	}
+	if err := ctx.Err(); err != nil {
+		var zero T
+		return zero, err
+	}
+	done := make(chan result, 1)
+	go func() {
+		value, err := call()
+		done <- result{value, err}
+	}()
+	select {
+	case res := <-done:
+		return res.value, res.err
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
+
+func (r *RemoteFS) ReadFile(ctx context.Context, path string) ([]byte, error) {
+	file, err := r.openFile(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	// Closing the handle on cancellation fails a read in progress and frees the handle
+	stop := context.AfterFunc(ctx, func() { file.Close() })
+	defer stop()
+
+	// Get file size
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, stat.Size())
+	_, err = file.Read(data)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, ctxErr
+	}
+	if err != nil && err.Error() != "EOF" {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// Open opens a file for streaming, for files too large to hold in memory
+func (r *RemoteFS) Open(ctx context.Context, path string) (io.ReadCloser, error) {
+	file, err := r.openFile(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// openFile opens a file, closing it again if ctx was cancelled while waiting
+func (r *RemoteFS) openFile(ctx context.Context, path string) (*sftp.File, error) {
+	fullPath := filepath.Join(r.basePath, path)
+	// Convert to forward slashes for remote
+	fullPath = strings.ReplaceAll(fullPath, "\\", "/")
+
+	return sftpCall(ctx, func() (*sftp.File, error) {
+		file, err := r.conn.sftp.Open(fullPath)
+		if err == nil && ctx.Err() != nil {
+			// Abandoned: don't leak the handle
+			file.Close()
+		}
+		return file, err
+	})
+}
+
+func (r *RemoteFS) ReadDir(ctx context.Context, path string) ([]fs.DirEntry, error) {
+	fullPath := filepath.Join(r.basePath, path)
+	fullPath = strings.ReplaceAll(fullPath, "\\", "/")
+
+	infos, err := sftpCall(ctx, func() ([]os.FileInfo, error) { return r.conn.sftp.ReadDir(fullPath) })
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]fs.DirEntry, len(infos))
+	for i, info := range infos {
+		entries[i] = &sftpDirEntry{info: info}
+	}
+	return entries, nil
+}
+
+func (r *RemoteFS) Stat(ctx context.Context, path string) (fs.FileInfo, error) {
+	fullPath := filepath.Join(r.basePath, path)
+	fullPath = strings.ReplaceAll(fullPath, "\\", "/")
+
+	return sftpCall(ctx, func() (fs.FileInfo, error) { return r.conn.sftp.Stat(fullPath) })
+}
+
+func (r *RemoteFS) Readlink(ctx context.Context, path string) (string, error) {
+	fullPath := filepath.Join(r.basePath, path)
+	fullPath = strings.ReplaceAll(fullPath, "\\", "/")
+
+	return sftpCall(ctx, func() (string, error) { return r.conn.sftp.ReadLink(fullPath) })
+}
+
+func (r *RemoteFS) Walk(ctx context.Context, root string, fn filepath.WalkFunc) error {
+	fullPath := filepath.Join(r.basePath, root)
+	fullPath = strings.ReplaceAll(fullPath, "\\", "/")
+
+	return r.walkDir(ctx, fullPath, fn)
+}
+
+func (r *RemoteFS) walkDir(ctx context.Context, path string, fn filepath.WalkFunc) error {
+	info, err := sftpCall(ctx, func() (fs.FileInfo, error) { return r.conn.sftp.Stat(path) })
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		return fn(path, nil, err)
+	}
+
+	if err := fn(path, info, nil); err != nil {
+		if err == filepath.SkipDir {
+			return nil
+		}
+		return err
+	}
+
+	if !info.IsDir() {
+		return nil
+	}
+
+	entries, err := sftpCall(ctx, func() ([]os.FileInfo, error) { return r.conn.sftp.ReadDir(path) })
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		return fn(path, info, err)
+	}
+	// Sort for a stable walk order, matching filepath.Walk
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		childPath := path + "/" + entry.Name()
+		if entry.IsDir() {
+			if err := r.walkDir(ctx, childPath, fn); err != nil {
+				return err
+			}
+		} else {
+			if err := fn(childPath, entry, nil); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (r *RemoteFS) BasePath() string {
+	return r.basePath
+}
+
+func (r *RemoteFS) Type() string {
+	return "ssh"
+}
+
+func (r *RemoteFS) Info() map[string]string {
+	return map[string]string{
+		"type": "ssh",
+		"host": r.config.Host,
+		"user": r.config.User,
+		"path": r.basePath,
+	}
+}
+
+// sftpDirEntry wraps os.FileInfo to implement fs.DirEntry
+type sftpDirEntry struct {
+	info os.FileInfo
+}
+
+func (e *sftpDirEntry) Name() string               { return e.info.Name() }
+func (e *sftpDirEntry) IsDir() bool                { return e.info.IsDir() }
+func (e *sftpDirEntry) Type() fs.FileMode          { return e.info.Mode().Type() }
+func (e *sftpDirEntry) Info() (fs.FileInfo, error) { return e.info, nil }
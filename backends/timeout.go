@@ -0,0 +1,72 @@
+package backends
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"time"
+)
+
+// timeoutFS bounds every operation on a repository configured with a timeout
+type timeoutFS struct {
+	fs      FileSystem
+	timeout time.Duration
+}
+
+// timeoutError reports an operation that ran out of time as a timeout of the repository
+// rather than a bare "context deadline exceeded"
+func timeoutError(ctx context.Context, err error, timeout time.Duration) error {
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("timed out after %s: %w", timeout, err)
+	}
+	return err
+}
+
+func (t *timeoutFS) ReadFile(ctx context.Context, path string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	data, err := t.fs.ReadFile(ctx, path)
+	return data, timeoutError(ctx, err, t.timeout)
+}
+
+func (t *timeoutFS) ReadDir(ctx context.Context, path string) ([]fs.DirEntry, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	entries, err := t.fs.ReadDir(ctx, path)
+	return entries, timeoutError(ctx, err, t.timeout)
+}
+
+func (t *timeoutFS) Stat(ctx context.Context, path string) (fs.FileInfo, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	info, err := t.fs.Stat(ctx, path)
+	return info, timeoutError(ctx, err, t.timeout)
+}
+
+func (t *timeoutFS) Readlink(ctx context.Context, path string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	target, err := t.fs.Readlink(ctx, path)
+	return target, timeoutError(ctx, err, t.timeout)
+}
+
+// Walk bounds the whole walk, not each directory it reads
+func (t *timeoutFS) Walk(ctx context.Context, root string, fn filepath.WalkFunc) error {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	return timeoutError(ctx, t.fs.Walk(ctx, root, fn), t.timeout)
+}
+
+func (t *timeoutFS) BasePath() string {
+	return t.fs.BasePath()
+}
+
+func (t *timeoutFS) Type() string {
+	return t.fs.Type()
+}
+
+func (t *timeoutFS) Info() map[string]string {
+	return t.fs.Info()
+}
@@ -0,0 +1,188 @@
+package backends
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// propfindBody asks for the properties WebDAVFS needs
+const propfindBody = `<?xml version="1.0" encoding="utf-8"?>
+<propfind xmlns="DAV:"><prop><resourcetype/><getcontentlength/><getlastmodified/></prop></propfind>`
+
+// davMultistatus is a PROPFIND response
+type davMultistatus struct {
+	Responses []struct {
+		Href      string `xml:"DAV: href"`
+		Propstats []struct {
+			Status string `xml:"DAV: status"`
+			Prop   struct {
+				ResourceType struct {
+					Collection *struct{} `xml:"DAV: collection"`
+				} `xml:"DAV: resourcetype"`
+				ContentLength string `xml:"DAV: getcontentlength"`
+				LastModified  string `xml:"DAV: getlastmodified"`
+			} `xml:"DAV: prop"`
+		} `xml:"DAV: propstat"`
+	} `xml:"DAV: response"`
+}
+
+// WebDAVFS implements FileSystem over a WebDAV share, using PROPFIND to stat and list and
+// GET to read
+type WebDAVFS struct {
+	client *httpClient
+}
+
+func NewWebDAVFS(cfg *HTTPConfig) (*WebDAVFS, error) {
+	client, err := newHTTPClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &WebDAVFS{client: client}, nil
+}
+
+// propfind returns the resources at a path (depth 0) or in a collection (depth 1), keyed
+// by their unescaped URL path without a trailing "/"
+func (w *WebDAVFS) propfind(ctx context.Context, op, p string, depth int) (map[string]*httpInfo, error) {
+	target := w.client.resolve(p, depth > 0)
+	header := http.Header{
+		"Depth":        {strconv.Itoa(depth)},
+		"Content-Type": {`application/xml; charset="utf-8"`},
+	}
+	resp, err := w.client.do(ctx, "PROPFIND", target, header, propfindBody)
+	if err != nil {
+		return nil, &fs.PathError{Op: op, Path: p, Err: err}
+	}
+	if resp.status != http.StatusMultiStatus {
+		return nil, statusError(op, p, resp)
+	}
+
+	var ms davMultistatus
+	if err := xml.Unmarshal(resp.body, &ms); err != nil {
+		return nil, &fs.PathError{Op: op, Path: p, Err: fmt.Errorf("invalid PROPFIND response: %w", err)}
+	}
+	requestURL, _ := url.Parse(target)
+	infos := make(map[string]*httpInfo)
+	for _, r := range ms.Responses {
+		// Hrefs may be absolute paths or full URLs
+		ref, err := url.Parse(strings.TrimSpace(r.Href))
+		if err != nil {
+			continue
+		}
+		hrefPath := strings.TrimSuffix(requestURL.ResolveReference(ref).Path, "/")
+		for _, ps := range r.Propstats {
+			if !strings.Contains(ps.Status, " 200 ") {
+				continue
+			}
+			info := &httpInfo{name: path.Base(hrefPath), dir: ps.Prop.ResourceType.Collection != nil}
+			info.size, _ = strconv.ParseInt(ps.Prop.ContentLength, 10, 64)
+			info.modTime, _ = http.ParseTime(ps.Prop.LastModified)
+			infos[hrefPath] = info
+		}
+	}
+	return infos, nil
+}
+
+// urlPath returns the unescaped URL path of a repository-relative path
+func (w *WebDAVFS) urlPath(p string) string {
+	u, _ := url.Parse(w.client.resolve(p, false))
+	return strings.TrimSuffix(u.Path, "/")
+}
+
+func (w *WebDAVFS) ReadFile(ctx context.Context, p string) ([]byte, error) {
+	resp, err := w.client.do(ctx, http.MethodGet, w.client.resolve(p, false), nil, "")
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: p, Err: err}
+	}
+	if resp.status != http.StatusOK {
+		return nil, statusError("open", p, resp)
+	}
+	return resp.body, nil
+}
+
+func (w *WebDAVFS) ReadDir(ctx context.Context, p string) ([]fs.DirEntry, error) {
+	infos, err := w.propfind(ctx, "readdir", p, 1)
+	if err != nil {
+		return nil, err
+	}
+	self := w.urlPath(p)
+	if info, ok := infos[self]; ok && !info.dir {
+		return nil, &fs.PathError{Op: "readdir", Path: p, Err: errors.New("not a directory")}
+	}
+
+	var entries []fs.DirEntry
+	for hrefPath, info := range infos {
+		if hrefPath == self || path.Dir(hrefPath) != self {
+			continue
+		}
+		entries = append(entries, fs.FileInfoToDirEntry(info))
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+func (w *WebDAVFS) Stat(ctx context.Context, p string) (fs.FileInfo, error) {
+	infos, err := w.propfind(ctx, "stat", p, 0)
+	if err != nil {
+		return nil, err
+	}
+	self := w.urlPath(p)
+	info, ok := infos[self]
+	if !ok {
+		// Servers that redirect a collection to its "/" form answer for that URL instead
+		for _, only := range infos {
+			info, ok = only, len(infos) == 1
+		}
+	}
+	if !ok {
+		return nil, &fs.PathError{Op: "stat", Path: p, Err: fs.ErrNotExist}
+	}
+	info.name = path.Base(path.Join(w.BasePath(), filepath.ToSlash(p)))
+	return info, nil
+}
+
+func (w *WebDAVFS) Readlink(ctx context.Context, p string) (string, error) {
+	return "", &fs.PathError{Op: "readlink", Path: p, Err: errors.New("WebDAV has no symbolic links")}
+}
+
+// Walk lists one collection at a time (depth 1), since many servers refuse infinite depth
+func (w *WebDAVFS) Walk(ctx context.Context, root string, fn filepath.WalkFunc) error {
+	fullPath := path.Join(w.BasePath(), filepath.ToSlash(root))
+	info, err := w.Stat(ctx, root)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		return fn(fullPath, nil, err)
+	}
+	err = walkReadDir(ctx, fullPath, path.Clean(filepath.ToSlash(root)), info, w.ReadDir, fn)
+	if err == filepath.SkipDir || err == filepath.SkipAll {
+		return nil
+	}
+	return err
+}
+
+// BasePath is the path of the share's URL
+func (w *WebDAVFS) BasePath() string {
+	return path.Clean(w.client.base.Path)
+}
+
+func (w *WebDAVFS) Type() string {
+	return "webdav"
+}
+
+func (w *WebDAVFS) Info() map[string]string {
+	return map[string]string{
+		"type": "webdav",
+		"url":  w.client.base.String(),
+	}
+}
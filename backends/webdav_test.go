@@ -0,0 +1,302 @@
+package backends
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeDAV serves an in-memory tree below /dav/ over PROPFIND (depth 0 and 1) and GET.
+// Directory keys end in "/".
+type fakeDAV struct {
+	files   map[string]string
+	modTime time.Time
+	auth    func(*http.Request) bool
+
+	mu     sync.Mutex
+	depths []string // Depth header of each PROPFIND
+}
+
+func newFakeDAV(t *testing.T) (*fakeDAV, *httptest.Server) {
+	t.Helper()
+	f := &fakeDAV{
+		files: map[string]string{
+			"docs/":          "",
+			"docs/guide.md":  "guide\n",
+			"docs/empty/":    "",
+			"my notes.txt":   "notes\n",
+			"readme.md":      "# readme\n",
+			"sub/deep/x.txt": "x\n",
+			"sub/":           "",
+			"sub/deep/":      "",
+		},
+		modTime: time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC),
+	}
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+	return f, server
+}
+
+func (f *fakeDAV) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if f.auth != nil && !f.auth(r) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if !strings.HasPrefix(r.URL.Path, "/dav/") && r.URL.Path != "/dav" {
+		http.NotFound(w, r)
+		return
+	}
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/dav"), "/")
+	_, isDir := f.files[name+"/"]
+	isDir = isDir || name == ""
+	content, isFile := f.files[name]
+	if !isDir && !isFile {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		if isDir {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		fmt.Fprint(w, content)
+	case "PROPFIND":
+		depth := r.Header.Get("Depth")
+		f.mu.Lock()
+		f.depths = append(f.depths, depth)
+		f.mu.Unlock()
+
+		var b strings.Builder
+		b.WriteString(`<?xml version="1.0" encoding="utf-8"?><D:multistatus xmlns:D="DAV:">`)
+		f.writeResponse(&b, r, name, isDir)
+		if depth == "1" && isDir {
+			var children []string
+			for key := range f.files {
+				child := strings.TrimSuffix(key, "/")
+				parent := path.Dir(child)
+				if parent == "." {
+					parent = ""
+				}
+				if parent == name {
+					children = append(children, key)
+				}
+			}
+			sort.Strings(children)
+			for _, key := range children {
+				f.writeResponse(&b, r, strings.TrimSuffix(key, "/"), strings.HasSuffix(key, "/"))
+			}
+		}
+		b.WriteString(`</D:multistatus>`)
+		w.Header().Set("Content-Type", `application/xml; charset="utf-8"`)
+		w.WriteHeader(http.StatusMultiStatus)
+		fmt.Fprint(w, b.String())
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// writeResponse writes the multistatus response of one resource. Collections report
+// getcontentlength in a 404 propstat, as servers do for properties a resource lacks. Files
+// with spaces get a full URL as href, the others an absolute path.
+func (f *fakeDAV) writeResponse(b *strings.Builder, r *http.Request, name string, dir bool) {
+	p := "/dav/" + name
+	if dir && name != "" {
+		p += "/"
+	}
+	href := (&url.URL{Path: p}).EscapedPath()
+	if strings.Contains(name, " ") {
+		href = "http://" + r.Host + href
+	}
+	fmt.Fprintf(b, "<D:response><D:href>%s</D:href><D:propstat><D:prop>", href)
+	if dir {
+		b.WriteString("<D:resourcetype><D:collection/></D:resourcetype>")
+	} else {
+		fmt.Fprintf(b, "<D:resourcetype/><D:getcontentlength>%d</D:getcontentlength>", len(f.files[name]))
+	}
+	fmt.Fprintf(b, "<D:getlastmodified>%s</D:getlastmodified></D:prop><D:status>HTTP/1.1 200 OK</D:status></D:propstat>",
+		f.modTime.Format(http.TimeFormat))
+	if dir {
+		b.WriteString("<D:propstat><D:prop><D:getcontentlength/></D:prop><D:status>HTTP/1.1 404 Not Found</D:status></D:propstat>")
+	}
+	b.WriteString("</D:response>")
+}
+
+func (f *fakeDAV) takeDepths() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	depths := f.depths
+	f.depths = nil
+	return depths
+}
+
+func TestWebDAVFSStat(t *testing.T) {
+	f, server := newFakeDAV(t)
+	w, err := NewWebDAVFS(&HTTPConfig{URL: server.URL + "/dav"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	tests := []struct {
+		path  string
+		name  string
+		isDir bool
+		size  int64
+	}{
+		{".", "dav", true, 0},
+		{"docs", "docs", true, 0},
+		{"docs/empty", "empty", true, 0},
+		{"readme.md", "readme.md", false, 9},
+		{"my notes.txt", "my notes.txt", false, 6},
+	}
+	for _, tt := range tests {
+		info, err := w.Stat(ctx, tt.path)
+		if err != nil {
+			t.Errorf("Stat(%q): %v", tt.path, err)
+			continue
+		}
+		if info.Name() != tt.name || info.IsDir() != tt.isDir || info.Size() != tt.size {
+			t.Errorf("Stat(%q) = %q dir %v size %d, want %q dir %v size %d", tt.path,
+				info.Name(), info.IsDir(), info.Size(), tt.name, tt.isDir, tt.size)
+		}
+		if !info.ModTime().Equal(f.modTime) {
+			t.Errorf("Stat(%q).ModTime() = %v, want %v", tt.path, info.ModTime(), f.modTime)
+		}
+	}
+	for _, depth := range f.takeDepths() {
+		if depth != "0" {
+			t.Errorf("Stat sent PROPFIND with Depth %q, want 0", depth)
+		}
+	}
+
+	if _, err := w.Stat(ctx, "missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Stat(missing) error = %v, want fs.ErrNotExist", err)
+	}
+}
+
+func TestWebDAVFSReadDir(t *testing.T) {
+	f, server := newFakeDAV(t)
+	w, err := NewWebDAVFS(&HTTPConfig{URL: server.URL + "/dav/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	type entry struct {
+		name  string
+		isDir bool
+		size  int64
+	}
+	readDir := func(p string) []entry {
+		t.Helper()
+		entries, err := w.ReadDir(ctx, p)
+		if err != nil {
+			t.Fatalf("ReadDir(%q): %v", p, err)
+		}
+		var got []entry
+		for _, e := range entries {
+			info, _ := e.Info()
+			got = append(got, entry{e.Name(), e.IsDir(), info.Size()})
+		}
+		return got
+	}
+
+	want := []entry{{"docs", true, 0}, {"my notes.txt", false, 6}, {"readme.md", false, 9}, {"sub", true, 0}}
+	if got := readDir("."); !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadDir(.) = %v, want %v", got, want)
+	}
+	want = []entry{{"empty", true, 0}, {"guide.md", false, 6}}
+	if got := readDir("docs"); !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadDir(docs) = %v, want %v", got, want)
+	}
+	if got := readDir("docs/empty"); len(got) != 0 {
+		t.Errorf("ReadDir(docs/empty) = %v, want no entries", got)
+	}
+	if depths := f.takeDepths(); !reflect.DeepEqual(depths, []string{"1", "1", "1"}) {
+		t.Errorf("ReadDir sent PROPFIND with Depth %q, want 1 each time", depths)
+	}
+
+	if _, err := w.ReadDir(ctx, "readme.md"); err == nil || !strings.Contains(err.Error(), "not a directory") {
+		t.Errorf("ReadDir(readme.md) error = %v, want not a directory", err)
+	}
+	if _, err := w.ReadDir(ctx, "missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("ReadDir(missing) error = %v, want fs.ErrNotExist", err)
+	}
+}
+
+func TestWebDAVFSReadFileAndWalk(t *testing.T) {
+	_, server := newFakeDAV(t)
+	w, err := NewWebDAVFS(&HTTPConfig{URL: server.URL + "/dav"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	for p, want := range map[string]string{"readme.md": "# readme\n", "my notes.txt": "notes\n", "sub/deep/x.txt": "x\n"} {
+		data, err := w.ReadFile(ctx, p)
+		if err != nil || string(data) != want {
+			t.Errorf("ReadFile(%q) = %q, %v, want %q", p, data, err, want)
+		}
+	}
+	if _, err := w.ReadFile(ctx, "missing.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("ReadFile(missing.txt) error = %v, want fs.ErrNotExist", err)
+	}
+
+	var visited []string
+	err = w.Walk(ctx, ".", func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		visited = append(visited, strings.TrimPrefix(p, w.BasePath()))
+		if info.IsDir() && info.Name() == "docs" {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"", "/docs", "/my notes.txt", "/readme.md", "/sub", "/sub/deep", "/sub/deep/x.txt"}
+	if !reflect.DeepEqual(visited, want) {
+		t.Errorf("Walk(.) visited %q, want %q", visited, want)
+	}
+}
+
+func TestWebDAVFSBasicAuth(t *testing.T) {
+	f, server := newFakeDAV(t)
+	f.auth = func(r *http.Request) bool {
+		user, password, ok := r.BasicAuth()
+		return ok && user == "dav" && password == "pw"
+	}
+	ctx := context.Background()
+
+	t.Setenv("FSTESTDAV_USERNAME", "dav")
+	t.Setenv("FSTESTDAV_PASSWORD", "pw")
+	w, err := NewWebDAVFS(&HTTPConfig{URL: server.URL + "/dav", CredentialsEnv: "FSTESTDAV"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.ReadDir(ctx, "."); err != nil {
+		t.Errorf("ReadDir with basic auth: %v", err)
+	}
+
+	anonymous, _ := NewWebDAVFS(&HTTPConfig{URL: server.URL + "/dav"})
+	if _, err := anonymous.Stat(ctx, "readme.md"); !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("Stat without credentials error = %v, want fs.ErrPermission", err)
+	}
+}
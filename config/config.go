@@ -0,0 +1,199 @@
+// Package config loads and watches the server's configuration file
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/vimalk78/fs-mcp/backends"
+)
+
+// Config is a parsed configuration file
+type Config struct {
+	Repositories map[string]*backends.Repository
+	MaxResults   int                                     // Default page size for listing and search tools
+	Backends     map[string]backends.PluginBackendConfig // Out-of-process backends by repository type
+	ToolTimeout  int                                     // Seconds a tool call may take (default: no limit)
+	ToolTimeouts map[string]int                          // Per-tool overrides of ToolTimeout, by tool name
+	Cache        backends.CacheOptions                   // Sizes of the read-through cache
+	Audit        AuditConfig                             // Audit log of tool calls and resource reads
+	Path         string                                  // File the config was loaded from, if any
+}
+
+// file represents the configuration file structure
+type file struct {
+	Repositories map[string]json.RawMessage              `json:"repositories"`
+	MaxResults   int                                     `json:"max_results"`
+	Backends     map[string]backends.PluginBackendConfig `json:"backends"`
+	ToolTimeout  int                                     `json:"tool_timeout"`
+	ToolTimeouts map[string]int                          `json:"tool_timeouts"`
+	Cache        backends.CacheOptions                   `json:"cache"`
+	Audit        AuditConfig                             `json:"audit"`
+}
+
+// AuditConfig is the "audit" setting: a JSONL log of every tool call and resource read
+type AuditConfig struct {
+	Path       string `json:"path"`         // Log file; no audit log if empty
+	MaxSizeMB  int    `json:"max_size_mb"`  // Size at which the log is rotated (default 100)
+	MaxFiles   int    `json:"max_files"`    // Rotated logs kept as <path>.1 (newest) to <path>.<n> (default 5)
+	HashKeyEnv string `json:"hash_key_env"` // Variable holding a key for hashing the paths of repositories with audit_hash_paths (default: a random key per run)
+}
+
+// Parse parses the contents of a configuration file
+func Parse(data []byte) (*Config, error) {
+	var f file
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+
+	for name, def := range f.Backends {
+		if _, builtin := backends.LookupBackend(name); builtin {
+			return nil, fmt.Errorf("backend %s: a built-in repository type has that name", name)
+		}
+		if len(def.Command) == 0 {
+			return nil, fmt.Errorf("backend %s: requires 'command'", name)
+		}
+	}
+
+	if f.ToolTimeout < 0 {
+		return nil, fmt.Errorf("tool_timeout must not be negative")
+	}
+	for tool, seconds := range f.ToolTimeouts {
+		if seconds < 0 {
+			return nil, fmt.Errorf("tool_timeouts: %s must not be negative", tool)
+		}
+	}
+	if f.Cache.MemoryMB < 0 || f.Cache.DiskMB < 0 {
+		return nil, fmt.Errorf("cache sizes must not be negative")
+	}
+	if f.Audit.MaxSizeMB < 0 || f.Audit.MaxFiles < 0 {
+		return nil, fmt.Errorf("audit max_size_mb and max_files must not be negative")
+	}
+	if strings.HasPrefix(f.Audit.Path, "~") {
+		if homeDir, err := os.UserHomeDir(); err == nil {
+			f.Audit.Path = filepath.Join(homeDir, f.Audit.Path[1:])
+		}
+	}
+
+	// Parse repositories
+	config := &Config{
+		Repositories: make(map[string]*backends.Repository),
+		MaxResults:   f.MaxResults,
+		Backends:     f.Backends,
+		ToolTimeout:  f.ToolTimeout,
+		ToolTimeouts: f.ToolTimeouts,
+		Cache:        f.Cache,
+		Audit:        f.Audit,
+	}
+	for name, raw := range f.Repositories {
+		repo, err := backends.ParseRepository(name, raw, f.Backends)
+		if err != nil {
+			return nil, err
+		}
+		config.Repositories[name] = repo
+	}
+	return config, nil
+}
+
+// Load reads and parses a configuration file
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file %s: %w", path, err)
+	}
+	config, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	config.Path = path
+	return config, nil
+}
+
+// DefaultPath finds the config file to use when none is given: ~/.config/fs-mcp/config.json
+// (recommended location), config.json in the executable's directory, or config.json in
+// the current directory. The result is absolute so it can be watched.
+func DefaultPath() string {
+	configPath := ""
+
+	// Try ~/.config/fs-mcp/config.json first
+	homeDir, err := os.UserHomeDir()
+	if err == nil {
+		candidatePath := filepath.Join(homeDir, ".config", "fs-mcp", "config.json")
+		if _, err := os.Stat(candidatePath); err == nil {
+			configPath = candidatePath
+		}
+	}
+
+	// Try executable directory
+	if configPath == "" {
+		exePath, err := os.Executable()
+		if err == nil {
+			exeDir := filepath.Dir(exePath)
+			candidatePath := filepath.Join(exeDir, "config.json")
+			if _, err := os.Stat(candidatePath); err == nil {
+				configPath = candidatePath
+			}
+		}
+	}
+
+	// Fallback to current directory
+	if configPath == "" {
+		configPath = "config.json"
+	}
+
+	if absPath, err := filepath.Abs(configPath); err == nil {
+		configPath = absPath
+	}
+	return configPath
+}
+
+// Watch watches a configuration file and calls onChange whenever it is saved, including
+// atomic saves that replace the file. It only returns if the watch can't be set up.
+func Watch(path string, onChange func()) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create file watcher: %w", err)
+	}
+	defer watcher.Close()
+
+	if err := watcher.Add(path); err != nil {
+		return fmt.Errorf("failed to watch config file: %w", err)
+	}
+
+	log.Printf("Watching config file for changes: %s", path)
+
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			// Handle Write and Create events (normal saves)
+			if event.Op&(fsnotify.Write|fsnotify.Create) != 0 {
+				log.Printf("Config file changed, reloading...")
+				onChange()
+			}
+			// Handle Remove and Rename events (atomic saves from editors like vim)
+			if event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+				log.Printf("Config file removed/renamed, re-adding watch...")
+				// Re-add the watch after atomic save
+				watcher.Add(path)
+				// Wait a bit for the file to be fully written
+				time.Sleep(50 * time.Millisecond)
+				onChange()
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			log.Printf("File watcher error: %v", err)
+		}
+	}
+}
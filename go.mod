@@ -5,14 +5,15 @@ go 1.24.0
 toolchain go1.24.1
 
 require (
+	github.com/bmatcuk/doublestar/v4 v4.10.0
 	github.com/fsnotify/fsnotify v1.7.0
 	github.com/mark3labs/mcp-go v0.7.0
+	github.com/pkg/sftp v1.13.10
+	golang.org/x/crypto v0.45.0
 )
 
 require (
 	github.com/google/uuid v1.6.0 // indirect
 	github.com/kr/fs v0.1.0 // indirect
-	github.com/pkg/sftp v1.13.10 // indirect
-	golang.org/x/crypto v0.45.0 // indirect
 	golang.org/x/sys v0.38.0 // indirect
 )
@@ -0,0 +1,48 @@
+// Package policy decides which paths within a repository may be accessed
+package policy
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// ValidatePath ensures the requested path is within the repository bounds
+func ValidatePath(basePath, requestedPath string) (string, error) {
+	absBasePath, err := filepath.Abs(basePath)
+	if err != nil {
+		return "", err
+	}
+
+	targetPath := filepath.Join(absBasePath, requestedPath)
+	absTargetPath, err := filepath.Abs(targetPath)
+	if err != nil {
+		return "", err
+	}
+
+	// Check if the target path is within the repository
+	relPath, err := filepath.Rel(absBasePath, absTargetPath)
+	if err != nil || strings.HasPrefix(relPath, "..") {
+		return "", fmt.Errorf("path traversal detected: %s", requestedPath)
+	}
+
+	return relPath, nil
+}
+
+// ShouldSkip reports whether a path is hidden from listings, searches and reads: hidden
+// files and directories, and node_modules
+func ShouldSkip(path string) bool {
+	base := filepath.Base(path)
+
+	// Skip hidden files/directories
+	if strings.HasPrefix(base, ".") {
+		return true
+	}
+
+	// Skip node_modules
+	if base == "node_modules" {
+		return true
+	}
+
+	return false
+}
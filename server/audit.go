@@ -0,0 +1,413 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+
+	"github.com/vimalk78/fs-mcp/backends"
+	"github.com/vimalk78/fs-mcp/config"
+)
+
+const (
+	defaultAuditMaxSizeMB = 100
+	defaultAuditMaxFiles  = 5
+	// maxAuditPaths bounds the paths recorded for one call, so that a search of a large
+	// repository doesn't write a huge line; the rest are only counted
+	maxAuditPaths = 1000
+)
+
+// auditRecord is one line of the audit log
+type auditRecord struct {
+	Time          time.Time           `json:"time"`
+	Session       string              `json:"session,omitempty"`
+	Client        string              `json:"client,omitempty"`
+	Kind          string              `json:"kind"` // "tool" or "resource"
+	Tool          string              `json:"tool,omitempty"`
+	Repos         []string            `json:"repos,omitempty"`
+	Paths         map[string][]string `json:"paths,omitempty"` // Paths looked up or listed, by repository
+	Read          map[string][]string `json:"read,omitempty"`  // Files whose contents were read, by repository
+	PathsOmitted  int                 `json:"paths_omitted,omitempty"`
+	BytesRead     int64               `json:"bytes_read"`     // Bytes of file contents read from repositories
+	BytesReturned int64               `json:"bytes_returned"` // Size of the JSON-encoded result
+	Status        string              `json:"status"`         // "ok", "error", "timeout" or "cancelled"
+	Error         string              `json:"error,omitempty"`
+	DurationMS    int64               `json:"duration_ms"`
+}
+
+// auditLog writes audit records to a JSONL file, rotating it when it grows too large
+type auditLog struct {
+	mu        sync.Mutex
+	cfg       config.AuditConfig
+	hashKey   []byte // key of path hashes: the configured one or randomKey
+	randomKey []byte // drawn the first time no key is configured
+	file      *os.File
+	size      int64
+	peer      func() (session, client string)
+}
+
+// configure applies the audit settings of a (re)loaded config. An empty path turns the
+// log off.
+func (a *auditLog) configure(cfg config.AuditConfig) {
+	if cfg.MaxSizeMB == 0 {
+		cfg.MaxSizeMB = defaultAuditMaxSizeMB
+	}
+	if cfg.MaxFiles == 0 {
+		cfg.MaxFiles = defaultAuditMaxFiles
+	}
+	var key []byte
+	if cfg.HashKeyEnv != "" {
+		key = []byte(os.Getenv(cfg.HashKeyEnv))
+		if len(key) == 0 {
+			log.Printf("Audit hash key variable %s is not set; hashing paths with a random key", cfg.HashKeyEnv)
+		}
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.file != nil && cfg.Path != a.cfg.Path {
+		a.file.Close()
+		a.file = nil
+	}
+	a.cfg = cfg
+	if len(key) == 0 {
+		// An unkeyed hash of a path is found by hashing likely names, so without a
+		// configured key one is drawn for the life of the process
+		if a.randomKey == nil {
+			a.randomKey = make([]byte, 32)
+			rand.Read(a.randomKey)
+		}
+		key = a.randomKey
+	}
+	a.hashKey = key
+}
+
+// close closes the log file; a later record reopens it
+func (a *auditLog) close() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.file != nil {
+		a.file.Close()
+		a.file = nil
+	}
+}
+
+// enabled reports whether records are written
+func (a *auditLog) enabled() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.cfg.Path != ""
+}
+
+// hash replaces a path of a repository with audit_hash_paths
+func (a *auditLog) hash(p string) string {
+	a.mu.Lock()
+	key := a.hashKey
+	a.mu.Unlock()
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(p))
+	return "hmac-sha256:" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// write appends a record. Failures are logged, never passed on to the call.
+func (a *auditLog) write(rec *auditRecord) {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		log.Printf("Failed to encode audit record: %v", err)
+		return
+	}
+	data = append(data, '\n')
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.cfg.Path == "" {
+		return
+	}
+	if a.file == nil {
+		if err := a.open(); err != nil {
+			log.Printf("Failed to open audit log: %v", err)
+			return
+		}
+	}
+	if a.size > 0 && a.size+int64(len(data)) > int64(a.cfg.MaxSizeMB)<<20 {
+		a.rotate()
+		if err := a.open(); err != nil {
+			log.Printf("Failed to open audit log: %v", err)
+			return
+		}
+	}
+	n, err := a.file.Write(data)
+	a.size += int64(n)
+	if err != nil {
+		log.Printf("Failed to write audit log: %v", err)
+	}
+}
+
+// open opens the log for appending, readable only by the user running the server
+func (a *auditLog) open() error {
+	if err := os.MkdirAll(filepath.Dir(a.cfg.Path), 0700); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(a.cfg.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	a.file = file
+	a.size = info.Size()
+	return nil
+}
+
+// rotate moves the log to <path>.1, shifting older logs up and dropping the oldest
+func (a *auditLog) rotate() {
+	a.file.Close()
+	a.file = nil
+	os.Remove(fmt.Sprintf("%s.%d", a.cfg.Path, a.cfg.MaxFiles))
+	for i := a.cfg.MaxFiles - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", a.cfg.Path, i), fmt.Sprintf("%s.%d", a.cfg.Path, i+1))
+	}
+	if err := os.Rename(a.cfg.Path, a.cfg.Path+".1"); err != nil {
+		log.Printf("Failed to rotate audit log: %v", err)
+	}
+}
+
+// auditCall collects what one tool call or resource read touched. Repositories opened
+// with the call's context are wrapped in an auditFS that records into it. A nil
+// *auditCall ignores everything, so callers needn't check whether auditing is on.
+type auditCall struct {
+	log   *auditLog
+	kind  string
+	tool  string
+	start time.Time
+
+	mu        sync.Mutex
+	hashed    map[string]bool            // repositories opened, and whether to hash their paths
+	paths     map[string]map[string]bool // by repository
+	read      map[string]map[string]bool // by repository
+	recorded  int
+	omitted   int
+	bytesRead int64
+}
+
+// auditKey is the context key of a call's *auditCall
+type auditKey struct{}
+
+// begin starts auditing a call, returning a context that carries it. It returns ctx and
+// nil if there is no audit log.
+func (a *auditLog) begin(ctx context.Context, kind, tool string) (context.Context, *auditCall) {
+	if a == nil || !a.enabled() {
+		return ctx, nil
+	}
+	call := &auditCall{
+		log:    a,
+		kind:   kind,
+		tool:   tool,
+		start:  time.Now(),
+		hashed: make(map[string]bool),
+		paths:  make(map[string]map[string]bool),
+		read:   make(map[string]map[string]bool),
+	}
+	return context.WithValue(ctx, auditKey{}, call), call
+}
+
+// auditCallFrom returns the audit of the call ctx belongs to, or nil
+func auditCallFrom(ctx context.Context) *auditCall {
+	c, _ := ctx.Value(auditKey{}).(*auditCall)
+	return c
+}
+
+// open records a repository opened by the call and returns fs wrapped to record its use
+func (c *auditCall) open(repo *backends.Repository, fs backends.FileSystem) backends.FileSystem {
+	if c == nil {
+		return fs
+	}
+	c.mu.Lock()
+	c.hashed[repo.Name] = repo.AuditHashPaths
+	c.mu.Unlock()
+	return &auditFS{FileSystem: fs, call: c, repo: repo.Name}
+}
+
+// record notes a path used in a repository, and the bytes read from it if it was read
+func (c *auditCall) record(repo, p string, read bool, n int) {
+	p = filepath.ToSlash(filepath.Clean(p))
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.bytesRead += int64(n)
+	set := c.paths
+	if read {
+		set = c.read
+	}
+	if set[repo][p] {
+		return
+	}
+	if c.recorded >= maxAuditPaths {
+		c.omitted++
+		return
+	}
+	if set[repo] == nil {
+		set[repo] = make(map[string]bool)
+	}
+	set[repo][p] = true
+	c.recorded++
+}
+
+// finishTool writes the record of a tool call. status is "" unless the call timed out or
+// was cancelled.
+func (c *auditCall) finishTool(result *mcp.CallToolResult, err error, status string) {
+	if c == nil {
+		return
+	}
+	message := ""
+	switch {
+	case err != nil:
+		message = err.Error()
+	case result != nil && result.IsError:
+		for _, content := range result.Content {
+			if text, ok := content.(mcp.TextContent); ok {
+				message = text.Text
+				break
+			}
+		}
+	}
+	if status == "" {
+		status = "ok"
+		if message != "" {
+			status = "error"
+		}
+	}
+	var returned interface{}
+	if result != nil {
+		returned = result.Content
+	}
+	c.finish(returned, status, message)
+}
+
+// finishResource writes the record of a resource read
+func (c *auditCall) finishResource(contents []interface{}, err error) {
+	if c == nil {
+		return
+	}
+	if err != nil {
+		c.finish(nil, "error", err.Error())
+		return
+	}
+	c.finish(contents, "ok", "")
+}
+
+func (c *auditCall) finish(returned interface{}, status, message string) {
+	rec := &auditRecord{
+		Time:       c.start.UTC(),
+		Kind:       c.kind,
+		Tool:       c.tool,
+		Status:     status,
+		DurationMS: time.Since(c.start).Milliseconds(),
+	}
+	if c.log.peer != nil {
+		rec.Session, rec.Client = c.log.peer()
+	}
+	if returned != nil {
+		if data, err := json.Marshal(returned); err == nil {
+			rec.BytesReturned = int64(len(data))
+		}
+	}
+
+	c.mu.Lock()
+	sensitive := false
+	for repo, hashed := range c.hashed {
+		rec.Repos = append(rec.Repos, repo)
+		sensitive = sensitive || hashed
+	}
+	sort.Strings(rec.Repos)
+	rec.Paths = c.listPaths(c.paths)
+	rec.Read = c.listPaths(c.read)
+	rec.PathsOmitted = c.omitted
+	rec.BytesRead = c.bytesRead
+	c.mu.Unlock()
+
+	// Error messages usually name the path, so they are left out for sensitive repositories
+	if !sensitive {
+		rec.Error = message
+	}
+	c.log.write(rec)
+}
+
+// listPaths sorts recorded paths, hashing those of repositories with audit_hash_paths.
+// c.mu must be held.
+func (c *auditCall) listPaths(byRepo map[string]map[string]bool) map[string][]string {
+	if len(byRepo) == 0 {
+		return nil
+	}
+	lists := make(map[string][]string, len(byRepo))
+	for repo, set := range byRepo {
+		list := make([]string, 0, len(set))
+		for p := range set {
+			if c.hashed[repo] {
+				p = c.log.hash(p)
+			}
+			list = append(list, p)
+		}
+		sort.Strings(list)
+		lists[repo] = list
+	}
+	return lists
+}
+
+// auditFS records the paths a call uses and the files it reads
+type auditFS struct {
+	backends.FileSystem
+	call *auditCall
+	repo string
+}
+
+func (a *auditFS) ReadFile(ctx context.Context, p string) ([]byte, error) {
+	data, err := a.FileSystem.ReadFile(ctx, p)
+	if err == nil {
+		a.call.record(a.repo, p, true, len(data))
+	}
+	return data, err
+}
+
+func (a *auditFS) ReadDir(ctx context.Context, p string) ([]fs.DirEntry, error) {
+	a.call.record(a.repo, p, false, 0)
+	return a.FileSystem.ReadDir(ctx, p)
+}
+
+func (a *auditFS) Stat(ctx context.Context, p string) (fs.FileInfo, error) {
+	a.call.record(a.repo, p, false, 0)
+	return a.FileSystem.Stat(ctx, p)
+}
+
+func (a *auditFS) Readlink(ctx context.Context, p string) (string, error) {
+	a.call.record(a.repo, p, false, 0)
+	return a.FileSystem.Readlink(ctx, p)
+}
+
+// Walk records every path it visits, as the call may list all of them. Beyond
+// maxAuditPaths they are only counted, under paths_omitted.
+func (a *auditFS) Walk(ctx context.Context, root string, fn filepath.WalkFunc) error {
+	a.call.record(a.repo, root, false, 0)
+	basePath := a.BasePath()
+	return a.FileSystem.Walk(ctx, root, func(p string, info fs.FileInfo, err error) error {
+		if rel, relErr := filepath.Rel(basePath, p); relErr == nil {
+			a.call.record(a.repo, rel, false, 0)
+		}
+		return fn(p, info, err)
+	})
+}
@@ -0,0 +1,250 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/mark3labs/mcp-go/mcp"
+
+	"github.com/vimalk78/fs-mcp/backends"
+)
+
+const (
+	// defaultReadBudget is the total number of content bytes read_files returns by default
+	defaultReadBudget = 256 * 1024
+	// maxBatchFiles bounds the number of entries in one read_files call
+	maxBatchFiles = 100
+	// batchReadConcurrency bounds how many files are read at once
+	batchReadConcurrency = 8
+)
+
+// batchEntry is one requested file in a read_files call
+type batchEntry struct {
+	repo      string
+	file      string
+	startLine int
+	endLine   int
+}
+
+// batchResult is the outcome of reading one batchEntry
+type batchResult struct {
+	Repository string `json:"repository"`
+	File       string `json:"file"`
+	Content    string `json:"content,omitempty"`
+	StartLine  int    `json:"start_line,omitempty"`
+	EndLine    int    `json:"end_line,omitempty"`
+	TotalLines int    `json:"total_lines,omitempty"`
+	Truncated  bool   `json:"truncated,omitempty"`
+	MIMEType   string `json:"mime_type,omitempty"`
+	Encoding   string `json:"encoding,omitempty"`
+	LineEnding string `json:"line_ending,omitempty"`
+	Binary     bool   `json:"binary,omitempty"`
+	Size       int    `json:"size,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// parseBatchEntries parses the files argument, filling in repo from defaultRepo when omitted
+func parseBatchEntries(arguments map[string]interface{}) ([]batchEntry, error) {
+	raw, ok := arguments["files"].([]interface{})
+	if !ok || len(raw) == 0 {
+		return nil, fmt.Errorf("files parameter is required")
+	}
+	if len(raw) > maxBatchFiles {
+		return nil, fmt.Errorf("too many files: %d (maximum %d)", len(raw), maxBatchFiles)
+	}
+
+	defaultRepo, _ := arguments["repo"].(string)
+	entries := make([]batchEntry, len(raw))
+	for i, item := range raw {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("files[%d] must be an object", i)
+		}
+		e := batchEntry{repo: defaultRepo}
+		if repo, ok := m["repo"].(string); ok && repo != "" {
+			e.repo = repo
+		}
+		if e.repo == "" {
+			return nil, fmt.Errorf("files[%d]: repo is required", i)
+		}
+		e.file, ok = m["file"].(string)
+		if !ok || e.file == "" {
+			return nil, fmt.Errorf("files[%d]: file is required", i)
+		}
+		e.startLine = intArgument(m, "start_line", 0)
+		e.endLine = intArgument(m, "end_line", 0)
+		if e.startLine < 0 || e.endLine < 0 {
+			return nil, fmt.Errorf("files[%d]: start_line and end_line must be positive", i)
+		}
+		entries[i] = e
+	}
+	return entries, nil
+}
+
+// readBatch reads every entry concurrently. Each repository is resolved once, so SSH
+// repositories only check their connection once per call.
+func (s *Server) readBatch(ctx context.Context, entries []batchEntry) []batchResult {
+	type resolved struct {
+		fs  backends.FileSystem
+		err error
+	}
+	filesystems := make(map[string]resolved)
+	for _, e := range entries {
+		if _, ok := filesystems[e.repo]; !ok {
+			fs, err := s.FileSystem(ctx, e.repo)
+			filesystems[e.repo] = resolved{fs, err}
+		}
+	}
+
+	results := make([]batchResult, len(entries))
+	sem := make(chan struct{}, batchReadConcurrency)
+	var wg sync.WaitGroup
+	for i, e := range entries {
+		wg.Add(1)
+		go func(i int, e batchEntry) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			r := batchResult{Repository: e.repo, File: e.file}
+			defer func() { results[i] = r }()
+
+			fsys := filesystems[e.repo]
+			if fsys.err != nil {
+				r.Error = fsys.err.Error()
+				return
+			}
+			relPath, content, err := readRepoFile(ctx, fsys.fs, e.file)
+			if err != nil {
+				r.Error = err.Error()
+				return
+			}
+			// Binary files are only described; read_file returns their data
+			decoded := decodeContent(relPath, content)
+			r.MIMEType = decoded.MIMEType
+			if decoded.Binary {
+				r.Binary, r.Size = true, len(content)
+				return
+			}
+			r.Encoding, r.LineEnding = decoded.Encoding, decoded.LineEnding
+
+			text, first, last, total := sliceLines([]byte(decoded.Text), e.startLine, e.endLine)
+			if first > last && total > 0 {
+				r.Error = fmt.Sprintf("start_line %d is past the end of the file (%d lines)", first, total)
+				return
+			}
+			r.Content, r.StartLine, r.EndLine, r.TotalLines = text, first, last, total
+		}(i, e)
+	}
+	wg.Wait()
+	return results
+}
+
+// fairShares splits budget across sizes max-min fairly: files smaller than an equal share
+// get everything they need and the remainder is divided among the larger ones, so no
+// file is dropped entirely because earlier files used up the budget
+func fairShares(sizes []int, budget int) []int {
+	order := make([]int, len(sizes))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool { return sizes[order[a]] < sizes[order[b]] })
+
+	shares := make([]int, len(sizes))
+	remaining := budget
+	for n, i := range order {
+		share := remaining / (len(order) - n)
+		if sizes[i] < share {
+			share = sizes[i]
+		}
+		shares[i] = share
+		remaining -= share
+	}
+	return shares
+}
+
+// truncateContent cuts content to at most limit bytes, preferring to end on a line
+// boundary, and returns the cut content and the number of lines it spans
+func truncateContent(content string, limit int) (string, int) {
+	cut := content[:limit]
+	if i := strings.LastIndexByte(cut, '\n'); i >= 0 {
+		cut = cut[:i+1]
+		return cut, strings.Count(cut, "\n")
+	}
+	// A single line longer than the share: cut it without splitting a UTF-8 sequence
+	for len(cut) > 0 && !utf8.ValidString(cut) {
+		cut = cut[:len(cut)-1]
+	}
+	if cut == "" {
+		return "", 0
+	}
+	return cut, 1
+}
+
+// applyBudget truncates results so their content fits within budget bytes in total
+func applyBudget(results []batchResult, budget int) {
+	sizes := make([]int, len(results))
+	total := 0
+	for i, r := range results {
+		sizes[i] = len(r.Content)
+		total += sizes[i]
+	}
+	if total <= budget {
+		return
+	}
+
+	for i, share := range fairShares(sizes, budget) {
+		r := &results[i]
+		if share >= len(r.Content) {
+			continue
+		}
+		content, lines := truncateContent(r.Content, share)
+		r.Content = content
+		r.EndLine = r.StartLine + lines - 1
+		if lines == 0 {
+			// Nothing fit: there's no range to report, and start_line is where to continue
+			r.EndLine = 0
+		}
+		r.Truncated = true
+	}
+}
+
+func (s *Server) handleReadFiles(ctx context.Context, arguments map[string]interface{}) (*mcp.CallToolResult, error) {
+	entries, err := parseBatchEntries(arguments)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	budget := intArgument(arguments, "max_bytes", defaultReadBudget)
+	if budget <= 0 {
+		return mcp.NewToolResultError("max_bytes must be positive"), nil
+	}
+
+	results := s.readBatch(ctx, entries)
+	applyBudget(results, budget)
+
+	returned, failed := 0, 0
+	for _, r := range results {
+		returned += len(r.Content)
+		if r.Error != "" {
+			failed++
+		}
+	}
+
+	result := map[string]interface{}{
+		"files":          results,
+		"bytes_returned": returned,
+		"max_bytes":      budget,
+	}
+	if failed > 0 {
+		result["failed"] = failed
+	}
+
+	jsonResult, _ := json.MarshalIndent(result, "", "  ")
+	return mcp.NewToolResultText(string(jsonResult)), nil
+}
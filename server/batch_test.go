@@ -0,0 +1,51 @@
+package server
+
+import "testing"
+
+func TestApplyBudget(t *testing.T) {
+	results := []batchResult{
+		{File: "small", Content: "one\n", StartLine: 1, EndLine: 1},
+		{File: "lines", Content: "first line\nsecond line\nthird line\n", StartLine: 5, EndLine: 7},
+		{File: "long line", Content: "a single line that is longer than its share\n", StartLine: 1, EndLine: 1},
+	}
+	applyBudget(results, 4+11+11)
+
+	want := []struct {
+		content   string
+		endLine   int
+		truncated bool
+	}{
+		{"one\n", 1, false},
+		{"first line\n", 5, true},
+		{"a single li", 1, true},
+	}
+	for i, w := range want {
+		r := results[i]
+		if r.Content != w.content || r.EndLine != w.endLine || r.Truncated != w.truncated {
+			t.Errorf("%s: content %q end_line %d truncated %v, want %q %d %v", r.File,
+				r.Content, r.EndLine, r.Truncated, w.content, w.endLine, w.truncated)
+		}
+	}
+}
+
+// TestApplyBudgetNothingFits checks that a file left with no room reports no range rather
+// than one that ends before it starts
+func TestApplyBudgetNothingFits(t *testing.T) {
+	results := []batchResult{
+		{File: "a", Content: "aaaa\n", StartLine: 5, EndLine: 5},
+		{File: "b", Content: "bbbb\n", StartLine: 5, EndLine: 5},
+	}
+	applyBudget(results, 1)
+	for _, r := range results {
+		if !r.Truncated {
+			t.Errorf("%s: not marked truncated", r.File)
+		}
+		if r.EndLine != 0 && r.EndLine < r.StartLine {
+			t.Errorf("%s: start_line %d end_line %d", r.File, r.StartLine, r.EndLine)
+		}
+	}
+	if r := results[0]; r.Content != "" || r.EndLine != 0 || r.StartLine != 5 {
+		t.Errorf("%s: content %q start_line %d end_line %d, want no content, start_line 5 and no end_line",
+			r.File, r.Content, r.StartLine, r.EndLine)
+	}
+}
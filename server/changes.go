@@ -0,0 +1,620 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/mark3labs/mcp-go/mcp"
+
+	"github.com/vimalk78/fs-mcp/backends"
+	"github.com/vimalk78/fs-mcp/policy"
+)
+
+const (
+	// maxJournalEntries bounds the events kept per repository; older tokens fall back to an mtime scan
+	maxJournalEntries = 50000
+	// maxSnapshots bounds the remote repository snapshots kept for token diffing
+	maxSnapshots = 16
+)
+
+// changeEpoch identifies this process, so tokens from a previous run are recognized
+var changeEpoch = func() string {
+	b := make([]byte, 6)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}()
+
+// changeToken is the decoded form of a watch_changes token
+type changeToken struct {
+	Repo     string    `json:"r"`
+	Epoch    string    `json:"e"`
+	Journal  string    `json:"j,omitempty"` // journal that issued Seq
+	Seq      uint64    `json:"q,omitempty"` // journal position, for local repositories
+	Snapshot string    `json:"s,omitempty"` // snapshot id, for remote repositories
+	Time     time.Time `json:"t"`           // when the token was issued
+
+	// A token returned with a truncated result continues it: it holds the start of the
+	// reported changes in Base and how many of them were already returned in Offset
+	Base   *changeToken `json:"b,omitempty"`
+	Offset int          `json:"o,omitempty"`
+}
+
+func encodeChangeToken(t changeToken) string {
+	data, _ := json.Marshal(t)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeChangeToken(token string) (*changeToken, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("invalid token: %s", token)
+	}
+	var t changeToken
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, fmt.Errorf("invalid token: %s", token)
+	}
+	return &t, nil
+}
+
+// changeSet accumulates the net effect of changes per path
+type changeSet map[string]string // path -> "created", "modified" or "deleted"
+
+// add folds one more change for a path into the set
+func (c changeSet) add(path, op string) {
+	prev, ok := c[path]
+	switch {
+	case !ok:
+		c[path] = op
+	case prev == "created" && op == "deleted":
+		delete(c, path)
+	case prev == "created":
+		// Still new, however often it was written since
+	case prev == "deleted" && op != "deleted":
+		c[path] = "modified"
+	default:
+		c[path] = op
+	}
+}
+
+// lists returns the sorted created, modified and deleted paths
+func (c changeSet) lists() (created, modified, deleted []string) {
+	created, modified, deleted = []string{}, []string{}, []string{}
+	for path, op := range c {
+		switch op {
+		case "created":
+			created = append(created, path)
+		case "modified":
+			modified = append(modified, path)
+		case "deleted":
+			deleted = append(deleted, path)
+		}
+	}
+	for _, list := range [][]string{created, modified, deleted} {
+		sort.Slice(list, func(i, j int) bool { return comparePaths(list[i], list[j]) < 0 })
+	}
+	return created, modified, deleted
+}
+
+// changeEvent is one journaled file system change
+type changeEvent struct {
+	seq  uint64
+	path string
+	op   string
+	time time.Time
+}
+
+// changeJournal records the changes to a local repository as fsnotify reports them
+type changeJournal struct {
+	repo    string
+	id      string // distinguishes journals of one repository, as each numbers its events from 1
+	key     string // the repository's Key() when the journal started
+	mu      sync.Mutex
+	horizon time.Time // changes after this time are all in the journal
+	events  []changeEvent
+	nextSeq uint64
+	stop    chan struct{}
+
+	// Files and watched directories known to exist, so that removing or moving away a
+	// directory can be journaled as the deletion of the files in it. Only used by
+	// addWatches and run.
+	files map[string]bool
+	dirs  map[string]bool
+}
+
+// changeJournalCache holds one running journal per local repository
+type changeJournalCache struct {
+	mu       sync.Mutex
+	journals map[string]*changeJournal
+	started  uint64
+}
+
+// get returns the journal for a local repository, starting it on first use or when the
+// repository has moved
+func (c *changeJournalCache) get(repo *backends.Repository, fs backends.FileSystem) (*changeJournal, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := repo.Key()
+	if j, ok := c.journals[repo.Name]; ok {
+		if j.key == key {
+			return j, nil
+		}
+		close(j.stop)
+		delete(c.journals, repo.Name)
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	c.started++
+	j := &changeJournal{
+		repo:    repo.Name,
+		id:      fmt.Sprintf("%d", c.started),
+		key:     key,
+		horizon: time.Now(),
+		nextSeq: 1,
+		stop:    make(chan struct{}),
+		files:   make(map[string]bool),
+		dirs:    make(map[string]bool),
+	}
+	j.addWatches(watcher, fs.BasePath(), fs.BasePath(), false)
+	go j.run(watcher, fs.BasePath())
+	c.journals[repo.Name] = j
+	return j, nil
+}
+
+// sync stops the journals of repositories that were removed or changed (called when the
+// config is reloaded); the others keep their history
+func (c *changeJournalCache) sync(repositories map[string]*backends.Repository) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for name, j := range c.journals {
+		if repo, ok := repositories[name]; !ok || repo.Key() != j.key {
+			close(j.stop)
+			delete(c.journals, name)
+		}
+	}
+}
+
+// record appends an event, dropping the oldest once the journal is full
+func (j *changeJournal) record(path, op string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.events = append(j.events, changeEvent{seq: j.nextSeq, path: path, op: op, time: time.Now()})
+	j.nextSeq++
+	if len(j.events) > maxJournalEntries {
+		dropped := len(j.events) - maxJournalEntries
+		j.horizon = j.events[dropped-1].time
+		j.events = append([]changeEvent(nil), j.events[dropped:]...)
+	}
+}
+
+// position returns the sequence number of the latest journaled change
+func (j *changeJournal) position() uint64 {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.nextSeq - 1
+}
+
+// addWatches watches root and every directory below it. When created is set, files found
+// are journaled as created, since they may have appeared before the watch was in place.
+func (j *changeJournal) addWatches(watcher *fsnotify.Watcher, basePath, root string, created bool) {
+	filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if path != basePath && policy.ShouldSkip(path) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(basePath, path)
+		if err != nil {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		if !info.IsDir() {
+			j.files[rel] = true
+			if created {
+				j.record(rel, "created")
+			}
+			return nil
+		}
+		if err := watcher.Add(path); err != nil {
+			log.Printf("Failed to watch %s for changes: %v", path, err)
+			return filepath.SkipDir
+		}
+		j.dirs[rel] = true
+		return nil
+	})
+}
+
+// removed journals the removal of a path. A directory's files are deleted with it, but
+// only the directory itself is reported when it is moved away or its children's events
+// are lost, so each file still known below it is journaled as deleted.
+func (j *changeJournal) removed(rel string) {
+	if j.files[rel] {
+		delete(j.files, rel)
+		j.record(rel, "deleted")
+		return
+	}
+	if !j.dirs[rel] {
+		return
+	}
+	delete(j.dirs, rel)
+	prefix := rel + "/"
+	for dir := range j.dirs {
+		if strings.HasPrefix(dir, prefix) {
+			delete(j.dirs, dir)
+		}
+	}
+	var deleted []string
+	for file := range j.files {
+		if strings.HasPrefix(file, prefix) {
+			deleted = append(deleted, file)
+		}
+	}
+	sort.Strings(deleted)
+	for _, file := range deleted {
+		delete(j.files, file)
+		j.record(file, "deleted")
+	}
+}
+
+func (j *changeJournal) run(watcher *fsnotify.Watcher, basePath string) {
+	defer watcher.Close()
+	for {
+		select {
+		case <-j.stop:
+			return
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			rel, err := filepath.Rel(basePath, event.Name)
+			if err != nil || rel == "." || policy.ShouldSkip(event.Name) {
+				continue
+			}
+			rel = filepath.ToSlash(rel)
+
+			switch {
+			case event.Op&fsnotify.Create != 0:
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					j.addWatches(watcher, basePath, event.Name, true)
+					continue
+				}
+				j.files[rel] = true
+				j.record(rel, "created")
+			case event.Op&(fsnotify.Remove|fsnotify.Rename) != 0:
+				j.removed(rel)
+			case event.Op&fsnotify.Write != 0:
+				j.files[rel] = true
+				j.record(rel, "modified")
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("Change journal watcher error for %s: %v", j.repo, err)
+		}
+	}
+}
+
+// between returns the changes after journal position from up to and including to, or
+// ok=false if the journal no longer reaches back that far
+func (j *changeJournal) between(from, to uint64) (changeSet, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if from > to || to >= j.nextSeq || len(j.events) > 0 && j.events[0].seq > from+1 {
+		return nil, false
+	}
+	changes := changeSet{}
+	for _, e := range j.events {
+		if e.seq > from && e.seq <= to {
+			changes.add(e.path, e.op)
+		}
+	}
+	return changes, true
+}
+
+// seqAt returns the journal position as of time t, or ok=false if the journal started later
+func (j *changeJournal) seqAt(t time.Time) (uint64, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if t.Before(j.horizon) {
+		return 0, false
+	}
+	seq := j.nextSeq - 1
+	for i := len(j.events) - 1; i >= 0 && j.events[i].time.After(t); i-- {
+		seq = j.events[i].seq - 1
+	}
+	return seq, true
+}
+
+// fileStamp is what a snapshot records per file
+type fileStamp struct {
+	size    int64
+	modTime time.Time
+}
+
+// repoSnapshot is the state of a remote repository's files at one point in time
+type repoSnapshot struct {
+	id    string
+	repo  string
+	files map[string]fileStamp
+}
+
+// snapshotStore keeps the most recent snapshots so tokens can be diffed against them
+type snapshotStore struct {
+	mu        sync.Mutex
+	snapshots map[string]*repoSnapshot
+	order     []string
+	next      int
+}
+
+// add stores a snapshot, evicting the oldest beyond maxSnapshots, and returns its id
+func (s *snapshotStore) add(snap *repoSnapshot) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.next++
+	snap.id = fmt.Sprintf("%d", s.next)
+	s.snapshots[snap.id] = snap
+	s.order = append(s.order, snap.id)
+	if len(s.order) > maxSnapshots {
+		delete(s.snapshots, s.order[0])
+		s.order = s.order[1:]
+	}
+	return snap.id
+}
+
+func (s *snapshotStore) get(id string) *repoSnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.snapshots[id]
+}
+
+// takeSnapshot walks a repository recording every file's size and mtime
+func takeSnapshot(ctx context.Context, repo string, fs backends.FileSystem) (*repoSnapshot, error) {
+	snap := &repoSnapshot{repo: repo, files: make(map[string]fileStamp)}
+	basePath := fs.BasePath()
+	err := fs.Walk(ctx, ".", func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == basePath {
+			return nil
+		}
+		if policy.ShouldSkip(path) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, _ := filepath.Rel(basePath, path)
+		snap.files[filepath.ToSlash(rel)] = fileStamp{size: info.Size(), modTime: info.ModTime()}
+		return nil
+	})
+	return snap, err
+}
+
+// diffSnapshots compares two snapshots of the same repository
+func diffSnapshots(old, cur *repoSnapshot) changeSet {
+	changes := changeSet{}
+	for path, stamp := range cur.files {
+		prev, ok := old.files[path]
+		switch {
+		case !ok:
+			changes.add(path, "created")
+		case prev.size != stamp.size || !prev.modTime.Equal(stamp.modTime):
+			changes.add(path, "modified")
+		}
+	}
+	for path := range old.files {
+		if _, ok := cur.files[path]; !ok {
+			changes.add(path, "deleted")
+		}
+	}
+	return changes
+}
+
+// modifiedSince reports files whose mtime is after t. Without a baseline, creations can't be
+// told from modifications and deletions can't be seen, so everything is "modified".
+func modifiedSince(snap *repoSnapshot, t time.Time) changeSet {
+	changes := changeSet{}
+	for path, stamp := range snap.files {
+		if stamp.modTime.After(t) {
+			changes.add(path, "modified")
+		}
+	}
+	return changes
+}
+
+// truncateChanges keeps the first limit paths across the lists, in order
+func truncateChanges(limit int, lists ...[]string) ([]string, []string, []string) {
+	return pageChanges(0, limit, lists...)
+}
+
+// pageChanges skips the first offset paths across the lists, in order, and keeps the next limit
+func pageChanges(offset, limit int, lists ...[]string) ([]string, []string, []string) {
+	for i, list := range lists {
+		skip := offset
+		if skip > len(list) {
+			skip = len(list)
+		}
+		list = list[skip:]
+		offset -= skip
+		if len(list) > limit {
+			list = list[:limit]
+		}
+		limit -= len(list)
+		lists[i] = list
+	}
+	return lists[0], lists[1], lists[2]
+}
+
+func (s *Server) handleWatchChanges(ctx context.Context, arguments map[string]interface{}) (*mcp.CallToolResult, error) {
+	repo, ok := arguments["repo"].(string)
+	if !ok {
+		return mcp.NewToolResultError("repo parameter is required"), nil
+	}
+
+	var since time.Time
+	if value, ok := arguments["since"].(string); ok && value != "" {
+		t, err := parseModifiedSince(value)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("invalid since: %s (expected RFC 3339 timestamp or duration like '1h')", value)), nil
+		}
+		since = t
+	}
+
+	var token *changeToken
+	if value, ok := arguments["token"].(string); ok && value != "" {
+		t, err := decodeChangeToken(value)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		if t.Repo != repo {
+			return mcp.NewToolResultError(fmt.Sprintf("token belongs to repository %s, not %s", t.Repo, repo)), nil
+		}
+		token = t
+	}
+
+	repository, ok := s.repository(repo)
+	if !ok {
+		return mcp.NewToolResultError(fmt.Sprintf("unknown repository: %s", repo)), nil
+	}
+	fs, err := s.FileSystem(ctx, repo)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	// The changes reported are those from base to end. A continuation token fixes both, so
+	// that the rest of a truncated result is the same set of changes; otherwise end is now.
+	now := time.Now()
+	end := changeToken{Repo: repo, Epoch: changeEpoch, Time: now}
+	var base *changeToken
+	offset := 0
+	continuing := false
+	switch {
+	case token != nil && token.Base != nil && token.Epoch == changeEpoch:
+		end, base, offset, continuing = *token, token.Base, token.Offset, true
+		end.Base, end.Offset = nil, 0
+	case token != nil && token.Base != nil:
+		base = token.Base
+	case token != nil:
+		base = token
+	case !since.IsZero():
+		base = &changeToken{Repo: repo, Time: since}
+	}
+
+	var changes changeSet
+	complete := true
+	exact := false // whether the changes come from a journal or a snapshot diff
+	var journal *changeJournal
+
+	if fs.Type() == "local" {
+		journal, err = s.changeJournals.get(repository, fs)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to watch repository: %v", err)), nil
+		}
+		if !continuing {
+			end.Journal, end.Seq = journal.id, journal.position()
+		}
+		if base != nil && base.Epoch == "" {
+			// A since time becomes a journal position if the journal reaches back to it
+			if seq, ok := journal.seqAt(base.Time); ok {
+				base.Epoch, base.Journal, base.Seq = changeEpoch, journal.id, seq
+			}
+		}
+		switch {
+		case base == nil:
+			changes, exact = changeSet{}, true
+		case base.Epoch == changeEpoch && base.Journal == journal.id && end.Journal == journal.id:
+			changes, exact = journal.between(base.Seq, end.Seq)
+		}
+	}
+
+	if !exact {
+		// Remote repositories, and local ones whose journal doesn't reach back far enough,
+		// compare against a snapshot or fall back to modification times
+		var snap *repoSnapshot
+		if continuing && end.Snapshot != "" {
+			snap = s.changeSnapshots.get(end.Snapshot)
+		}
+		if snap == nil {
+			snap, err = takeSnapshot(ctx, repo, fs)
+			if err != nil {
+				return mcp.NewToolResultError(fmt.Sprintf("Failed to scan repository: %v", err)), nil
+			}
+			if continuing {
+				// The end of the truncated result was evicted, so report everything since base
+				// again rather than skip what wasn't returned yet
+				end = changeToken{Repo: repo, Epoch: changeEpoch, Time: now}
+				if journal != nil {
+					end.Journal, end.Seq = journal.id, journal.position()
+				}
+				offset = 0
+			}
+			end.Snapshot = s.changeSnapshots.add(snap)
+		}
+
+		var old *repoSnapshot
+		if base != nil && base.Epoch == changeEpoch && base.Snapshot != "" {
+			old = s.changeSnapshots.get(base.Snapshot)
+		}
+		switch {
+		case old != nil:
+			changes = diffSnapshots(old, snap)
+		case base != nil:
+			changes, complete = modifiedSince(snap, base.Time), false
+		default:
+			changes = changeSet{}
+		}
+	}
+
+	created, modified, deleted := changes.lists()
+	total := len(created) + len(modified) + len(deleted)
+	limit := s.resultLimit(repo, arguments)
+	created, modified, deleted = pageChanges(offset, limit, created, modified, deleted)
+	truncated := offset+limit < total
+	next := end
+	if truncated {
+		next.Base, next.Offset = base, offset+limit
+	}
+
+	result := map[string]interface{}{
+		"repository": repo,
+		"created":    created,
+		"modified":   modified,
+		"deleted":    deleted,
+		"complete":   complete,
+		"token":      encodeChangeToken(next),
+		"as_of":      end.Time.Format(time.RFC3339),
+	}
+	if truncated {
+		result["truncated"] = true
+		result["total"] = total
+	}
+	if !complete {
+		result["note"] = "No change history reaches back that far; files are reported by modification time, so new files appear as modified and deletions are not listed"
+	}
+
+	jsonResult, _ := json.MarshalIndent(result, "", "  ")
+	return mcp.NewToolResultText(string(jsonResult)), nil
+}
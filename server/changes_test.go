@@ -0,0 +1,82 @@
+package server
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/vimalk78/fs-mcp/backends"
+)
+
+// TestChangeJournalRemovedDirectory checks that a non-empty directory that is removed, or
+// moved out of the repository, is journaled as the deletion of each file in it, as a
+// snapshot diff would report it
+func TestChangeJournalRemovedDirectory(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		remove func(dir string) error
+	}{
+		{"removed", os.RemoveAll},
+		{"moved away", func(dir string) error {
+			return os.Rename(dir, filepath.Join(t.TempDir(), "moved"))
+		}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			for _, name := range []string{"keep.txt", "dir/a.txt", "dir/sub/b.txt", "dir/sub/deeper/c.txt"} {
+				p := filepath.Join(root, filepath.FromSlash(name))
+				if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(p, []byte(name), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			raw, _ := json.Marshal(root)
+			repo, err := backends.ParseRepository("r", raw, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			journals := &changeJournalCache{journals: make(map[string]*changeJournal)}
+			defer journals.sync(nil)
+			j, err := journals.get(repo, backends.NewLocalFS(root))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// A file created after the journal started is known too
+			if err := os.WriteFile(filepath.Join(root, "dir", "new.txt"), nil, 0644); err != nil {
+				t.Fatal(err)
+			}
+			waitForChanges(t, j, 0, map[string]string{"dir/new.txt": "created"})
+
+			start := j.position()
+			if err := tt.remove(filepath.Join(root, "dir")); err != nil {
+				t.Fatal(err)
+			}
+			want := map[string]string{
+				"dir/a.txt":            "deleted",
+				"dir/new.txt":          "deleted",
+				"dir/sub/b.txt":        "deleted",
+				"dir/sub/deeper/c.txt": "deleted",
+			}
+			waitForChanges(t, j, start, want)
+		})
+	}
+}
+
+// waitForChanges waits until the changes journaled after position start are want
+func waitForChanges(t *testing.T, j *changeJournal, start uint64, want map[string]string) {
+	t.Helper()
+	var got changeSet
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		got, _ = j.between(start, j.position())
+		if reflect.DeepEqual(map[string]string(got), want) {
+			return
+		}
+	}
+	t.Fatalf("journaled changes = %v, want %v", got, want)
+}
@@ -0,0 +1,333 @@
+package server
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"os"
+	"path/filepath"
+
+	"github.com/mark3labs/mcp-go/mcp"
+
+	"github.com/vimalk78/fs-mcp/backends"
+	"github.com/vimalk78/fs-mcp/policy"
+)
+
+// newHash returns a hash for the given algorithm name
+func newHash(algorithm string) (hash.Hash, error) {
+	switch algorithm {
+	case "sha256", "":
+		return sha256.New(), nil
+	case "sha1":
+		return sha1.New(), nil
+	case "md5":
+		return md5.New(), nil
+	}
+	return nil, fmt.Errorf("unsupported algorithm: %s (expected sha256, sha1 or md5)", algorithm)
+}
+
+// hashBytes returns the hex digest of data
+func hashBytes(algorithm string, data []byte) (string, error) {
+	h, err := newHash(algorithm)
+	if err != nil {
+		return "", err
+	}
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (s *Server) handleHashFile(ctx context.Context, arguments map[string]interface{}) (*mcp.CallToolResult, error) {
+	repo, ok := arguments["repo"].(string)
+	if !ok {
+		return mcp.NewToolResultError("repo parameter is required"), nil
+	}
+
+	file, ok := arguments["file"].(string)
+	if !ok {
+		return mcp.NewToolResultError("file parameter is required"), nil
+	}
+
+	algorithm, _ := arguments["algorithm"].(string)
+	if algorithm == "" {
+		algorithm = "sha256"
+	}
+
+	startLine := intArgument(arguments, "start_line", 0)
+	endLine := intArgument(arguments, "end_line", 0)
+	if startLine < 0 || endLine < 0 {
+		return mcp.NewToolResultError("start_line and end_line must be positive"), nil
+	}
+
+	fs, err := s.FileSystem(ctx, repo)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	_, content, err := readRepoFile(ctx, fs, file)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	result := map[string]interface{}{
+		"repository": repo,
+		"file":       file,
+		"algorithm":  algorithm,
+		"size":       len(content),
+	}
+
+	// Line ranges hash the raw bytes of those lines, including their line terminators
+	data := content
+	if startLine > 0 || endLine > 0 {
+		text, first, last, total := sliceLines(content, startLine, endLine)
+		if first > last {
+			return mcp.NewToolResultError(fmt.Sprintf("start_line %d is past the end of the file (%d lines)", first, total)), nil
+		}
+		data = []byte(text)
+		result["start_line"] = first
+		result["end_line"] = last
+		result["total_lines"] = total
+		result["range_size"] = len(data)
+	}
+
+	digest, err := hashBytes(algorithm, data)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	result["hash"] = digest
+
+	jsonResult, _ := json.MarshalIndent(result, "", "  ")
+	return mcp.NewToolResultText(string(jsonResult)), nil
+}
+
+func (s *Server) handleDiffFiles(ctx context.Context, arguments map[string]interface{}) (*mcp.CallToolResult, error) {
+	repoA, ok := arguments["repo_a"].(string)
+	if !ok {
+		return mcp.NewToolResultError("repo_a parameter is required"), nil
+	}
+	fileA, ok := arguments["file_a"].(string)
+	if !ok {
+		return mcp.NewToolResultError("file_a parameter is required"), nil
+	}
+	repoB, _ := arguments["repo_b"].(string)
+	if repoB == "" {
+		repoB = repoA
+	}
+	fileB, ok := arguments["file_b"].(string)
+	if !ok {
+		return mcp.NewToolResultError("file_b parameter is required"), nil
+	}
+
+	contextLines := intArgument(arguments, "context", defaultDiffContext)
+	if contextLines < 0 {
+		return mcp.NewToolResultError("context must not be negative"), nil
+	}
+
+	read := func(repo, file string) ([]byte, *decodedFile, error) {
+		fs, err := s.FileSystem(ctx, repo)
+		if err != nil {
+			return nil, nil, err
+		}
+		relPath, content, err := readRepoFile(ctx, fs, file)
+		if err != nil {
+			return nil, nil, err
+		}
+		return content, decodeContent(relPath, content), nil
+	}
+
+	contentA, decodedA, err := read(repoA, fileA)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	contentB, decodedB, err := read(repoB, fileB)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	nameA := fmt.Sprintf("a/%s/%s", repoA, fileA)
+	nameB := fmt.Sprintf("b/%s/%s", repoB, fileB)
+
+	if string(contentA) == string(contentB) {
+		return mcp.NewToolResultText(fmt.Sprintf("Files %s and %s are identical", nameA, nameB)), nil
+	}
+	if decodedA.Binary || decodedB.Binary {
+		return mcp.NewToolResultText(fmt.Sprintf("Binary files %s and %s differ", nameA, nameB)), nil
+	}
+
+	ops, err := diffLines(splitLines(decodedA.Text), splitLines(decodedB.Text))
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	diff := unifiedDiff(nameA, nameB, ops, contextLines)
+	if diff == "" {
+		// Same text in different encodings
+		return mcp.NewToolResultText(fmt.Sprintf("Files %s (%s) and %s (%s) have the same text in different encodings",
+			nameA, decodedA.Encoding, nameB, decodedB.Encoding)), nil
+	}
+	return mcp.NewToolResultText(diff), nil
+}
+
+// listTree returns the size of every file below path, keyed by its path relative to it,
+// along with the validated path itself
+func listTree(ctx context.Context, fs backends.FileSystem, path string) (string, map[string]int64, error) {
+	root, err := policy.ValidatePath(fs.BasePath(), path)
+	if err != nil {
+		return "", nil, err
+	}
+	info, err := fs.Stat(ctx, root)
+	if err != nil {
+		return "", nil, statError(err, "Path does not exist: %s", path)
+	}
+	if !info.IsDir() {
+		return "", nil, fmt.Errorf("Path is not a directory: %s", path)
+	}
+
+	rootPath := filepath.Join(fs.BasePath(), root)
+	files := make(map[string]int64)
+	err = fs.Walk(ctx, root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == rootPath {
+			return nil
+		}
+		if policy.ShouldSkip(path) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, _ := filepath.Rel(rootPath, path)
+		files[filepath.ToSlash(rel)] = info.Size()
+		return nil
+	})
+	return root, files, err
+}
+
+// sameContent reports whether two files have identical content by their SHA-256
+func sameContent(ctx context.Context, fsA backends.FileSystem, pathA string, fsB backends.FileSystem, pathB string) (bool, error) {
+	contentA, err := fsA.ReadFile(ctx, pathA)
+	if err != nil {
+		return false, err
+	}
+	contentB, err := fsB.ReadFile(ctx, pathB)
+	if err != nil {
+		return false, err
+	}
+	return sha256.Sum256(contentA) == sha256.Sum256(contentB), nil
+}
+
+func (s *Server) handleCompareDirs(ctx context.Context, arguments map[string]interface{}) (*mcp.CallToolResult, error) {
+	repoA, ok := arguments["repo_a"].(string)
+	if !ok {
+		return mcp.NewToolResultError("repo_a parameter is required"), nil
+	}
+	repoB, _ := arguments["repo_b"].(string)
+	if repoB == "" {
+		repoB = repoA
+	}
+	pathA, _ := arguments["path_a"].(string)
+	if pathA == "" {
+		pathA = "."
+	}
+	pathB, _ := arguments["path_b"].(string)
+	if pathB == "" {
+		pathB = "."
+	}
+	if repoA == repoB && filepath.Clean(pathA) == filepath.Clean(pathB) {
+		return mcp.NewToolResultError("path_a and path_b refer to the same directory"), nil
+	}
+
+	compare, _ := arguments["compare"].(string)
+	switch compare {
+	case "":
+		compare = "content"
+	case "content", "size":
+	default:
+		return mcp.NewToolResultError(fmt.Sprintf("Invalid compare: %s (expected content or size)", compare)), nil
+	}
+
+	fsA, err := s.FileSystem(ctx, repoA)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	fsB, err := s.FileSystem(ctx, repoB)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	rootA, filesA, err := listTree(ctx, fsA, pathA)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	rootB, filesB, err := listTree(ctx, fsB, pathB)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	changes := changeSet{}
+	unchanged := 0
+	var errs []string
+	for rel, sizeA := range filesA {
+		sizeB, ok := filesB[rel]
+		switch {
+		case !ok:
+			changes.add(rel, "deleted")
+		case sizeA != sizeB:
+			changes.add(rel, "modified")
+		case compare == "size":
+			unchanged++
+		default:
+			same, err := sameContent(ctx, fsA, filepath.Join(rootA, rel), fsB, filepath.Join(rootB, rel))
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %v", rel, err))
+				continue
+			}
+			if same {
+				unchanged++
+			} else {
+				changes.add(rel, "modified")
+			}
+		}
+	}
+	for rel := range filesB {
+		if _, ok := filesA[rel]; !ok {
+			changes.add(rel, "created")
+		}
+	}
+
+	added, changed, removed := changes.lists()
+	total := len(added) + len(changed) + len(removed)
+	limit := s.resultLimit(repoA, arguments)
+	truncated := total > limit
+	if truncated {
+		added, changed, removed = truncateChanges(limit, added, changed, removed)
+	}
+
+	result := map[string]interface{}{
+		"a":         fmt.Sprintf("%s/%s", repoA, filepath.ToSlash(pathA)),
+		"b":         fmt.Sprintf("%s/%s", repoB, filepath.ToSlash(pathB)),
+		"compare":   compare,
+		"added":     added,
+		"removed":   removed,
+		"changed":   changed,
+		"unchanged": unchanged,
+		"identical": total == 0 && len(errs) == 0,
+	}
+	if truncated {
+		result["truncated"] = true
+		result["total"] = total
+	}
+	if len(errs) > 0 {
+		result["errors"] = errs
+	}
+
+	jsonResult, _ := json.MarshalIndent(result, "", "  ")
+	return mcp.NewToolResultText(string(jsonResult)), nil
+}
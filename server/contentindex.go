@@ -0,0 +1,509 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/vimalk78/fs-mcp/backends"
+	"github.com/vimalk78/fs-mcp/policy"
+)
+
+const (
+	// indexFormatVersion is bumped whenever the on-disk index layout changes
+	indexFormatVersion = 1
+	// indexMaxFileSize is the largest file added to a content index
+	indexMaxFileSize = defaultMaxContentFileSize
+	// defaultIndexRefresh is how often remote repositories are re-scanned for changes
+	defaultIndexRefresh = 5 * time.Minute
+	// indexSaveDelay batches incremental updates before the index is written to disk
+	indexSaveDelay = 30 * time.Second
+	// indexEventDelay batches file change events before they are applied
+	indexEventDelay = 500 * time.Millisecond
+)
+
+// indexedFile is the index entry for a single file
+type indexedFile struct {
+	Size     int64
+	ModTime  int64 // UnixNano
+	Binary   bool
+	Trigrams []uint32
+}
+
+// indexSnapshot is the on-disk form of a content index
+type indexSnapshot struct {
+	Version int
+	Key     string
+	Files   map[string]*indexedFile
+}
+
+// contentIndex is a trigram index of one repository's file contents
+type contentIndex struct {
+	repo     string
+	key      string // identifies the repository location, so renamed repos don't share stale data
+	cacheDir string
+	open     func(ctx context.Context, repoName string) (backends.FileSystem, error)
+
+	mu      sync.RWMutex
+	files   map[string]*indexedFile
+	state   string // "loading", "building", "ready" or "error"
+	built   bool   // a complete build has succeeded, so a failed refresh leaves a usable index
+	lastErr string
+	updated time.Time
+	dirty   bool
+
+	ctx  context.Context // cancelled when the index is stopped
+	stop context.CancelFunc
+}
+
+// contentIndexManager owns the content indexes of all repositories with indexing enabled
+type contentIndexManager struct {
+	mu      sync.Mutex
+	indexes map[string]*contentIndex
+	open    func(ctx context.Context, repoName string) (backends.FileSystem, error)
+}
+
+// indexCacheDir returns ~/.cache/fs-mcp/index
+func indexCacheDir() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(homeDir, ".cache", "fs-mcp", "index"), nil
+}
+
+// sync stops indexes for repositories that were removed or changed and starts indexes
+// for repositories that have indexing enabled (called whenever the config is loaded)
+func (m *contentIndexManager) sync(repositories map[string]*backends.Repository) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for name, idx := range m.indexes {
+		repo, ok := repositories[name]
+		if !ok || !repo.Index || repo.Key() != idx.key {
+			idx.stop()
+			delete(m.indexes, name)
+		}
+	}
+
+	cacheDir, err := indexCacheDir()
+	if err != nil {
+		log.Printf("Content indexing disabled: %v", err)
+		return
+	}
+
+	for name, repo := range repositories {
+		if !repo.Index {
+			continue
+		}
+		if _, ok := m.indexes[name]; ok {
+			continue
+		}
+		idx := &contentIndex{
+			repo:     name,
+			key:      repo.Key(),
+			open:     m.open,
+			cacheDir: cacheDir,
+			files:    make(map[string]*indexedFile),
+			state:    "loading",
+		}
+		idx.ctx, idx.stop = context.WithCancel(context.Background())
+		m.indexes[name] = idx
+
+		refresh := defaultIndexRefresh
+		if repo.IndexRefresh > 0 {
+			refresh = time.Duration(repo.IndexRefresh) * time.Second
+		}
+		go idx.run(repo.Type, refresh)
+	}
+}
+
+// get returns the index for a repository if indexing is enabled for it
+func (m *contentIndexManager) get(repoName string) *contentIndex {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.indexes[repoName]
+}
+
+// ready returns the index for a repository if it has finished its initial build
+func (m *contentIndexManager) ready(repoName string) *contentIndex {
+	idx := m.get(repoName)
+	if idx == nil {
+		return nil
+	}
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	if idx.state != "ready" {
+		return nil
+	}
+	return idx
+}
+
+// snapshotPath is where this index is persisted
+func (idx *contentIndex) snapshotPath() string {
+	sum := sha256.Sum256([]byte(idx.key))
+	return filepath.Join(idx.cacheDir, idx.repo+"-"+hex.EncodeToString(sum[:8])+".gob")
+}
+
+// run loads the persisted index, brings it up to date and then keeps it current:
+// with fsnotify for local repositories and by periodic re-scans for remote ones
+func (idx *contentIndex) run(repoType string, refresh time.Duration) {
+	idx.load()
+
+	idx.setState("building", nil)
+	if err := idx.refresh(idx.ctx); err != nil {
+		idx.setState("error", err)
+		log.Printf("Failed to build content index for %s: %v", idx.repo, err)
+	} else {
+		idx.setState("ready", nil)
+		idx.save()
+	}
+
+	if repoType == "local" || repoType == "" {
+		err := idx.watch()
+		if err == nil {
+			return
+		}
+		log.Printf("Failed to watch %s for index updates, falling back to polling: %v", idx.repo, err)
+	}
+
+	ticker := time.NewTicker(refresh)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-idx.ctx.Done():
+			return
+		case <-ticker.C:
+			if err := idx.refresh(idx.ctx); err != nil {
+				idx.setState("error", err)
+				continue
+			}
+			idx.setState("ready", nil)
+			idx.save()
+		}
+	}
+}
+
+// setState records the index state and last error
+func (idx *contentIndex) setState(state string, err error) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	// An index that was ready once stays usable while a later refresh fails. A build that
+	// fails partway without one leaves a partial index, which must not be searched.
+	switch {
+	case state == "ready":
+		idx.built = true
+	case state == "error" && idx.built:
+		state = "ready"
+	}
+	idx.state = state
+	idx.lastErr = ""
+	if err != nil {
+		idx.lastErr = err.Error()
+	}
+}
+
+// load reads a persisted snapshot, if one exists for this repository
+func (idx *contentIndex) load() {
+	f, err := os.Open(idx.snapshotPath())
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	var snap indexSnapshot
+	if err := gob.NewDecoder(f).Decode(&snap); err != nil || snap.Version != indexFormatVersion || snap.Key != idx.key {
+		return
+	}
+
+	idx.mu.Lock()
+	idx.files = snap.Files
+	idx.mu.Unlock()
+}
+
+// save writes the index to disk atomically
+func (idx *contentIndex) save() {
+	idx.mu.Lock()
+	snap := indexSnapshot{Version: indexFormatVersion, Key: idx.key, Files: idx.files}
+	idx.dirty = false
+	idx.updated = time.Now()
+
+	if err := os.MkdirAll(idx.cacheDir, 0o755); err != nil {
+		idx.mu.Unlock()
+		log.Printf("Failed to save content index for %s: %v", idx.repo, err)
+		return
+	}
+	path := idx.snapshotPath()
+	tmp, err := os.CreateTemp(idx.cacheDir, ".index-*")
+	if err == nil {
+		err = gob.NewEncoder(tmp).Encode(&snap)
+		tmp.Close()
+	}
+	idx.mu.Unlock()
+
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		if tmp != nil {
+			os.Remove(tmp.Name())
+		}
+		log.Printf("Failed to save content index for %s: %v", idx.repo, err)
+	}
+}
+
+// indexable reports whether a file should be in the content index
+func indexable(path string, info os.FileInfo) bool {
+	return info.Mode().IsRegular() && info.Size() <= indexMaxFileSize && !policy.ShouldSkip(path)
+}
+
+// indexFile reads a file and computes its index entry. Unreadable and binary files are
+// remembered as scanned but never returned as candidates.
+func indexFile(ctx context.Context, fs backends.FileSystem, rel string, info os.FileInfo) *indexedFile {
+	entry := &indexedFile{Size: info.Size(), ModTime: info.ModTime().UnixNano()}
+	content, err := fs.ReadFile(ctx, rel)
+	if err != nil || isBinary(content) {
+		entry.Binary = true
+		return entry
+	}
+	entry.Trigrams = extractTrigrams(content)
+	return entry
+}
+
+// refresh walks the repository and re-indexes files whose size or mtime changed,
+// dropping entries for files that no longer exist
+func (idx *contentIndex) refresh(ctx context.Context) error {
+	fs, err := idx.open(ctx, idx.repo)
+	if err != nil {
+		return err
+	}
+	basePath := fs.BasePath()
+
+	idx.mu.RLock()
+	known := make(map[string]*indexedFile, len(idx.files))
+	for path, entry := range idx.files {
+		known[path] = entry
+	}
+	idx.mu.RUnlock()
+
+	seen := make(map[string]bool, len(known))
+	err = fs.Walk(ctx, ".", func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == basePath {
+			return nil
+		}
+		if policy.ShouldSkip(path) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !indexable(path, info) {
+			return nil
+		}
+		rel, _ := filepath.Rel(basePath, path)
+		rel = filepath.ToSlash(rel)
+		seen[rel] = true
+
+		if entry, ok := known[rel]; ok && entry.Size == info.Size() && entry.ModTime == info.ModTime().UnixNano() {
+			return nil
+		}
+		entry := indexFile(ctx, fs, rel, info)
+		idx.mu.Lock()
+		idx.files[rel] = entry
+		idx.dirty = true
+		idx.mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	idx.mu.Lock()
+	for path := range idx.files {
+		if !seen[path] {
+			delete(idx.files, path)
+			idx.dirty = true
+		}
+	}
+	idx.mu.Unlock()
+	return nil
+}
+
+// watch keeps a local repository's index current from fsnotify events until stopped
+func (idx *contentIndex) watch() error {
+	ctx := idx.ctx
+	fs, err := idx.open(ctx, idx.repo)
+	if err != nil {
+		return err
+	}
+	basePath := fs.BasePath()
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	addWatches := func(root string) {
+		filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil || !info.IsDir() {
+				return nil
+			}
+			if path != basePath && policy.ShouldSkip(path) {
+				return filepath.SkipDir
+			}
+			if err := watcher.Add(path); err != nil {
+				log.Printf("Failed to watch %s for index updates: %v", path, err)
+				return filepath.SkipDir
+			}
+			return nil
+		})
+	}
+	addWatches(basePath)
+
+	pending := make(map[string]bool)
+	apply := time.NewTimer(indexEventDelay)
+	apply.Stop()
+	save := time.NewTicker(indexSaveDelay)
+	defer save.Stop()
+
+	for {
+		select {
+		case <-idx.ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if event.Op&fsnotify.Create != 0 {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					addWatches(event.Name)
+				}
+			}
+			pending[event.Name] = true
+			apply.Reset(indexEventDelay)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			log.Printf("Index watcher error for %s: %v", idx.repo, err)
+		case <-apply.C:
+			for path := range pending {
+				idx.update(ctx, fs, basePath, path)
+			}
+			pending = make(map[string]bool)
+		case <-save.C:
+			idx.mu.RLock()
+			dirty := idx.dirty
+			idx.mu.RUnlock()
+			if dirty {
+				idx.save()
+			}
+		}
+	}
+}
+
+// update re-indexes a single changed path; a removed or renamed directory drops every file below it
+func (idx *contentIndex) update(ctx context.Context, fs backends.FileSystem, basePath, fullPath string) {
+	rel, err := filepath.Rel(basePath, fullPath)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return
+	}
+	rel = filepath.ToSlash(rel)
+
+	info, err := os.Lstat(fullPath)
+	if err != nil {
+		idx.mu.Lock()
+		for path := range idx.files {
+			if path == rel || strings.HasPrefix(path, rel+"/") {
+				delete(idx.files, path)
+				idx.dirty = true
+			}
+		}
+		idx.mu.Unlock()
+		return
+	}
+
+	if info.IsDir() {
+		// New directories (e.g. a checkout or an unpacked archive) are scanned in full
+		filepath.Walk(fullPath, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return nil
+			}
+			if policy.ShouldSkip(path) {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !info.IsDir() {
+				idx.update(ctx, fs, basePath, path)
+			}
+			return nil
+		})
+		return
+	}
+
+	if !indexable(fullPath, info) {
+		return
+	}
+	entry := indexFile(ctx, fs, rel, info)
+	idx.mu.Lock()
+	idx.files[rel] = entry
+	idx.dirty = true
+	idx.mu.Unlock()
+}
+
+// candidates returns the indexed paths that may match q, in walk order
+func (idx *contentIndex) candidates(q *trigramQuery) []string {
+	idx.mu.RLock()
+	paths := make([]string, 0, len(idx.files))
+	for path, entry := range idx.files {
+		if !entry.Binary && q.matches(entry.Trigrams) {
+			paths = append(paths, path)
+		}
+	}
+	idx.mu.RUnlock()
+
+	sort.Slice(paths, func(i, j int) bool { return comparePaths(paths[i], paths[j]) < 0 })
+	return paths
+}
+
+// status reports the index state for list_repos
+func (idx *contentIndex) status() map[string]interface{} {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	entries := 0
+	for _, entry := range idx.files {
+		entries += len(entry.Trigrams)
+	}
+	status := map[string]interface{}{
+		"state":        idx.state,
+		"files":        len(idx.files),
+		"memory_bytes": entries * 4,
+	}
+	if info, err := os.Stat(idx.snapshotPath()); err == nil {
+		status["disk_bytes"] = info.Size()
+	}
+	if !idx.updated.IsZero() {
+		status["updated"] = idx.updated.UTC().Format(time.RFC3339)
+	}
+	if idx.lastErr != "" {
+		status["error"] = idx.lastErr
+	}
+	return status
+}
@@ -0,0 +1,422 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+
+	"github.com/vimalk78/fs-mcp/backends"
+	"github.com/vimalk78/fs-mcp/policy"
+)
+
+const (
+	// defaultMaxContentFileSize skips files larger than this when searching content
+	defaultMaxContentFileSize = 1 << 20
+	// maxContextLines caps the number of context lines around each content match
+	maxContextLines = 10
+	// maxMatchLineLength truncates long matching lines (e.g. minified files) in results
+	maxMatchLineLength = 500
+	// binarySniffLength is how many leading bytes are checked for NUL to detect binary files
+	binarySniffLength = 8000
+)
+
+// contentQuery holds the compiled criteria for search_content
+type contentQuery struct {
+	re          *regexp.Regexp
+	trigrams    *trigramQuery
+	include     []pathMatcher
+	exclude     []pathMatcher
+	context     int
+	maxFileSize int64
+}
+
+// contentMatch is a single matching line
+type contentMatch struct {
+	Repository string   `json:"repository,omitempty"`
+	Path       string   `json:"path"`
+	Line       int      `json:"line"`
+	Text       string   `json:"text"`
+	Before     []string `json:"before,omitempty"`
+	After      []string `json:"after,omitempty"`
+}
+
+// parseContentQuery builds a contentQuery from search_content arguments
+func parseContentQuery(arguments map[string]interface{}) (*contentQuery, error) {
+	pattern, ok := arguments["pattern"].(string)
+	if !ok || pattern == "" {
+		return nil, fmt.Errorf("pattern parameter is required")
+	}
+	if literal, _ := arguments["literal"].(bool); literal {
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	if ci, _ := arguments["case_insensitive"].(bool); ci {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regular expression: %w", err)
+	}
+
+	q := &contentQuery{
+		re:          re,
+		trigrams:    compileTrigramQuery(pattern),
+		context:     intArgument(arguments, "context", 0),
+		maxFileSize: int64(intArgument(arguments, "max_file_size", defaultMaxContentFileSize)),
+	}
+	if q.context < 0 {
+		q.context = 0
+	}
+	if q.context > maxContextLines {
+		q.context = maxContextLines
+	}
+
+	for _, glob := range stringList(arguments, "include") {
+		m, err := compileMatcher(glob, false)
+		if err != nil {
+			return nil, err
+		}
+		q.include = append(q.include, m)
+	}
+	for _, glob := range stringList(arguments, "exclude") {
+		m, err := compileMatcher(glob, false)
+		if err != nil {
+			return nil, err
+		}
+		q.exclude = append(q.exclude, m)
+	}
+	return q, nil
+}
+
+// wants reports whether a file path passes the include and exclude globs
+func (q *contentQuery) wants(rel string) bool {
+	for _, m := range q.exclude {
+		if m(rel) {
+			return false
+		}
+	}
+	if len(q.include) == 0 {
+		return true
+	}
+	for _, m := range q.include {
+		if m(rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// excludesDir reports whether a directory is excluded and need not be walked
+func (q *contentQuery) excludesDir(rel string) bool {
+	for _, m := range q.exclude {
+		if m(rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// excludesAncestor reports whether any directory above rel is excluded, mirroring
+// the directories a walk would have pruned
+func (q *contentQuery) excludesAncestor(rel string) bool {
+	for dir := filepath.ToSlash(filepath.Dir(rel)); dir != "." && dir != "/"; dir = filepath.ToSlash(filepath.Dir(dir)) {
+		if q.excludesDir(dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// isBinary reports whether content looks like binary data
+func isBinary(content []byte) bool {
+	if len(content) > binarySniffLength {
+		content = content[:binarySniffLength]
+	}
+	return bytes.IndexByte(content, 0) >= 0
+}
+
+// truncateLine shortens a line for display
+func truncateLine(line string) string {
+	if len(line) > maxMatchLineLength {
+		return line[:maxMatchLineLength] + "..."
+	}
+	return line
+}
+
+// contentCursor encodes the position of the last returned match
+func contentCursor(path string, line int) string {
+	return encodeCursor(fmt.Sprintf("%s:%d", path, line))
+}
+
+// parseContentCursor decodes a cursor produced by contentCursor
+func parseContentCursor(cursor string) (string, int, error) {
+	if cursor == "" {
+		return "", 0, nil
+	}
+	decoded, err := decodeCursor(cursor)
+	if err != nil {
+		return "", 0, err
+	}
+	i := strings.LastIndex(decoded, ":")
+	if i < 0 {
+		return "", 0, fmt.Errorf("invalid cursor: %s", cursor)
+	}
+	line, err := strconv.Atoi(decoded[i+1:])
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid cursor: %s", cursor)
+	}
+	return decoded[:i], line, nil
+}
+
+// matchLines appends the matches of q in content to matches, skipping lines up to and
+// including afterLine. It returns errPageFull once limit matches are collected and another is found.
+func (q *contentQuery) matchLines(rel string, content []byte, afterLine, limit int, matches *[]contentMatch, next *string) error {
+	lines := strings.Split(string(content), "\n")
+	for i := range lines {
+		lines[i] = strings.TrimSuffix(lines[i], "\r")
+	}
+
+	for i, line := range lines {
+		lineNo := i + 1
+		if lineNo <= afterLine || !q.re.MatchString(line) {
+			continue
+		}
+		if len(*matches) >= limit {
+			last := (*matches)[len(*matches)-1]
+			*next = contentCursor(last.Path, last.Line)
+			return errPageFull
+		}
+
+		m := contentMatch{Path: rel, Line: lineNo, Text: truncateLine(line)}
+		if q.context > 0 {
+			for j := max(0, i-q.context); j < i; j++ {
+				m.Before = append(m.Before, truncateLine(lines[j]))
+			}
+			for j := i + 1; j < len(lines) && j <= i+q.context; j++ {
+				m.After = append(m.After, truncateLine(lines[j]))
+			}
+		}
+		*matches = append(*matches, m)
+	}
+	return nil
+}
+
+// searchContent runs a search_content query against one repository and returns a page
+// of matching lines
+func (s *Server) searchContent(ctx context.Context, repo, path string, q *contentQuery, limit int, cursor string) ([]contentMatch, string, error) {
+	afterPath, afterLine, err := parseContentCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	fs, err := s.FileSystem(ctx, repo)
+	if err != nil {
+		return nil, "", err
+	}
+
+	relRoot, err := policy.ValidatePath(fs.BasePath(), path)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if idx := s.contentIndexes.ready(repo); idx != nil && q.maxFileSize <= indexMaxFileSize {
+		return searchContentIndexed(ctx, fs, idx, relRoot, q, limit, afterPath, afterLine)
+	}
+
+	matches := []contentMatch{}
+	next := ""
+	basePath := fs.BasePath()
+	prog := progressFrom(ctx)
+
+	err = fs.Walk(ctx, relRoot, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == basePath {
+			return nil
+		}
+		if policy.ShouldSkip(path) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		prog.scanned(info.IsDir())
+		rel, _ := filepath.Rel(basePath, path)
+		rel = filepath.ToSlash(rel)
+
+		// Resume after the cursor: prune directories and files that were already searched
+		if afterPath != "" && comparePaths(rel, afterPath) < 0 {
+			if info.IsDir() && !isAncestor(rel, afterPath) {
+				return filepath.SkipDir
+			}
+			if !info.IsDir() {
+				return nil
+			}
+		}
+
+		if info.IsDir() {
+			if rel != "." && q.excludesDir(rel) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() || info.Size() > q.maxFileSize || !q.wants(rel) {
+			return nil
+		}
+
+		content, err := fs.ReadFile(ctx, rel)
+		if err != nil || isBinary(content) {
+			return nil
+		}
+
+		skipLines := 0
+		if rel == afterPath {
+			skipLines = afterLine
+		}
+		found := len(matches)
+		err = q.matchLines(rel, content, skipLines, limit, &matches, &next)
+		prog.matched(len(matches) - found)
+		return err
+	})
+	if err != nil && err != errPageFull {
+		return nil, "", err
+	}
+
+	return matches, next, nil
+}
+
+// searchContentIndexed answers a content query from the trigram index: only candidate
+// files are read and verified against the regular expression, with no directory walk
+func searchContentIndexed(ctx context.Context, fs backends.FileSystem, idx *contentIndex, relRoot string, q *contentQuery, limit int, afterPath string, afterLine int) ([]contentMatch, string, error) {
+	matches := []contentMatch{}
+	next := ""
+	root := filepath.ToSlash(relRoot)
+	prog := progressFrom(ctx)
+
+	for _, rel := range idx.candidates(q.trigrams) {
+		if err := ctx.Err(); err != nil {
+			return nil, "", err
+		}
+		if root != "." && rel != root && !isAncestor(root, rel) {
+			continue
+		}
+		if afterPath != "" && comparePaths(rel, afterPath) < 0 {
+			continue
+		}
+		if !q.wants(rel) || q.excludesAncestor(rel) {
+			continue
+		}
+
+		prog.scanned(false)
+		content, err := fs.ReadFile(ctx, rel)
+		if err != nil || int64(len(content)) > q.maxFileSize || isBinary(content) {
+			continue
+		}
+
+		skipLines := 0
+		if rel == afterPath {
+			skipLines = afterLine
+		}
+		found := len(matches)
+		err = q.matchLines(rel, content, skipLines, limit, &matches, &next)
+		prog.matched(len(matches) - found)
+		if err != nil {
+			break
+		}
+	}
+	return matches, next, nil
+}
+
+func (s *Server) handleSearchContent(ctx context.Context, arguments map[string]interface{}) (*mcp.CallToolResult, error) {
+	names, multi, err := s.repoArgument(arguments)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	q, err := parseContentQuery(arguments)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	path := "."
+	if p, ok := arguments["path"].(string); ok && p != "" {
+		path = p
+	}
+
+	cursor, _ := arguments["cursor"].(string)
+
+	if !multi {
+		repo := names[0]
+		matches, next, err := s.searchContent(ctx, repo, path, q, s.resultLimit(repo, arguments), cursor)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		result := map[string]interface{}{
+			"repository": repo,
+			"pattern":    arguments["pattern"],
+			"matches":    matches,
+		}
+		if next != "" {
+			result["next_cursor"] = next
+		}
+
+		jsonResult, _ := json.MarshalIndent(result, "", "  ")
+		return mcp.NewToolResultText(string(jsonResult)), nil
+	}
+
+	names, cursors, err := multiRepoPlan(names, cursor)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	type contentPage struct {
+		matches []contentMatch
+		next    string
+	}
+	results := runAcrossRepos(ctx, names, repoTimeout(arguments), func(ctx context.Context, repo string) (interface{}, error) {
+		matches, next, err := s.searchContent(ctx, repo, path, q, s.resultLimit(repo, arguments), cursors[repo])
+		return contentPage{matches: matches, next: next}, err
+	})
+
+	matches := []contentMatch{}
+	repoErrors := make(map[string]string)
+	nextCursors := make(map[string]string)
+	for _, r := range results {
+		if r.err != nil {
+			repoErrors[r.repo] = r.err.Error()
+			continue
+		}
+		page := r.value.(contentPage)
+		for _, m := range page.matches {
+			m.Repository = r.repo
+			matches = append(matches, m)
+		}
+		if page.next != "" {
+			nextCursors[r.repo] = page.next
+		}
+	}
+
+	result := map[string]interface{}{
+		"repositories": names,
+		"pattern":      arguments["pattern"],
+		"matches":      matches,
+	}
+	if len(repoErrors) > 0 {
+		result["errors"] = repoErrors
+	}
+	if next := encodeMultiCursor(nextCursors); next != "" {
+		result["next_cursor"] = next
+	}
+
+	jsonResult, _ := json.MarshalIndent(result, "", "  ")
+	return mcp.NewToolResultText(string(jsonResult)), nil
+}
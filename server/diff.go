@@ -0,0 +1,276 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// defaultDiffContext is the number of unchanged lines shown around each change
+	defaultDiffContext = 3
+	// maxDiffEdits bounds the edit distance diffLines searches before giving up, as the
+	// search takes time proportional to it
+	maxDiffEdits = 4000
+)
+
+// diffOp is one line of an edit script: ' ' kept, '-' deleted from a, '+' inserted from b
+type diffOp struct {
+	kind byte
+	text string
+	a, b int // number of lines of a and b before this one
+}
+
+// splitLines splits text into lines that keep their "\n", so a missing final newline
+// shows up as a difference
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines computes a shortest edit script from a to b with Myers' algorithm
+func diffLines(a, b []string) ([]diffOp, error) {
+	// Common prefix and suffix don't need the search
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	middle, err := myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])
+	if err != nil {
+		return nil, err
+	}
+
+	ops := make([]diffOp, 0, prefix+len(middle)+suffix)
+	for i := 0; i < prefix; i++ {
+		ops = append(ops, diffOp{kind: ' ', text: a[i]})
+	}
+	ops = append(ops, middle...)
+	for i := len(a) - suffix; i < len(a); i++ {
+		ops = append(ops, diffOp{kind: ' ', text: a[i]})
+	}
+
+	// Record positions for hunk headers
+	ai, bi := 0, 0
+	for i := range ops {
+		ops[i].a, ops[i].b = ai, bi
+		if ops[i].kind != '+' {
+			ai++
+		}
+		if ops[i].kind != '-' {
+			bi++
+		}
+	}
+	return ops, nil
+}
+
+// myers finds a shortest edit script between a and b, which share no common prefix or
+// suffix. It uses the linear-space variant of Myers' algorithm: find the middle snake of an
+// optimal path, then solve the halves before and after it, so memory stays proportional to
+// the input rather than to the square of the edit distance.
+func myers(a, b []string) ([]diffOp, error) {
+	if len(a)+len(b) == 0 {
+		return nil, nil
+	}
+	s := &diffSearch{a: a, b: b}
+	size := (len(a)+len(b)+1)/2 + 1
+	s.offset = size
+	s.vf = make([]int, 2*size+2)
+	s.vb = make([]int, 2*size+2)
+
+	// Only the first middle snake needs the bound: every later search is within its halves
+	d, x, y, u, v := s.middleSnake(0, len(a), 0, len(b), (maxDiffEdits+1)/2)
+	if d < 0 || d > maxDiffEdits {
+		return nil, fmt.Errorf("files differ in more than %d lines", maxDiffEdits)
+	}
+	s.compare(0, x, 0, y)
+	for i := x; i < u; i++ {
+		s.ops = append(s.ops, diffOp{kind: ' ', text: a[i]})
+	}
+	s.compare(u, len(a), v, len(b))
+	return s.ops, nil
+}
+
+// diffSearch holds the state of one myers call. vf and vb are the furthest reaching x per
+// diagonal of the forward and backward searches, indexed from offset.
+type diffSearch struct {
+	a, b   []string
+	vf, vb []int
+	offset int
+	ops    []diffOp
+}
+
+// compare appends the edit script from a[aLo:aHi] to b[bLo:bHi]
+func (s *diffSearch) compare(aLo, aHi, bLo, bHi int) {
+	for aLo < aHi && bLo < bHi && s.a[aLo] == s.b[bLo] {
+		s.ops = append(s.ops, diffOp{kind: ' ', text: s.a[aLo]})
+		aLo++
+		bLo++
+	}
+	suffix := 0
+	for aLo < aHi-suffix && bLo < bHi-suffix && s.a[aHi-1-suffix] == s.b[bHi-1-suffix] {
+		suffix++
+	}
+	aHi -= suffix
+	bHi -= suffix
+
+	switch {
+	case aLo == aHi:
+		for i := bLo; i < bHi; i++ {
+			s.ops = append(s.ops, diffOp{kind: '+', text: s.b[i]})
+		}
+	case bLo == bHi:
+		for i := aLo; i < aHi; i++ {
+			s.ops = append(s.ops, diffOp{kind: '-', text: s.a[i]})
+		}
+	default:
+		_, x, y, u, v := s.middleSnake(aLo, aHi, bLo, bHi, -1)
+		s.compare(aLo, x, bLo, y)
+		for i := x; i < u; i++ {
+			s.ops = append(s.ops, diffOp{kind: ' ', text: s.a[i]})
+		}
+		s.compare(u, aHi, v, bHi)
+	}
+
+	for i := aHi; i < aHi+suffix; i++ {
+		s.ops = append(s.ops, diffOp{kind: ' ', text: s.a[i]})
+	}
+}
+
+// middleSnake finds the middle snake of a shortest path from a[aLo:aHi] to b[bLo:bHi],
+// searching from both ends at once. It returns the edit distance and the snake's start
+// (x, y) and end (u, v), or d = -1 if the distance needs more than limit steps from each
+// end (limit < 0 means no limit).
+func (s *diffSearch) middleSnake(aLo, aHi, bLo, bHi, limit int) (d, x, y, u, v int) {
+	n, m := aHi-aLo, bHi-bLo
+	delta := n - m
+	odd := delta%2 != 0
+	vf, vb, o := s.vf, s.vb, s.offset
+	vf[o+1], vb[o+1] = 0, 0
+
+	for step := 0; step <= (n+m+1)/2; step++ {
+		if limit >= 0 && step > limit {
+			return -1, 0, 0, 0, 0
+		}
+
+		// Forward from the start; vf holds x on diagonal k = x - y
+		for k := -step; k <= step; k += 2 {
+			var px int
+			if k == -step || k != step && vf[o+k-1] < vf[o+k+1] {
+				px = vf[o+k+1]
+			} else {
+				px = vf[o+k-1] + 1
+			}
+			py := px - k
+			sx, sy := px, py
+			for px < n && py < m && s.a[aLo+px] == s.b[bLo+py] {
+				px++
+				py++
+			}
+			vf[o+k] = px
+			// Backward diagonal delta - k has taken step - 1 steps so far
+			if c := delta - k; odd && c >= -(step-1) && c <= step-1 && px+vb[o+c] >= n {
+				return 2*step - 1, aLo + sx, bLo + sy, aLo + px, bLo + py
+			}
+		}
+
+		// Backward from the end; vb holds how far x is from the end on diagonal k
+		for k := -step; k <= step; k += 2 {
+			var px int
+			if k == -step || k != step && vb[o+k-1] < vb[o+k+1] {
+				px = vb[o+k+1]
+			} else {
+				px = vb[o+k-1] + 1
+			}
+			py := px - k
+			sx, sy := px, py
+			for px < n && py < m && s.a[aHi-1-px] == s.b[bHi-1-py] {
+				px++
+				py++
+			}
+			vb[o+k] = px
+			if c := delta - k; !odd && c >= -step && c <= step && px+vf[o+c] >= n {
+				return 2 * step, aHi - px, bHi - py, aHi - sx, bHi - sy
+			}
+		}
+	}
+	// Not reached: a path always exists within (n+m+1)/2 steps from each end
+	return -1, 0, 0, 0, 0
+}
+
+// hunkRange formats one side of a hunk header
+func hunkRange(start, length int) string {
+	if length == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if length == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, length)
+}
+
+// unifiedDiff renders an edit script as a unified diff with the given context lines.
+// It returns "" when there are no changes.
+func unifiedDiff(nameA, nameB string, ops []diffOp, context int) string {
+	var b strings.Builder
+	i := 0
+	for i < len(ops) {
+		// Find the next change
+		for i < len(ops) && ops[i].kind == ' ' {
+			i++
+		}
+		if i == len(ops) {
+			break
+		}
+
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+		// Extend the hunk while the next change is within two contexts
+		end := i
+		for j := i; j < len(ops); j++ {
+			if ops[j].kind != ' ' {
+				end = j
+			} else if j-end > 2*context {
+				break
+			}
+		}
+		stop := end + context + 1
+		if stop > len(ops) {
+			stop = len(ops)
+		}
+
+		if b.Len() == 0 {
+			fmt.Fprintf(&b, "--- %s\n+++ %s\n", nameA, nameB)
+		}
+		lenA, lenB := 0, 0
+		for _, op := range ops[start:stop] {
+			if op.kind != '+' {
+				lenA++
+			}
+			if op.kind != '-' {
+				lenB++
+			}
+		}
+		fmt.Fprintf(&b, "@@ -%s +%s @@\n", hunkRange(ops[start].a, lenA), hunkRange(ops[start].b, lenB))
+		for _, op := range ops[start:stop] {
+			b.WriteByte(op.kind)
+			b.WriteString(op.text)
+			if !strings.HasSuffix(op.text, "\n") {
+				b.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		i = stop
+	}
+	return b.String()
+}
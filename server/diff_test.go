@@ -0,0 +1,145 @@
+package server
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// lines makes one line per character, so that edit scripts are easy to write down
+func lines(s string) []string {
+	var out []string
+	for _, c := range s {
+		out = append(out, string(c)+"\n")
+	}
+	return out
+}
+
+// lcsLength is the length of the longest common subsequence of a and b, by dynamic
+// programming
+func lcsLength(a, b []string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for i := range a {
+		for j := range b {
+			switch {
+			case a[i] == b[j]:
+				cur[j+1] = prev[j] + 1
+			case prev[j+1] >= cur[j]:
+				cur[j+1] = prev[j+1]
+			default:
+				cur[j+1] = cur[j]
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// checkEditScript checks that ops turns a into b, that its positions are right and that it
+// has as few edits as possible. It returns the number of edits.
+func checkEditScript(t *testing.T, a, b []string, ops []diffOp) int {
+	t.Helper()
+	ai, bi, edits := 0, 0, 0
+	for i, op := range ops {
+		if op.a != ai || op.b != bi {
+			t.Fatalf("op %d at a %d b %d, want a %d b %d", i, op.a, op.b, ai, bi)
+		}
+		switch op.kind {
+		case ' ':
+			if ai >= len(a) || bi >= len(b) || a[ai] != op.text || b[bi] != op.text {
+				t.Fatalf("op %d keeps %q, which isn't line %d of a and line %d of b", i, op.text, ai, bi)
+			}
+			ai++
+			bi++
+		case '-':
+			if ai >= len(a) || a[ai] != op.text {
+				t.Fatalf("op %d deletes %q, which isn't line %d of a", i, op.text, ai)
+			}
+			ai++
+			edits++
+		case '+':
+			if bi >= len(b) || b[bi] != op.text {
+				t.Fatalf("op %d inserts %q, which isn't line %d of b", i, op.text, bi)
+			}
+			bi++
+			edits++
+		default:
+			t.Fatalf("op %d has kind %q", i, op.kind)
+		}
+	}
+	if ai != len(a) || bi != len(b) {
+		t.Fatalf("edit script consumes %d lines of a and %d of b, want %d and %d", ai, bi, len(a), len(b))
+	}
+	if minimal := len(a) + len(b) - 2*lcsLength(a, b); edits != minimal {
+		t.Fatalf("edit script has %d edits, want %d", edits, minimal)
+	}
+	return edits
+}
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		name  string
+		a, b  []string
+		edits int
+	}{
+		{"empty", nil, nil, 0},
+		{"identical", lines("abc"), lines("abc"), 0},
+		{"insert only", nil, lines("abc"), 3},
+		{"insert in the middle", lines("ac"), lines("abbc"), 2},
+		{"delete only", lines("abc"), nil, 3},
+		{"delete in the middle", lines("abcd"), lines("ad"), 2},
+		// The example of Myers' paper, whose middle snake crosses from one half to the other
+		{"crossing middle snake", lines("abcabba"), lines("cbabac"), 5},
+		{"replace all", lines("abc"), lines("xyz"), 6},
+		{"CRLF line", splitLines("one\r\ntwo\nthree\n"), splitLines("one\ntwo\nthree\n"), 2},
+		{"missing final newline", splitLines("one\ntwo\n"), splitLines("one\ntwo"), 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ops, err := diffLines(tt.a, tt.b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if edits := checkEditScript(t, tt.a, tt.b, ops); edits != tt.edits {
+				t.Errorf("diffLines made %d edits, want %d", edits, tt.edits)
+			}
+		})
+	}
+}
+
+// TestDiffLinesRandom compares edit counts with the longest common subsequence on random
+// inputs from a small alphabet, which have many equally short edit scripts
+func TestDiffLinesRandom(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	random := func() []string {
+		var b strings.Builder
+		for n := rng.Intn(40); n > 0; n-- {
+			b.WriteByte("abc"[rng.Intn(3)])
+		}
+		return lines(b.String())
+	}
+	for i := 0; i < 500; i++ {
+		a, b := random(), random()
+		ops, err := diffLines(a, b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkEditScript(t, a, b, ops)
+	}
+}
+
+func TestDiffLinesTooManyEdits(t *testing.T) {
+	a := make([]string, maxDiffEdits)
+	b := make([]string, maxDiffEdits)
+	for i := range a {
+		a[i] = "a\n"
+		b[i] = "b\n"
+	}
+	if _, err := diffLines(a, b); err == nil {
+		t.Errorf("diffLines of %d changed lines succeeded, want an error", maxDiffEdits)
+	}
+	if _, err := diffLines(a[:maxDiffEdits/2], b[:maxDiffEdits/2]); err != nil {
+		t.Errorf("diffLines of %d edits: %v", maxDiffEdits, err)
+	}
+}
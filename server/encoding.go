@@ -0,0 +1,267 @@
+package server
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// maxBlobSize bounds the binary files returned base64-encoded; larger ones are only described
+const maxBlobSize = 5 << 20
+
+// decodedFile is file content classified as text or binary, with text converted to UTF-8
+type decodedFile struct {
+	Binary     bool
+	Text       string // UTF-8 text (empty for binary files)
+	Encoding   string // "utf-8", "utf-8-bom", "utf-16le", "utf-16be" or "latin-1"
+	LineEnding string // "lf", "crlf", "cr", "mixed" or "none"
+	MIMEType   string
+}
+
+// isImage reports whether the file is an image clients can display inline
+func (d *decodedFile) isImage() bool {
+	return d.Binary && strings.HasPrefix(d.MIMEType, "image/")
+}
+
+// describe summarizes the encoding for result headers
+func (d *decodedFile) describe() string {
+	encoding := d.Encoding
+	if encoding != "utf-8" {
+		encoding += " (converted to utf-8)"
+	}
+	return fmt.Sprintf("Encoding: %s, line endings: %s", encoding, d.LineEnding)
+}
+
+// decodeContent detects whether content is text, transcodes UTF-16 and Latin-1 text to
+// UTF-8, and determines its MIME type
+func decodeContent(path string, content []byte) *decodedFile {
+	d := &decodedFile{}
+
+	switch {
+	case bytes.HasPrefix(content, []byte{0xEF, 0xBB, 0xBF}):
+		d.Encoding = "utf-8-bom"
+		d.Text = string(content[3:])
+	case bytes.HasPrefix(content, []byte{0xFF, 0xFE}):
+		d.Encoding = "utf-16le"
+		d.Text = decodeUTF16(content[2:], false)
+	case bytes.HasPrefix(content, []byte{0xFE, 0xFF}):
+		d.Encoding = "utf-16be"
+		d.Text = decodeUTF16(content[2:], true)
+	default:
+		if encoding := guessUTF16(content); encoding != "" {
+			d.Encoding = encoding
+			d.Text = decodeUTF16(content, encoding == "utf-16be")
+		} else if isBinary(content) {
+			d.Binary = true
+		} else if utf8.Valid(content) {
+			d.Encoding = "utf-8"
+			d.Text = string(content)
+		} else if looksLikeLatin1(content) {
+			d.Encoding = "latin-1"
+			d.Text = decodeLatin1(content)
+		} else {
+			d.Binary = true
+		}
+	}
+
+	d.MIMEType = detectMIMEType(path, content, d.Binary)
+	if !d.Binary {
+		d.LineEnding = lineEnding(d.Text)
+	}
+	return d
+}
+
+// guessUTF16 recognizes BOM-less UTF-16 by the zero high bytes of mostly-ASCII text,
+// returning "utf-16le", "utf-16be" or "" if content doesn't look like UTF-16. Arrays of
+// small 16-bit numbers, such as audio samples, have the same zero bytes, so the sample must
+// also decode to printable text.
+func guessUTF16(content []byte) string {
+	sample := content
+	if len(sample) > binarySniffLength {
+		sample = sample[:binarySniffLength]
+	}
+	if len(sample) < 4 {
+		return ""
+	}
+
+	var evenZeros, oddZeros int
+	pairs := len(sample) / 2
+	for i := 0; i+1 < len(sample); i += 2 {
+		if sample[i] == 0 {
+			evenZeros++
+		}
+		if sample[i+1] == 0 {
+			oddZeros++
+		}
+	}
+	// Text in UTF-16 has a zero in nearly every high byte and almost never in the low byte
+	switch {
+	case oddZeros*10 >= pairs*7 && evenZeros*10 <= pairs:
+		if printableUTF16(sample, false) {
+			return "utf-16le"
+		}
+	case evenZeros*10 >= pairs*7 && oddZeros*10 <= pairs:
+		if printableUTF16(sample, true) {
+			return "utf-16be"
+		}
+	}
+	return ""
+}
+
+// printableUTF16 reports whether UTF-16 content decodes to text: no NUL characters or
+// unpaired surrogates, and few control characters besides whitespace
+func printableUTF16(content []byte, bigEndian bool) bool {
+	// A sample may end in the middle of a surrogate pair
+	text := strings.TrimSuffix(decodeUTF16(content, bigEndian), string(utf8.RuneError))
+	runes, controls := 0, 0
+	for _, r := range text {
+		runes++
+		switch {
+		case r == 0 || r == utf8.RuneError:
+			return false
+		case r == '\t' || r == '\n' || r == '\r' || r == '\f' || r == 0x1b:
+		case !unicode.IsGraphic(r):
+			controls++
+		}
+	}
+	return controls*100 <= runes
+}
+
+// decodeUTF16 converts UTF-16 content to a UTF-8 string
+func decodeUTF16(content []byte, bigEndian bool) string {
+	var order binary.ByteOrder = binary.LittleEndian
+	if bigEndian {
+		order = binary.BigEndian
+	}
+	units := make([]uint16, len(content)/2)
+	for i := range units {
+		units[i] = order.Uint16(content[2*i:])
+	}
+	return string(utf16.Decode(units))
+}
+
+// looksLikeLatin1 reports whether invalid UTF-8 is plausibly ISO-8859-1 text: few C0
+// control characters besides whitespace and none from the C1 range
+func looksLikeLatin1(content []byte) bool {
+	controls := 0
+	for _, b := range content {
+		switch {
+		case b == '\t' || b == '\n' || b == '\r' || b == '\f' || b == 0x1b:
+		case b < 0x20 || b == 0x7f:
+			controls++
+		case b >= 0x80 && b < 0xa0:
+			return false
+		}
+	}
+	return controls*100 <= len(content)
+}
+
+// decodeLatin1 converts ISO-8859-1 content to a UTF-8 string
+func decodeLatin1(content []byte) string {
+	runes := make([]rune, len(content))
+	for i, b := range content {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
+
+// lineEnding classifies the line terminators used in text
+func lineEnding(text string) string {
+	crlf := strings.Count(text, "\r\n")
+	lf := strings.Count(text, "\n") - crlf
+	cr := strings.Count(text, "\r") - crlf
+
+	kinds := 0
+	style := "none"
+	for _, k := range []struct {
+		n    int
+		name string
+	}{{lf, "lf"}, {crlf, "crlf"}, {cr, "cr"}} {
+		if k.n > 0 {
+			kinds++
+			style = k.name
+		}
+	}
+	if kinds > 1 {
+		return "mixed"
+	}
+	return style
+}
+
+// detectMIMEType determines a file's MIME type from its extension, falling back to
+// sniffing its content. Text files without a known text type are text/plain.
+func detectMIMEType(path string, content []byte, isBinary bool) string {
+	byExt := mime.TypeByExtension(strings.ToLower(filepath.Ext(path)))
+	if byExt != "" {
+		byExt = strings.TrimSpace(strings.SplitN(byExt, ";", 2)[0])
+	}
+
+	if isBinary {
+		if byExt != "" {
+			return byExt
+		}
+		sniffed := http.DetectContentType(content)
+		return strings.TrimSpace(strings.SplitN(sniffed, ";", 2)[0])
+	}
+
+	if byExt != "" && isTextMIMEType(byExt) {
+		return byExt
+	}
+	return "text/plain"
+}
+
+// isTextMIMEType reports whether a MIME type describes text content
+func isTextMIMEType(mimeType string) bool {
+	if strings.HasPrefix(mimeType, "text/") {
+		return true
+	}
+	switch mimeType {
+	case "application/json", "application/xml", "application/javascript", "application/x-sh",
+		"application/toml", "application/yaml", "application/x-yaml", "image/svg+xml":
+		return true
+	}
+	return strings.HasSuffix(mimeType, "+json") || strings.HasSuffix(mimeType, "+xml")
+}
+
+// blobContent is an embedded resource carrying base64 data. mcp.EmbeddedResource only
+// holds text-less resource contents, so binary payloads use this instead.
+type blobContent struct {
+	Type     string                   `json:"type"` // Must be "resource"
+	Resource mcp.BlobResourceContents `json:"resource"`
+}
+
+// binaryToolResult returns a binary file as image content, or as a base64 blob resource
+// for other types. Files over maxBlobSize are only described.
+func binaryToolResult(header, uri string, content []byte, d *decodedFile) *mcp.CallToolResult {
+	summary := fmt.Sprintf("%s\nBinary file: %s, %d bytes", header, d.MIMEType, len(content))
+	if len(content) > maxBlobSize {
+		return mcp.NewToolResultText(fmt.Sprintf("%s (too large to return, limit %d bytes)", summary, maxBlobSize))
+	}
+
+	data := base64.StdEncoding.EncodeToString(content)
+	if d.isImage() {
+		return mcp.NewToolResultImage(summary, data, d.MIMEType)
+	}
+	return &mcp.CallToolResult{
+		Content: []interface{}{
+			mcp.NewTextContent(summary),
+			blobContent{
+				Type: "resource",
+				Resource: mcp.BlobResourceContents{
+					ResourceContents: mcp.ResourceContents{URI: uri, MIMEType: d.MIMEType},
+					Blob:             data,
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+	"unicode/utf16"
+)
+
+// encodeUTF16 encodes text as UTF-16 without a byte order mark
+func encodeUTF16(text string, order binary.ByteOrder) []byte {
+	units := utf16.Encode([]rune(text))
+	content := make([]byte, 2*len(units))
+	for i, u := range units {
+		order.PutUint16(content[2*i:], u)
+	}
+	return content
+}
+
+// encodeUint16s encodes numbers as a little-endian array, as in audio samples or tables
+func encodeUint16s(values []uint16) []byte {
+	content := make([]byte, 2*len(values))
+	for i, v := range values {
+		binary.LittleEndian.PutUint16(content[2*i:], v)
+	}
+	return content
+}
+
+func TestDecodeContent(t *testing.T) {
+	text := "Grüße from a Windows tool\r\nSecond line, with a tab\tand a check mark ✓\r\n"
+
+	// A table of small counters: every high byte is zero, every low byte isn't
+	table := make([]uint16, 2048)
+	for i := range table {
+		table[i] = uint16(i%250 + 1)
+	}
+	// Quiet 16-bit PCM audio: a sine wave of small positive amplitude
+	pcm := make([]uint16, 4096)
+	for i := range pcm {
+		pcm[i] = uint16(100 + 90*math.Sin(float64(i)/8))
+	}
+
+	tests := []struct {
+		name     string
+		content  []byte
+		binary   bool
+		encoding string
+		text     string
+	}{
+		{"utf-8", []byte(text), false, "utf-8", text},
+		{"utf-8 with BOM", append([]byte{0xEF, 0xBB, 0xBF}, text...), false, "utf-8-bom", text},
+		{"utf-16le with BOM", append([]byte{0xFF, 0xFE}, encodeUTF16(text, binary.LittleEndian)...), false, "utf-16le", text},
+		{"utf-16le without BOM", encodeUTF16(text, binary.LittleEndian), false, "utf-16le", text},
+		{"utf-16be without BOM", encodeUTF16(text, binary.BigEndian), false, "utf-16be", text},
+		{"latin-1", []byte("caf\xe9 cr\xe8me\n"), false, "latin-1", "café crème\n"},
+		{"uint16 table", encodeUint16s(table), true, "", ""},
+		{"pcm audio", encodeUint16s(pcm), true, "", ""},
+		{"nul bytes", []byte("abc\x00def\x00ghi\x00"), true, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := decodeContent("file", tt.content)
+			if d.Binary != tt.binary {
+				t.Fatalf("Binary = %v, want %v (encoding %q)", d.Binary, tt.binary, d.Encoding)
+			}
+			if d.Encoding != tt.encoding {
+				t.Errorf("Encoding = %q, want %q", d.Encoding, tt.encoding)
+			}
+			if d.Text != tt.text {
+				t.Errorf("Text = %q, want %q", d.Text, tt.text)
+			}
+		})
+	}
+}
@@ -0,0 +1,239 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Scoring constants loosely follow fzf: matches score points, matches at word
+// boundaries and consecutive runs earn bonuses, and gaps are penalized
+const (
+	scoreMatch          = 16
+	scoreGapStart       = -3
+	scoreGapExtension   = -1
+	bonusBoundary       = 8
+	bonusCamel          = 7
+	bonusConsecutive    = 4
+	bonusFirstCharMulti = 2
+	bonusBasename       = 10
+)
+
+// charBonus returns the bonus for a match at position i, based on whether it starts a new "word"
+func charBonus(s []rune, i int) int {
+	if i == 0 {
+		return bonusBoundary
+	}
+	prev, cur := s[i-1], s[i]
+	switch prev {
+	case '/', '_', '-', '.', ' ':
+		return bonusBoundary
+	}
+	if unicode.IsLower(prev) && unicode.IsUpper(cur) {
+		return bonusCamel
+	}
+	if !unicode.IsDigit(prev) && unicode.IsDigit(cur) {
+		return bonusCamel
+	}
+	return 0
+}
+
+// fuzzyMatchTerm scores a single query term against text. Characters of the
+// term must appear in order; the shortest window ending at the first complete
+// match is scored. Matching is case-insensitive unless the term has upper case.
+func fuzzyMatchTerm(term, text string) (int, bool) {
+	caseSensitive := strings.ToLower(term) != term
+	original := []rune(text)
+	haystack := original
+	if !caseSensitive {
+		haystack = []rune(strings.ToLower(text))
+		if len(haystack) != len(original) {
+			original = haystack
+		}
+	}
+	needle := []rune(term)
+	if len(needle) == 0 {
+		return 0, true
+	}
+
+	// Forward pass: find where the first complete match ends
+	end, n := -1, 0
+	for i, r := range haystack {
+		if r == needle[n] {
+			n++
+			if n == len(needle) {
+				end = i
+				break
+			}
+		}
+	}
+	if end < 0 {
+		return 0, false
+	}
+
+	// Backward pass: find the latest start that still matches, giving the shortest window
+	start, n := end, len(needle)-1
+	for i := end; i >= 0; i-- {
+		if haystack[i] == needle[n] {
+			n--
+			if n < 0 {
+				start = i
+				break
+			}
+		}
+	}
+
+	score, n := 0, 0
+	inGap, consecutive := false, 0
+	for i := start; i <= end && n < len(needle); i++ {
+		if haystack[i] != needle[n] {
+			if inGap {
+				score += scoreGapExtension
+			} else {
+				score += scoreGapStart
+				inGap = true
+			}
+			consecutive = 0
+			continue
+		}
+		bonus := charBonus(original, i)
+		if n == 0 {
+			bonus *= bonusFirstCharMulti
+		}
+		if consecutive > 0 {
+			bonus += bonusConsecutive
+		}
+		score += scoreMatch + bonus
+		inGap = false
+		consecutive++
+		n++
+	}
+
+	// Prefer matches within the file name over matches in directory names
+	basename := 0
+	for i, r := range original {
+		if r == '/' {
+			basename = i + 1
+		}
+	}
+	if start >= basename {
+		score += bonusBasename
+	}
+	return score, true
+}
+
+// fuzzyScore matches a whitespace-separated query against a path. Every term must match.
+func fuzzyScore(query, path string) (int, bool) {
+	total := 0
+	for _, term := range strings.Fields(query) {
+		score, ok := fuzzyMatchTerm(term, path)
+		if !ok {
+			return 0, false
+		}
+		total += score
+	}
+	return total, true
+}
+
+// defaultFindLimit is the number of ranked results find_file returns by default
+const defaultFindLimit = 20
+
+// fileMatch is a single ranked find_file result
+type fileMatch struct {
+	Repository string `json:"repository"`
+	Path       string `json:"path"`
+	Score      int    `json:"score"`
+}
+
+func (s *Server) handleFindFile(ctx context.Context, arguments map[string]interface{}) (*mcp.CallToolResult, error) {
+	query, ok := arguments["query"].(string)
+	if !ok || strings.TrimSpace(query) == "" {
+		return mcp.NewToolResultError("query parameter is required"), nil
+	}
+
+	refresh, _ := arguments["refresh"].(bool)
+	cursor, _ := arguments["cursor"].(string)
+
+	limit := intArgument(arguments, "limit", defaultFindLimit)
+	if max := s.resultLimit("", nil); limit <= 0 || limit > max {
+		limit = max
+	}
+
+	names, multi := s.resolveRepoNames("*"), true
+	if _, ok := arguments["repo"]; ok {
+		var err error
+		if names, multi, err = s.repoArgument(arguments); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+	}
+
+	results := runAcrossRepos(ctx, names, repoTimeout(arguments), func(ctx context.Context, repo string) (interface{}, error) {
+		return s.pathIndexes.get(ctx, repo, refresh)
+	})
+
+	var matches []fileMatch
+	var truncated []string
+	repoErrors := make(map[string]string)
+	for _, r := range results {
+		if r.err != nil {
+			repoErrors[r.repo] = r.err.Error()
+			continue
+		}
+		idx := r.value.(*pathIndex)
+		if idx.truncated {
+			truncated = append(truncated, r.repo)
+		}
+		for _, path := range idx.paths {
+			if score, ok := fuzzyScore(query, path); ok {
+				matches = append(matches, fileMatch{Repository: r.repo, Path: path, Score: score})
+			}
+		}
+	}
+
+	// A single named repository that fails is an error for the whole call
+	if !multi && len(repoErrors) > 0 {
+		return mcp.NewToolResultError(repoErrors[names[0]]), nil
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		if len(matches[i].Path) != len(matches[j].Path) {
+			return len(matches[i].Path) < len(matches[j].Path)
+		}
+		if matches[i].Path != matches[j].Path {
+			return matches[i].Path < matches[j].Path
+		}
+		return matches[i].Repository < matches[j].Repository
+	})
+
+	start, end, next, err := offsetPage(len(matches), limit, cursor)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	result := map[string]interface{}{
+		"query":   query,
+		"matches": matches[start:end],
+		"total":   len(matches),
+	}
+	if next != "" {
+		result["next_cursor"] = next
+	}
+	if len(repoErrors) > 0 {
+		result["errors"] = repoErrors
+	}
+	// Only the first maxIndexedPaths files of these repositories were ranked
+	if len(truncated) > 0 {
+		sort.Strings(truncated)
+		result["truncated"] = truncated
+	}
+
+	jsonResult, _ := json.MarshalIndent(result, "", "  ")
+	return mcp.NewToolResultText(string(jsonResult)), nil
+}
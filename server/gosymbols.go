@@ -0,0 +1,176 @@
+package server
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"strings"
+)
+
+// goExtractor extracts symbols from Go source using go/parser
+type goExtractor struct{}
+
+func init() {
+	RegisterSymbolExtractor(goExtractor{}, ".go")
+}
+
+// nodeString renders an AST node back to source on a single line
+func nodeString(fset *token.FileSet, node ast.Node) string {
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, fset, node); err != nil {
+		return ""
+	}
+	s := strings.Join(strings.Fields(buf.String()), " ")
+	// Undo the spacing left by parameter lists that were split across lines
+	return strings.NewReplacer("( ", "(", ", )", ")").Replace(s)
+}
+
+// receiverType returns the base type name of a method receiver
+func receiverType(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.StarExpr:
+		return receiverType(t.X)
+	case *ast.IndexExpr:
+		return receiverType(t.X)
+	case *ast.IndexListExpr:
+		return receiverType(t.X)
+	case *ast.Ident:
+		return t.Name
+	}
+	return ""
+}
+
+// funcSignature renders a function declaration without its body
+func funcSignature(fset *token.FileSet, decl *ast.FuncDecl) string {
+	header := *decl
+	header.Body = nil
+	header.Doc = nil
+	return nodeString(fset, &header)
+}
+
+func (goExtractor) Extract(path string, content []byte) []Symbol {
+	fset := token.NewFileSet()
+	// Files with syntax errors still yield a partial AST, which is good enough for symbols
+	file, _ := parser.ParseFile(fset, path, content, parser.SkipObjectResolution)
+	if file == nil {
+		return nil
+	}
+
+	var symbols []Symbol
+	lines := func(node ast.Node) (int, int) {
+		return fset.Position(node.Pos()).Line, fset.Position(node.End()).Line
+	}
+
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			start, end := lines(d)
+			s := Symbol{
+				Name:      d.Name.Name,
+				Kind:      "func",
+				Line:      start,
+				EndLine:   end,
+				Signature: funcSignature(fset, d),
+			}
+			if d.Recv != nil && len(d.Recv.List) > 0 {
+				s.Kind = "method"
+				s.Parent = receiverType(d.Recv.List[0].Type)
+			}
+			symbols = append(symbols, s)
+
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch sp := spec.(type) {
+				case *ast.TypeSpec:
+					start, end := lines(sp)
+					kind := "type"
+					switch sp.Type.(type) {
+					case *ast.StructType:
+						kind = "struct"
+					case *ast.InterfaceType:
+						kind = "interface"
+					}
+					symbols = append(symbols, Symbol{
+						Name:      sp.Name.Name,
+						Kind:      kind,
+						Line:      start,
+						EndLine:   end,
+						Signature: "type " + sp.Name.Name + " " + typeSummary(fset, sp.Type),
+					})
+					symbols = append(symbols, memberSymbols(fset, sp)...)
+
+				case *ast.ValueSpec:
+					kind := "var"
+					if d.Tok == token.CONST {
+						kind = "const"
+					}
+					start, end := lines(sp)
+					typ := ""
+					if sp.Type != nil {
+						typ = " " + typeSummary(fset, sp.Type)
+					}
+					for _, name := range sp.Names {
+						if name.Name == "_" {
+							continue
+						}
+						symbols = append(symbols, Symbol{
+							Name:      name.Name,
+							Kind:      kind,
+							Line:      start,
+							EndLine:   end,
+							Signature: kind + " " + name.Name + typ,
+						})
+					}
+				}
+			}
+		}
+	}
+	return symbols
+}
+
+// typeSummary renders a type expression, eliding struct and interface bodies
+func typeSummary(fset *token.FileSet, expr ast.Expr) string {
+	switch expr.(type) {
+	case *ast.StructType:
+		return "struct"
+	case *ast.InterfaceType:
+		return "interface"
+	}
+	return nodeString(fset, expr)
+}
+
+// memberSymbols returns struct fields and interface methods as symbols of the enclosing type
+func memberSymbols(fset *token.FileSet, spec *ast.TypeSpec) []Symbol {
+	var fields *ast.FieldList
+	kind := "field"
+	switch t := spec.Type.(type) {
+	case *ast.StructType:
+		fields = t.Fields
+	case *ast.InterfaceType:
+		fields = t.Methods
+		kind = "method"
+	default:
+		return nil
+	}
+
+	var symbols []Symbol
+	for _, field := range fields.List {
+		line := fset.Position(field.Pos()).Line
+		signature := " " + nodeString(fset, field.Type)
+		if kind == "method" {
+			signature = strings.TrimPrefix(signature, " func")
+		}
+		for _, name := range field.Names {
+			symbols = append(symbols, Symbol{
+				Name:      name.Name,
+				Kind:      kind,
+				Line:      line,
+				Parent:    spec.Name.Name,
+				Signature: name.Name + signature,
+			})
+		}
+	}
+	return symbols
+}
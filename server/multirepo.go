@@ -0,0 +1,176 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// defaultRepoTimeout bounds how long a single repository may take in a cross-repository call
+const defaultRepoTimeout = 30 * time.Second
+
+// repoResult is the outcome of running an operation against one repository
+type repoResult struct {
+	repo  string
+	value interface{}
+	err   error
+}
+
+// repoOperation runs against a single repository. Long-running operations should
+// return once ctx is done.
+type repoOperation func(ctx context.Context, repo string) (interface{}, error)
+
+// repoArgument parses a repo argument that may be a single name, a list of names or "*".
+// multi is true when the caller asked for more than a single named repository.
+func (s *Server) repoArgument(arguments map[string]interface{}) (names []string, multi bool, err error) {
+	switch v := arguments["repo"].(type) {
+	case string:
+		if v == "" {
+			return nil, false, fmt.Errorf("repo parameter is required")
+		}
+		if v == "*" {
+			return s.resolveRepoNames("*"), true, nil
+		}
+		return []string{v}, false, nil
+	case []interface{}:
+		seen := make(map[string]bool)
+		for _, item := range v {
+			name, ok := item.(string)
+			if !ok || name == "" {
+				return nil, false, fmt.Errorf("repo list must contain repository names")
+			}
+			if name == "*" {
+				return s.resolveRepoNames("*"), true, nil
+			}
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+		if len(names) == 0 {
+			return nil, false, fmt.Errorf("repo parameter is required")
+		}
+		return names, true, nil
+	}
+	return nil, false, fmt.Errorf("repo parameter is required")
+}
+
+// resolveRepoNames expands a repo argument: empty or "*" means every configured repository
+func (s *Server) resolveRepoNames(repo string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if repo != "" && repo != "*" {
+		return []string{repo}
+	}
+	names := make([]string, 0, len(s.repos))
+	for name := range s.repos {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// runAcrossRepos runs op concurrently for each repository, giving each one at most timeout.
+// Results are returned in the order of names; a repository that times out reports an error
+// and has its context cancelled, without holding up the others.
+func runAcrossRepos(ctx context.Context, names []string, timeout time.Duration, op repoOperation) []repoResult {
+	results := make([]repoResult, len(names))
+
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+
+			repoCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			done := make(chan repoResult, 1)
+			go func() {
+				value, err := op(repoCtx, name)
+				done <- repoResult{repo: name, value: value, err: err}
+			}()
+
+			select {
+			case results[i] = <-done:
+			case <-repoCtx.Done():
+				if ctx.Err() != nil {
+					results[i] = repoResult{repo: name, err: ctx.Err()}
+				} else {
+					results[i] = repoResult{repo: name, err: fmt.Errorf("timed out after %s", timeout)}
+				}
+			}
+		}(i, name)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// repoTimeout reads the per-repository timeout (in seconds) from tool arguments
+func repoTimeout(arguments map[string]interface{}) time.Duration {
+	if seconds := intArgument(arguments, "timeout", 0); seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return defaultRepoTimeout
+}
+
+// encodeMultiCursor packs per-repository cursors into one opaque cursor
+func encodeMultiCursor(cursors map[string]string) string {
+	if len(cursors) == 0 {
+		return ""
+	}
+	data, _ := json.Marshal(cursors)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeMultiCursor unpacks a cursor produced by encodeMultiCursor
+func decodeMultiCursor(cursor string) (map[string]string, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor: %s", cursor)
+	}
+	var cursors map[string]string
+	if err := json.Unmarshal(data, &cursors); err != nil {
+		return nil, fmt.Errorf("invalid cursor: %s", cursor)
+	}
+	return cursors, nil
+}
+
+// multiRepoPlan decides which repositories a paged cross-repository call should visit and
+// with which per-repository cursor. Continuing from a cursor only revisits repositories
+// that still had results.
+func multiRepoPlan(names []string, cursor string) ([]string, map[string]string, error) {
+	if cursor == "" {
+		return names, map[string]string{}, nil
+	}
+	cursors, err := decodeMultiCursor(cursor)
+	if err != nil {
+		return nil, nil, err
+	}
+	var remaining []string
+	for _, name := range names {
+		if _, ok := cursors[name]; ok {
+			remaining = append(remaining, name)
+		}
+	}
+	return remaining, cursors, nil
+}
+
+// repoSchema is the input schema for a repo argument that accepts one name, several names or "*"
+func repoSchema(repoNames []string, description string) map[string]interface{} {
+	return map[string]interface{}{
+		"description": description,
+		"anyOf": []interface{}{
+			map[string]interface{}{"type": "string"},
+			map[string]interface{}{
+				"type":  "array",
+				"items": map[string]interface{}{"type": "string", "enum": repoNames},
+			},
+		},
+	}
+}
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"regexp"
+	"strings"
+)
+
+// Outline is the structural skeleton of a source file: its package, imports and the
+// signatures of what it defines, with bodies elided
+type Outline struct {
+	Package    string
+	Imports    []string
+	ImportLine int // first line of the imports
+	ImportEnd  int // last line of the imports
+	Symbols    []Symbol
+}
+
+// OutlineExtractor is implemented by symbol extractors that also know a language's
+// package and import syntax. Extractors that don't implement it still get an outline
+// built from their symbols.
+type OutlineExtractor interface {
+	SymbolExtractor
+	Outline(path string, content []byte) Outline
+}
+
+// outlineFor builds the outline of a file with the extractor registered for its extension
+func outlineFor(extractor SymbolExtractor, path string, content []byte) Outline {
+	if oe, ok := extractor.(OutlineExtractor); ok {
+		return oe.Outline(path, content)
+	}
+	return Outline{Symbols: extractor.Extract(path, content)}
+}
+
+func (e goExtractor) Outline(path string, content []byte) Outline {
+	outline := Outline{Symbols: e.Extract(path, content)}
+
+	fset := token.NewFileSet()
+	file, _ := parser.ParseFile(fset, path, content, parser.ImportsOnly)
+	if file == nil {
+		return outline
+	}
+	if file.Name != nil {
+		outline.Package = "package " + file.Name.Name
+	}
+	for _, imp := range file.Imports {
+		spec := imp.Path.Value
+		if imp.Name != nil {
+			spec = imp.Name.Name + " " + spec
+		}
+		outline.Imports = append(outline.Imports, spec)
+	}
+	for _, decl := range file.Decls {
+		if gen, ok := decl.(*ast.GenDecl); !ok || gen.Tok != token.IMPORT {
+			continue
+		}
+		start, end := fset.Position(decl.Pos()).Line, fset.Position(decl.End()).Line
+		if outline.ImportLine == 0 {
+			outline.ImportLine = start
+		}
+		outline.ImportEnd = end
+	}
+	return outline
+}
+
+func (e *regexExtractor) Outline(path string, content []byte) Outline {
+	outline := Outline{Symbols: e.Extract(path, content)}
+	if e.imports == nil {
+		return outline
+	}
+	for i, line := range strings.Split(string(content), "\n") {
+		if !e.imports.MatchString(line) {
+			continue
+		}
+		if outline.ImportLine == 0 {
+			outline.ImportLine = i + 1
+		}
+		outline.ImportEnd = i + 1
+		outline.Imports = append(outline.Imports, strings.TrimSpace(line))
+	}
+	return outline
+}
+
+// importPatterns match the import lines of the languages handled by regexExtractor
+var importPatterns = map[string]*regexp.Regexp{
+	"python": regexp.MustCompile(`^(?:from\s+\S+\s+)?import\s+\S`),
+	"js":     regexp.MustCompile(`^\s*(?:import\s.*from\s|import\s+["']|(?:const|let|var)\s+.*=\s*require\()`),
+	"rust":   regexp.MustCompile(`^\s*(?:pub\s+)?(?:use|extern\s+crate)\s+`),
+	"java":   regexp.MustCompile(`^\s*(?:import|using)\s+[\w.*]+`),
+	"c":      regexp.MustCompile(`^\s*#\s*include\s+`),
+	"ruby":   regexp.MustCompile(`^\s*require(?:_relative)?\s+`),
+	"php":    regexp.MustCompile(`^\s*(?:use\s+[\w\\]+|(?:require|include)(?:_once)?\s*[("'])`),
+}
+
+// renderOutline formats an outline as text, one symbol per line prefixed with its line
+// range and indented under the symbol that encloses it
+func renderOutline(outline Outline) string {
+	var b strings.Builder
+	if outline.Package != "" {
+		b.WriteString(outline.Package + "\n\n")
+	}
+	if len(outline.Imports) > 0 {
+		fmt.Fprintf(&b, "imports (%s):\n", lineSpan(outline.ImportLine, outline.ImportEnd))
+		for _, imp := range outline.Imports {
+			b.WriteString("  " + imp + "\n")
+		}
+		b.WriteString("\n")
+	}
+
+	// Symbols arrive in source order, so nesting follows from line ranges
+	var open []int
+	for _, s := range outline.Symbols {
+		end := s.EndLine
+		if end < s.Line {
+			end = s.Line
+		}
+		for len(open) > 0 && open[len(open)-1] < s.Line {
+			open = open[:len(open)-1]
+		}
+
+		signature := s.Signature
+		if signature == "" {
+			signature = s.Kind + " " + s.Name
+		}
+		fmt.Fprintf(&b, "%-10s %s%s\n", lineSpan(s.Line, end), strings.Repeat("  ", len(open)), signature)
+
+		if end > s.Line {
+			open = append(open, end)
+		}
+	}
+	return b.String()
+}
+
+// lineSpan formats a 1-based line range, collapsing single lines
+func lineSpan(start, end int) string {
+	if end <= start {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d-%d", start, end)
+}
@@ -0,0 +1,160 @@
+package server
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// defaultMaxResults is the page size used when neither the config nor the
+// repository sets max_results
+const defaultMaxResults = 1000
+
+// errPageFull is returned from walk callbacks to stop a walk once a page is complete
+var errPageFull = errors.New("page full")
+
+// pager collects one page of results from a walk in stable (lexical, depth-first) order.
+// Results up to and including the cursor path are skipped; once limit results have been
+// collected the pager looks for one more match to decide whether a next page exists.
+type pager struct {
+	limit   int
+	after   string
+	results []string
+	next    string
+}
+
+// newPager creates a pager for the given limit and cursor
+func newPager(limit int, cursor string) (*pager, error) {
+	after, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+	return &pager{limit: limit, after: after}, nil
+}
+
+// encodeCursor turns a relative path into an opaque cursor
+func encodeCursor(path string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(filepath.ToSlash(path)))
+}
+
+// decodeCursor turns an opaque cursor back into a relative path
+func decodeCursor(cursor string) (string, error) {
+	if cursor == "" {
+		return "", nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", fmt.Errorf("invalid cursor: %s", cursor)
+	}
+	return string(data), nil
+}
+
+// comparePaths orders slash-separated paths the way a sorted depth-first walk visits them:
+// component by component, with a directory before its children
+func comparePaths(a, b string) int {
+	ap := strings.Split(filepath.ToSlash(a), "/")
+	bp := strings.Split(filepath.ToSlash(b), "/")
+	for i := 0; i < len(ap) && i < len(bp); i++ {
+		if c := strings.Compare(ap[i], bp[i]); c != 0 {
+			return c
+		}
+	}
+	return len(ap) - len(bp)
+}
+
+// isAncestor reports whether dir is a proper ancestor of path
+func isAncestor(dir, path string) bool {
+	dir = filepath.ToSlash(dir)
+	path = filepath.ToSlash(path)
+	return dir == "." || strings.HasPrefix(path, dir+"/")
+}
+
+// seek reports whether an entry at rel has already been returned on a previous page.
+// For directories whose whole subtree precedes the cursor it returns filepath.SkipDir.
+func (p *pager) seek(rel string, isDir bool) (bool, error) {
+	if p.after == "" || comparePaths(rel, p.after) > 0 {
+		return false, nil
+	}
+	if isDir && !isAncestor(rel, p.after) {
+		return true, filepath.SkipDir
+	}
+	return true, nil
+}
+
+// add records a result and returns errPageFull once the page is complete and
+// at least one further result is known to exist
+func (p *pager) add(rel string) error {
+	if len(p.results) >= p.limit {
+		p.next = encodeCursor(p.results[len(p.results)-1])
+		return errPageFull
+	}
+	p.results = append(p.results, rel)
+	return nil
+}
+
+// finish converts the errPageFull sentinel into a clean walk result
+func (p *pager) finish(err error) error {
+	if errors.Is(err, errPageFull) {
+		return nil
+	}
+	return err
+}
+
+// offsetPage returns the [start, end) window of a fully collected, ranked result set.
+// Cursors for such results encode an offset rather than a path.
+func offsetPage(total, limit int, cursor string) (int, int, string, error) {
+	start := 0
+	if cursor != "" {
+		decoded, err := decodeCursor(cursor)
+		if err == nil {
+			start, err = strconv.Atoi(decoded)
+		}
+		if err != nil || start < 0 {
+			return 0, 0, "", fmt.Errorf("invalid cursor: %s", cursor)
+		}
+	}
+	if start > total {
+		start = total
+	}
+
+	end := start + limit
+	if end >= total {
+		return start, total, "", nil
+	}
+	return start, end, encodeCursor(strconv.Itoa(end)), nil
+}
+
+// resultLimit resolves the page size for a call: the requested limit, capped by the
+// repository's max_results, falling back to the server-wide max_results
+func (s *Server) resultLimit(repoName string, arguments map[string]interface{}) int {
+	s.mu.RLock()
+	limit := s.maxResults
+	if repo, ok := s.repos[repoName]; ok && repo.MaxResults > 0 {
+		limit = repo.MaxResults
+	}
+	s.mu.RUnlock()
+
+	if limit <= 0 {
+		limit = defaultMaxResults
+	}
+	if requested := intArgument(arguments, "limit", 0); requested > 0 && requested < limit {
+		limit = requested
+	}
+	return limit
+}
+
+// withPagination adds the limit and cursor properties shared by paginated tools
+func withPagination(properties map[string]interface{}) map[string]interface{} {
+	properties["limit"] = map[string]interface{}{
+		"type":        "integer",
+		"description": "Maximum number of results to return (default and maximum: the repository's max_results)",
+	}
+	properties["cursor"] = map[string]interface{}{
+		"type":        "string",
+		"description": "Cursor from a previous call's next_cursor to continue listing",
+	}
+	return properties
+}
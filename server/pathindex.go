@@ -0,0 +1,102 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/vimalk78/fs-mcp/backends"
+	"github.com/vimalk78/fs-mcp/policy"
+)
+
+const (
+	// pathIndexTTL is how long a repository's path index is reused before it is rebuilt
+	pathIndexTTL = 5 * time.Minute
+	// maxIndexedPaths bounds the memory used by a single repository's path index
+	maxIndexedPaths = 200000
+)
+
+// pathIndex is a cached list of file paths in a repository, relative to its root
+type pathIndex struct {
+	paths     []string
+	built     time.Time
+	truncated bool
+}
+
+// pathIndexCache holds one path index per repository name
+type pathIndexCache struct {
+	mu      sync.Mutex
+	indexes map[string]*pathIndex
+	open    func(ctx context.Context, repoName string) (backends.FileSystem, error)
+}
+
+// get returns the path index for a repository, building it if missing, stale or refresh is set
+func (c *pathIndexCache) get(ctx context.Context, repoName string, refresh bool) (*pathIndex, error) {
+	c.mu.Lock()
+	idx, ok := c.indexes[repoName]
+	c.mu.Unlock()
+	if ok && !refresh && time.Since(idx.built) < pathIndexTTL {
+		return idx, nil
+	}
+
+	fs, err := c.open(ctx, repoName)
+	if err != nil {
+		return nil, err
+	}
+	idx, err = buildPathIndex(ctx, fs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to index %s: %w", repoName, err)
+	}
+
+	c.mu.Lock()
+	c.indexes[repoName] = idx
+	c.mu.Unlock()
+	return idx, nil
+}
+
+// clear drops all cached indexes (called when the config is reloaded)
+func (c *pathIndexCache) clear() {
+	c.mu.Lock()
+	c.indexes = make(map[string]*pathIndex)
+	c.mu.Unlock()
+}
+
+// buildPathIndex walks a FileSystem and records the relative path of every regular file
+func buildPathIndex(ctx context.Context, fs backends.FileSystem) (*pathIndex, error) {
+	idx := &pathIndex{built: time.Now()}
+	basePath := fs.BasePath()
+	prog := progressFrom(ctx)
+
+	err := fs.Walk(ctx, ".", func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == basePath {
+			return nil
+		}
+		if policy.ShouldSkip(path) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		prog.scanned(info.IsDir())
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		if len(idx.paths) >= maxIndexedPaths {
+			idx.truncated = true
+			return errPageFull
+		}
+		rel, _ := filepath.Rel(basePath, path)
+		idx.paths = append(idx.paths, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil && err != errPageFull {
+		return nil, err
+	}
+	return idx, nil
+}
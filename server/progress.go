@@ -0,0 +1,105 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// progressInterval is the minimum time between progress notifications for one call, so
+// that walking a large tree doesn't flood stdout
+const progressInterval = 500 * time.Millisecond
+
+// progress reports how far a long-running tool call has got with notifications/progress,
+// when the client asked for them with a progress token. Walks count what they visit and
+// match; a nil *progress ignores all of it, so walks needn't check. It is safe for
+// concurrent use by the repositories of a cross-repository call.
+type progress struct {
+	token  interface{}
+	notify func(method string, params interface{}) error
+	start  time.Time
+
+	dirs    atomic.Int64
+	entries atomic.Int64
+	matches atomic.Int64
+
+	mu     sync.Mutex
+	last   time.Time
+	closed bool // the call has been answered; a handler still running must stay quiet
+}
+
+// progressKey is the context key of a call's *progress
+type progressKey struct{}
+
+// withProgress returns a context that carries progress reporting for token
+func withProgress(ctx context.Context, token interface{}, notify func(method string, params interface{}) error) context.Context {
+	now := time.Now()
+	return context.WithValue(ctx, progressKey{}, &progress{token: token, notify: notify, start: now, last: now})
+}
+
+// progressFrom returns the progress reporting of a call, or nil if the client didn't ask
+func progressFrom(ctx context.Context) *progress {
+	p, _ := ctx.Value(progressKey{}).(*progress)
+	return p
+}
+
+// scanned counts one walked entry and reports progress if it's time to
+func (p *progress) scanned(isDir bool) {
+	if p == nil {
+		return
+	}
+	if isDir {
+		p.dirs.Add(1)
+	}
+	p.entries.Add(1)
+	p.report()
+}
+
+// matched counts results added to the call's output
+func (p *progress) matched(n int) {
+	if p == nil || n <= 0 {
+		return
+	}
+	p.matches.Add(int64(n))
+}
+
+// close stops reporting once the call has been answered
+func (p *progress) close() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+}
+
+// report sends a notification unless one was sent less than progressInterval ago.
+// Progress is the number of entries scanned, which only grows; the total is unknown.
+func (p *progress) report() {
+	// Held while sending, so that nothing is sent after close returns
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	if p.closed || now.Sub(p.last) < progressInterval {
+		return
+	}
+	p.last = now
+
+	dirs, entries, matches := p.dirs.Load(), p.entries.Load(), p.matches.Load()
+	elapsed := now.Sub(p.start)
+	err := p.notify("notifications/progress", map[string]interface{}{
+		"progressToken": p.token,
+		"progress":      entries,
+		"message": fmt.Sprintf("scanned %d entries in %d directories, %d matched, %s elapsed",
+			entries, dirs, matches, elapsed.Round(100*time.Millisecond)),
+		"directories": dirs,
+		"matches":     matches,
+		"elapsed_ms":  elapsed.Milliseconds(),
+	})
+	if err != nil {
+		log.Printf("Failed to send progress: %v", err)
+	}
+}
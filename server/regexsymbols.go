@@ -0,0 +1,248 @@
+package server
+
+import (
+	"regexp"
+	"strings"
+)
+
+// blockStyle tells a regexExtractor how to find where a definition ends
+type blockStyle int
+
+const (
+	blockBraces blockStyle = iota // C-like languages: balanced { }
+	blockIndent                   // Python, Ruby: the next line indented at or below the definition
+)
+
+// symbolRule is one ctags-style pattern. The first submatch is the symbol name.
+type symbolRule struct {
+	re         *regexp.Regexp
+	kind       string
+	nestedKind string // kind to use when defined inside a container (e.g. "method" for a func in a class)
+	container  bool   // symbols defined within this one get it as their parent
+	nestedOnly bool   // only matches inside a container (e.g. method patterns that would otherwise be too loose)
+}
+
+// regexExtractor extracts symbols line by line with regular expressions
+type regexExtractor struct {
+	rules   []symbolRule
+	blocks  blockStyle
+	imports *regexp.Regexp // import lines, for outlines
+}
+
+// rule builds a symbolRule, panicking on an invalid pattern like regexp.MustCompile
+func rule(pattern, kind string) symbolRule {
+	return symbolRule{re: regexp.MustCompile(pattern), kind: kind}
+}
+
+func (r symbolRule) nested(kind string) symbolRule { r.nestedKind = kind; return r }
+func (r symbolRule) containerRule() symbolRule     { r.container = true; return r }
+func (r symbolRule) onlyNested() symbolRule        { r.nestedOnly = true; return r }
+
+// controlKeywords are words that loose method patterns must not treat as symbol names
+var controlKeywords = map[string]bool{
+	"if": true, "for": true, "while": true, "switch": true, "catch": true, "return": true,
+	"function": true, "else": true, "do": true, "try": true, "new": true, "throw": true,
+	"sizeof": true, "elif": true, "foreach": true, "using": true, "lock": true,
+}
+
+func init() {
+	RegisterSymbolExtractor(&regexExtractor{blocks: blockIndent, imports: importPatterns["python"], rules: []symbolRule{
+		rule(`^\s*class\s+(\w+)`, "class").containerRule(),
+		rule(`^\s*(?:async\s+)?def\s+(\w+)\s*\(`, "func").nested("method"),
+		rule(`^([A-Z][A-Z0-9_]*)\s*(?::[^=]+)?=`, "const"),
+	}}, ".py", ".pyi")
+
+	jsRules := []symbolRule{
+		rule(`^\s*(?:export\s+)?(?:default\s+)?(?:abstract\s+)?class\s+(\w+)`, "class").containerRule(),
+		rule(`^\s*(?:export\s+)?(?:declare\s+)?interface\s+(\w+)`, "interface").containerRule(),
+		rule(`^\s*(?:export\s+)?(?:declare\s+)?(?:const\s+)?enum\s+(\w+)`, "enum"),
+		rule(`^\s*(?:export\s+)?(?:declare\s+)?type\s+(\w+)\s*(?:<[^=]*>)?\s*=`, "type"),
+		rule(`^\s*(?:export\s+)?(?:default\s+)?(?:async\s+)?function\s*\*?\s*(\w+)`, "func"),
+		rule(`^\s*(?:export\s+)?(?:const|let|var)\s+(\w+)\s*(?::[^=]+)?=\s*(?:async\s+)?(?:function\b|\([^)]*\)\s*(?::[^=]+)?=>|\w+\s*=>)`, "func"),
+		rule(`^\s+(?:(?:public|private|protected|static|async|readonly|override|abstract|get|set)\s+)*\*?(\w+)\s*(?:<[^>]*>)?\s*\([^)]*\)?\s*(?::[^{;]+)?\{?\s*$`, "method").onlyNested(),
+	}
+	RegisterSymbolExtractor(&regexExtractor{blocks: blockBraces, imports: importPatterns["js"], rules: jsRules},
+		".js", ".jsx", ".mjs", ".cjs", ".ts", ".tsx", ".mts", ".cts")
+
+	RegisterSymbolExtractor(&regexExtractor{blocks: blockBraces, imports: importPatterns["rust"], rules: []symbolRule{
+		rule(`^\s*(?:pub(?:\([^)]*\))?\s+)?(?:async\s+)?(?:const\s+)?(?:unsafe\s+)?(?:extern\s+"[^"]*"\s+)?fn\s+(\w+)`, "func").nested("method"),
+		rule(`^\s*(?:pub(?:\([^)]*\))?\s+)?struct\s+(\w+)`, "struct"),
+		rule(`^\s*(?:pub(?:\([^)]*\))?\s+)?enum\s+(\w+)`, "enum"),
+		rule(`^\s*(?:pub(?:\([^)]*\))?\s+)?(?:unsafe\s+)?trait\s+(\w+)`, "trait").containerRule(),
+		rule(`^\s*(?:unsafe\s+)?impl(?:<[^>]*>)?\s+(?:[\w:<>, ]+\s+for\s+)?(\w+)`, "impl").containerRule(),
+		rule(`^\s*(?:pub(?:\([^)]*\))?\s+)?mod\s+(\w+)`, "module"),
+		rule(`^\s*(?:pub(?:\([^)]*\))?\s+)?type\s+(\w+)`, "type"),
+		rule(`^\s*(?:pub(?:\([^)]*\))?\s+)?(?:const|static)\s+(?:mut\s+)?(\w+)\s*:`, "const"),
+		rule(`^\s*macro_rules!\s*(\w+)`, "macro"),
+	}}, ".rs")
+
+	javaLike := []symbolRule{
+		rule(`^\s*(?:(?:public|protected|private|internal|static|final|abstract|sealed|partial|data|open)\s+)*(?:class|record)\s+(\w+)`, "class").containerRule(),
+		rule(`^\s*(?:(?:public|protected|private|internal|static|sealed|partial)\s+)*interface\s+(\w+)`, "interface").containerRule(),
+		rule(`^\s*(?:(?:public|protected|private|internal|static)\s+)*enum\s+(?:class\s+)?(\w+)`, "enum").containerRule(),
+		rule(`^\s*(?:(?:public|protected|private|internal|static)\s+)*struct\s+(\w+)`, "struct").containerRule(),
+		rule(`^\s*namespace\s+([\w.]+)`, "namespace"),
+		rule(`^\s*(?:(?:public|protected|private|internal|static|final|abstract|synchronized|native|default|override|virtual|async|extern|unsafe|new)\s+)+[\w<>\[\]?,. ]+?\s+(\w+)\s*(?:<[^>]*>)?\s*\(`, "method").nested("method"),
+		rule(`^\s*(?:(?:private|public|protected|internal|override|open|suspend|inline)\s+)*fun\s+(?:<[^>]*>\s*)?(?:[\w.]+\.)?(\w+)\s*\(`, "func").nested("method"),
+	}
+	RegisterSymbolExtractor(&regexExtractor{blocks: blockBraces, imports: importPatterns["java"], rules: javaLike}, ".java", ".cs", ".kt", ".kts", ".scala")
+
+	RegisterSymbolExtractor(&regexExtractor{blocks: blockBraces, imports: importPatterns["c"], rules: []symbolRule{
+		rule(`^\s*(?:typedef\s+)?struct\s+(\w+)\s*(?:\{|$)`, "struct").containerRule(),
+		rule(`^\s*(?:template\s*<[^>]*>\s*)?class\s+(\w+)\s*(?:final\s*)?(?::[^{]*)?(?:\{|$)`, "class").containerRule(),
+		rule(`^\s*(?:typedef\s+)?enum\s+(?:class\s+)?(\w+)`, "enum"),
+		rule(`^\s*namespace\s+(\w+)`, "namespace"),
+		rule(`^#\s*define\s+(\w+)`, "macro"),
+		rule(`^(?:[A-Za-z_][\w:<>,*&\s]*?[\s*&])?((?:\w+::)*~?\w+)\s*\([^;]*$`, "func"),
+	}}, ".c", ".h", ".cc", ".cpp", ".cxx", ".hh", ".hpp", ".hxx")
+
+	RegisterSymbolExtractor(&regexExtractor{blocks: blockIndent, imports: importPatterns["ruby"], rules: []symbolRule{
+		rule(`^\s*class\s+([\w:]+)`, "class").containerRule(),
+		rule(`^\s*module\s+([\w:]+)`, "module").containerRule(),
+		rule(`^\s*def\s+(?:self\.)?(\w+[?!=]?)`, "func").nested("method"),
+	}}, ".rb")
+
+	RegisterSymbolExtractor(&regexExtractor{blocks: blockBraces, imports: importPatterns["php"], rules: []symbolRule{
+		rule(`^\s*(?:(?:abstract|final)\s+)?class\s+(\w+)`, "class").containerRule(),
+		rule(`^\s*interface\s+(\w+)`, "interface").containerRule(),
+		rule(`^\s*trait\s+(\w+)`, "trait").containerRule(),
+		rule(`^\s*(?:(?:public|protected|private|static|abstract|final)\s+)*function\s+&?(\w+)`, "func").nested("method"),
+	}}, ".php")
+
+	RegisterSymbolExtractor(&regexExtractor{blocks: blockBraces, rules: []symbolRule{
+		rule(`^\s*function\s+([\w-]+)`, "func"),
+		rule(`^\s*([\w-]+)\s*\(\)\s*\{?`, "func"),
+	}}, ".sh", ".bash", ".zsh")
+}
+
+// indentOf returns the width of a line's leading whitespace (tabs count as 4)
+func indentOf(line string) int {
+	width := 0
+	for _, r := range line {
+		switch r {
+		case ' ':
+			width++
+		case '\t':
+			width += 4
+		default:
+			return width
+		}
+	}
+	return width
+}
+
+// container is an open definition that later symbols may be nested in
+type container struct {
+	name    string
+	endLine int
+}
+
+func (e *regexExtractor) Extract(path string, content []byte) []Symbol {
+	lines := strings.Split(string(content), "\n")
+	var symbols []Symbol
+	var open []container
+
+	for i, line := range lines {
+		lineNo := i + 1
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "//") || strings.HasPrefix(trimmed, "*") ||
+			(strings.HasPrefix(trimmed, "#") && !strings.HasPrefix(trimmed, "#define") && !strings.HasPrefix(trimmed, "# define")) {
+			continue
+		}
+
+		// Close containers that ended before this line
+		for len(open) > 0 && open[len(open)-1].endLine < lineNo {
+			open = open[:len(open)-1]
+		}
+
+		for _, r := range e.rules {
+			m := r.re.FindStringSubmatch(line)
+			if m == nil || controlKeywords[m[1]] {
+				continue
+			}
+			if r.nestedOnly && len(open) == 0 {
+				continue
+			}
+
+			s := Symbol{
+				Name:      m[1],
+				Kind:      r.kind,
+				Line:      lineNo,
+				EndLine:   e.blockEnd(lines, i),
+				Signature: strings.TrimSpace(strings.TrimSuffix(trimmed, "{")),
+			}
+			if len(open) > 0 {
+				s.Parent = open[len(open)-1].name
+				if r.nestedKind != "" {
+					s.Kind = r.nestedKind
+				}
+			}
+			symbols = append(symbols, s)
+
+			if r.container {
+				open = append(open, container{name: s.Name, endLine: s.EndLine})
+			}
+			break
+		}
+	}
+	return symbols
+}
+
+// blockEnd estimates the last line (1-based) of the definition starting at line index start
+func (e *regexExtractor) blockEnd(lines []string, start int) int {
+	if e.blocks == blockIndent {
+		indent := indentOf(lines[start])
+		end := start
+		for i := start + 1; i < len(lines); i++ {
+			trimmed := strings.TrimSpace(lines[i])
+			if trimmed == "" {
+				continue
+			}
+			if indentOf(lines[i]) <= indent {
+				// Ruby closes blocks with an "end" at the definition's indentation
+				if trimmed == "end" {
+					end = i
+				}
+				break
+			}
+			end = i
+		}
+		return end + 1
+	}
+
+	depth, opened := 0, false
+	for i := start; i < len(lines); i++ {
+		inString := byte(0)
+		line := lines[i]
+		for j := 0; j < len(line); j++ {
+			c := line[j]
+			switch {
+			case inString != 0:
+				if c == '\\' {
+					j++
+				} else if c == inString {
+					inString = 0
+				}
+			case c == '"' || c == '\'' || c == '`':
+				inString = c
+			case c == '/' && j+1 < len(line) && line[j+1] == '/':
+				j = len(line)
+			case c == '{':
+				depth++
+				opened = true
+			case c == '}':
+				depth--
+				if opened && depth <= 0 {
+					return i + 1
+				}
+			case c == ';' && !opened && depth == 0:
+				// A declaration without a body, e.g. a prototype or abstract method
+				return i + 1
+			}
+		}
+		if !opened && i > start && i-start > 20 {
+			break
+		}
+	}
+	return start + 1
+}
@@ -0,0 +1,208 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+
+	"github.com/vimalk78/fs-mcp/backends"
+	"github.com/vimalk78/fs-mcp/policy"
+)
+
+// directoryMIMEType is reported for repo:// URIs naming directories
+const directoryMIMEType = "inode/directory"
+
+// repoResource is a parsed repo://repo-name/path URI
+type repoResource struct {
+	repo     string
+	path     string // relative path within the repository, "" for the root
+	metadata bool   // the ?metadata form: describe the entry instead of reading it
+}
+
+// parseRepoURI parses repo://repo-name/path/to/file, optionally followed by ?metadata
+func parseRepoURI(uri string) (*repoResource, error) {
+	if !strings.HasPrefix(uri, "repo://") {
+		return nil, fmt.Errorf("invalid URI scheme. Expected repo://, got: %s", uri)
+	}
+
+	rest := strings.TrimPrefix(uri, "repo://")
+	r := &repoResource{}
+	if i := strings.IndexByte(rest, '?'); i >= 0 {
+		switch rest[i+1:] {
+		case "metadata", "metadata=true":
+			r.metadata = true
+		default:
+			return nil, fmt.Errorf("unsupported query in URI: %s", uri)
+		}
+		rest = rest[:i]
+	}
+
+	parts := strings.SplitN(rest, "/", 2)
+	r.repo = parts[0]
+	if r.repo == "" {
+		return nil, fmt.Errorf("invalid URI format: %s", uri)
+	}
+	if len(parts) > 1 {
+		r.path = strings.Trim(parts[1], "/")
+	}
+	return r, nil
+}
+
+// repoURI builds the repo:// URI of a path within a repository. Directories end in "/".
+func repoURI(repo, relPath string, isDir bool) string {
+	relPath = filepath.ToSlash(relPath)
+	if relPath == "." {
+		relPath = ""
+	}
+	uri := "repo://" + repo + "/" + relPath
+	if isDir && relPath != "" {
+		uri += "/"
+	}
+	return uri
+}
+
+// extensionMIMEType guesses a MIME type from a file name alone, for listings where
+// reading every file to sniff it would be too expensive
+func extensionMIMEType(name string) string {
+	byExt := mime.TypeByExtension(strings.ToLower(path.Ext(name)))
+	return strings.TrimSpace(strings.SplitN(byExt, ";", 2)[0])
+}
+
+// handleListResources answers resources/list with the root of every repository, so
+// clients can browse repositories without tool calls
+func (s *Server) handleListResources(ctx context.Context, id interface{}, params json.RawMessage) mcp.JSONRPCMessage {
+	s.mu.RLock()
+	resources := make([]mcp.Resource, 0, len(s.repos))
+	for name, repo := range s.repos {
+		resources = append(resources, mcp.Resource{
+			URI:         repoURI(name, "", true),
+			Name:        name,
+			Description: fmt.Sprintf("Root of the %s repository %s", repo.Type, repo.Location()),
+			MIMEType:    directoryMIMEType,
+		})
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(resources, func(i, j int) bool { return resources[i].Name < resources[j].Name })
+	return rpcResult(id, mcp.ListResourcesResult{Resources: resources})
+}
+
+// handleResourceRead answers resources/read for any repo:// URI. mcp-go matches
+// templates one path segment at a time, so nested paths are routed here instead.
+func (s *Server) handleResourceRead(ctx context.Context, id interface{}, params json.RawMessage) mcp.JSONRPCMessage {
+	var request mcp.ReadResourceRequest
+	if err := json.Unmarshal(params, &request.Params); err != nil || request.Params.URI == "" {
+		return rpcError(id, mcp.INVALID_PARAMS, "Invalid resources/read request")
+	}
+
+	ctx, audit := s.audit.begin(ctx, "resource", "")
+	contents, err := s.readResource(ctx, request.Params.URI)
+	audit.finishResource(contents, err)
+	if err != nil {
+		return rpcError(id, mcp.INTERNAL_ERROR, err.Error())
+	}
+	return rpcResult(id, mcp.ReadResourceResult{Contents: contents})
+}
+
+// directoryEntry is one child in a directory listing resource
+type directoryEntry struct {
+	Name     string `json:"name"`
+	URI      string `json:"uri"`
+	Type     string `json:"type"`
+	Size     int64  `json:"size,omitempty"`
+	Modified string `json:"modified"`
+	MIMEType string `json:"mime_type,omitempty"`
+}
+
+// directoryListing renders a directory as a JSON listing whose entries link to their
+// own repo:// URIs
+func (s *Server) directoryListing(ctx context.Context, repo string, fs backends.FileSystem, relPath string) (string, error) {
+	entries, err := fs.ReadDir(ctx, relPath)
+	if err != nil {
+		return "", err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	limit := s.resultLimit(repo, nil)
+	children := make([]directoryEntry, 0, len(entries))
+	truncated := false
+	for _, entry := range entries {
+		childPath := filepath.Join(relPath, entry.Name())
+		if policy.ShouldSkip(childPath) {
+			continue
+		}
+		if len(children) == limit {
+			truncated = true
+			break
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		child := directoryEntry{
+			Name:     entry.Name(),
+			URI:      repoURI(repo, childPath, info.IsDir()),
+			Type:     entryType(info.Mode()),
+			Modified: info.ModTime().Format(time.RFC3339),
+		}
+		if info.Mode().IsRegular() {
+			child.Size = info.Size()
+			child.MIMEType = extensionMIMEType(entry.Name())
+		}
+		children = append(children, child)
+	}
+
+	listing := map[string]interface{}{
+		"repository": repo,
+		"path":       filepath.ToSlash(relPath),
+		"entries":    children,
+	}
+	if truncated {
+		listing["truncated"] = true
+	}
+	data, _ := json.MarshalIndent(listing, "", "  ")
+	return string(data), nil
+}
+
+// resourceMetadata describes a file or directory: type, size, modification time, mode,
+// MIME type and, for files, a SHA-256 of the content
+func resourceMetadata(ctx context.Context, repo string, fs backends.FileSystem, relPath string) (string, error) {
+	info, err := fs.Stat(ctx, relPath)
+	if err != nil {
+		return "", err
+	}
+
+	meta := map[string]interface{}{
+		"uri":        repoURI(repo, relPath, info.IsDir()),
+		"repository": repo,
+		"path":       filepath.ToSlash(relPath),
+		"type":       entryType(info.Mode()),
+		"modified":   info.ModTime().Format(time.RFC3339),
+		"mode":       info.Mode().String(),
+	}
+	if info.IsDir() {
+		meta["mime_type"] = directoryMIMEType
+	} else if info.Mode().IsRegular() {
+		content, err := fs.ReadFile(ctx, relPath)
+		if err != nil {
+			return "", err
+		}
+		sum := sha256.Sum256(content)
+		meta["size"] = info.Size()
+		meta["sha256"] = hex.EncodeToString(sum[:])
+		meta["mime_type"] = decodeContent(relPath, content).MIMEType
+	}
+
+	data, _ := json.MarshalIndent(meta, "", "  ")
+	return string(data), nil
+}
@@ -0,0 +1,327 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bmatcuk/doublestar/v4"
+
+	"github.com/vimalk78/fs-mcp/policy"
+)
+
+// pathMatcher matches a slash-separated relative path
+type pathMatcher func(rel string) bool
+
+// searchFilter holds the compiled criteria for search_files
+type searchFilter struct {
+	include       []pathMatcher
+	exclude       []pathMatcher
+	entryType     string // "file", "dir", "symlink" or "any"
+	minSize       int64
+	maxSize       int64 // 0 means no upper bound
+	modifiedSince time.Time
+	sortBy        string // "name", "size" or "mtime"
+	descending    bool
+}
+
+// searchMatch is a walk result kept around for sorting
+type searchMatch struct {
+	path string
+	info fs.FileInfo
+}
+
+// stringList reads a tool argument that may be a single string or an array of strings
+func stringList(arguments map[string]interface{}, name string) []string {
+	switch v := arguments[name].(type) {
+	case string:
+		if v == "" {
+			return nil
+		}
+		return []string{v}
+	case []interface{}:
+		var list []string
+		for _, item := range v {
+			if s, ok := item.(string); ok && s != "" {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
+
+// compileMatcher builds a matcher for a glob or regular expression.
+// Globs containing a '/' are matched against the relative path (with ** support),
+// other globs against the base name only. Regular expressions always see the relative path.
+func compileMatcher(pattern string, regex bool) (pathMatcher, error) {
+	if regex {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression %q: %w", pattern, err)
+		}
+		return re.MatchString, nil
+	}
+
+	if !doublestar.ValidatePattern(pattern) {
+		return nil, fmt.Errorf("invalid glob pattern: %s", pattern)
+	}
+	if strings.Contains(pattern, "/") {
+		return func(rel string) bool {
+			matched, _ := doublestar.Match(pattern, rel)
+			return matched
+		}, nil
+	}
+	return func(rel string) bool {
+		matched, _ := doublestar.Match(pattern, filepath.Base(rel))
+		return matched
+	}, nil
+}
+
+// parseModifiedSince accepts an RFC 3339 timestamp or a duration such as "24h" meaning that long ago
+func parseModifiedSince(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid modified_since: %s (expected RFC 3339 timestamp or duration like '24h')", value)
+}
+
+// parseSearchFilter builds a searchFilter from search_files arguments
+func parseSearchFilter(arguments map[string]interface{}) (*searchFilter, error) {
+	regex, _ := arguments["regex"].(bool)
+
+	includes := stringList(arguments, "pattern")
+	includes = append(includes, stringList(arguments, "include")...)
+	if len(includes) == 0 {
+		return nil, fmt.Errorf("pattern or include parameter is required")
+	}
+
+	f := &searchFilter{
+		entryType: "file",
+		sortBy:    "name",
+	}
+	for _, pattern := range includes {
+		m, err := compileMatcher(pattern, regex)
+		if err != nil {
+			return nil, err
+		}
+		f.include = append(f.include, m)
+	}
+	for _, pattern := range stringList(arguments, "exclude") {
+		m, err := compileMatcher(pattern, regex)
+		if err != nil {
+			return nil, err
+		}
+		f.exclude = append(f.exclude, m)
+	}
+
+	if t, ok := arguments["type"].(string); ok && t != "" {
+		switch t {
+		case "file", "dir", "symlink", "any":
+			f.entryType = t
+		default:
+			return nil, fmt.Errorf("invalid type: %s (expected file, dir, symlink or any)", t)
+		}
+	}
+
+	f.minSize = int64(intArgument(arguments, "min_size", 0))
+	f.maxSize = int64(intArgument(arguments, "max_size", 0))
+
+	if since, ok := arguments["modified_since"].(string); ok && since != "" {
+		t, err := parseModifiedSince(since)
+		if err != nil {
+			return nil, err
+		}
+		f.modifiedSince = t
+	}
+
+	if s, ok := arguments["sort"].(string); ok && s != "" {
+		switch s {
+		case "name", "size", "mtime":
+			f.sortBy = s
+		default:
+			return nil, fmt.Errorf("invalid sort: %s (expected name, size or mtime)", s)
+		}
+	}
+	// Size and mtime default to largest/newest first
+	f.descending = f.sortBy != "name"
+	if order, ok := arguments["order"].(string); ok && order != "" {
+		switch order {
+		case "asc":
+			f.descending = false
+		case "desc":
+			f.descending = true
+		default:
+			return nil, fmt.Errorf("invalid order: %s (expected asc or desc)", order)
+		}
+	}
+
+	return f, nil
+}
+
+// streaming reports whether results can be paged directly from the walk order
+func (f *searchFilter) streaming() bool {
+	return f.sortBy == "name" && !f.descending
+}
+
+// excluded reports whether a relative path matches any exclude pattern
+func (f *searchFilter) excluded(rel string) bool {
+	for _, m := range f.exclude {
+		if m(rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches reports whether an entry satisfies the include patterns and metadata filters
+func (f *searchFilter) matches(rel string, info fs.FileInfo) bool {
+	if f.entryType != "any" && entryType(info.Mode()) != f.entryType {
+		return false
+	}
+	if !info.IsDir() {
+		if info.Size() < f.minSize {
+			return false
+		}
+		if f.maxSize > 0 && info.Size() > f.maxSize {
+			return false
+		}
+	}
+	if !f.modifiedSince.IsZero() && info.ModTime().Before(f.modifiedSince) {
+		return false
+	}
+	for _, m := range f.include {
+		if m(rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// sortMatches orders collected matches according to the filter
+func (f *searchFilter) sortMatches(matches []searchMatch) {
+	less := func(a, b searchMatch) bool {
+		switch f.sortBy {
+		case "size":
+			if a.info.Size() != b.info.Size() {
+				return a.info.Size() < b.info.Size()
+			}
+		case "mtime":
+			if !a.info.ModTime().Equal(b.info.ModTime()) {
+				return a.info.ModTime().Before(b.info.ModTime())
+			}
+		}
+		return comparePaths(a.path, b.path) < 0
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		if f.descending {
+			return less(matches[j], matches[i])
+		}
+		return less(matches[i], matches[j])
+	})
+}
+
+// pageSorted returns one page of sorted matches
+func pageSorted(matches []searchMatch, limit int, cursor string) ([]string, string, error) {
+	start, end, next, err := offsetPage(len(matches), limit, cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	results := make([]string, 0, end-start)
+	for _, m := range matches[start:end] {
+		results = append(results, m.path)
+	}
+	return results, next, nil
+}
+
+// searchFiles runs a search_files query against one repository and returns a page of
+// matching paths. The walk stops when ctx is done.
+func (s *Server) searchFiles(ctx context.Context, repo, path string, filter *searchFilter, limit int, cursor string) ([]string, string, error) {
+	fs, err := s.FileSystem(ctx, repo)
+	if err != nil {
+		return nil, "", err
+	}
+
+	relRoot, err := policy.ValidatePath(fs.BasePath(), path)
+	if err != nil {
+		return nil, "", err
+	}
+
+	page, err := newPager(limit, "")
+	if err != nil {
+		return nil, "", err
+	}
+	if filter.streaming() {
+		if page, err = newPager(limit, cursor); err != nil {
+			return nil, "", err
+		}
+	}
+
+	var collected []searchMatch
+	basePath := fs.BasePath()
+	rootPath := filepath.Join(basePath, relRoot)
+	prog := progressFrom(ctx)
+
+	err = fs.Walk(ctx, relRoot, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == basePath || path == rootPath {
+			return nil
+		}
+		if policy.ShouldSkip(path) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		prog.scanned(info.IsDir())
+		relPath, _ := filepath.Rel(basePath, path)
+		relPath = filepath.ToSlash(relPath)
+		if relPath == "" || relPath == "." {
+			return nil
+		}
+		if filter.streaming() {
+			if seen, err := page.seek(relPath, info.IsDir()); seen {
+				return err
+			}
+		}
+		if filter.excluded(relPath) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !filter.matches(relPath, info) {
+			return nil
+		}
+		if info.IsDir() {
+			relPath += "/"
+		}
+		prog.matched(1)
+		if !filter.streaming() {
+			collected = append(collected, searchMatch{path: relPath, info: info})
+			return nil
+		}
+		return page.add(relPath)
+	})
+	if err = page.finish(err); err != nil {
+		return nil, "", err
+	}
+
+	if !filter.streaming() {
+		filter.sortMatches(collected)
+		return pageSorted(collected, limit, cursor)
+	}
+	return page.results, page.next, nil
+}
@@ -0,0 +1,187 @@
+// Package server serves configured repositories over the Model Context Protocol. A Server
+// can run on its own transport (ServeStdio, Serve) or add its tools to an existing mcp-go
+// server (Register).
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	mcpserver "github.com/mark3labs/mcp-go/server"
+
+	"github.com/vimalk78/fs-mcp/backends"
+	"github.com/vimalk78/fs-mcp/config"
+)
+
+// Server serves a set of repositories. It owns the repositories, the indexes and caches
+// built from them and the connections and processes their backends use.
+type Server struct {
+	mu         sync.RWMutex
+	repos      map[string]*backends.Repository
+	maxResults int
+	pool       *backends.Pool
+
+	tools              map[string]toolHandler
+	defaultToolTimeout int            // seconds; 0 means no limit
+	toolTimeouts       map[string]int // seconds by tool name
+
+	pathIndexes     *pathIndexCache
+	symbolIndexes   *symbolIndexCache
+	contentIndexes  *contentIndexManager
+	changeJournals  *changeJournalCache
+	changeSnapshots *snapshotStore
+	subscriptions   *subscriptionManager
+	audit           *auditLog
+
+	mcp       *mcpserver.MCPServer
+	transport *stdioServer
+}
+
+// NewServer creates a Server for a config. Tool schemas list the repositories configured
+// here; later changes (Reload) take effect in the tools but not in their schemas.
+func NewServer(cfg *config.Config) (*Server, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("no config")
+	}
+
+	s := &Server{
+		repos:           make(map[string]*backends.Repository),
+		tools:           make(map[string]toolHandler),
+		changeSnapshots: &snapshotStore{snapshots: make(map[string]*repoSnapshot)},
+		audit:           &auditLog{},
+	}
+	s.pool = backends.NewPool(s.repository)
+	s.pathIndexes = &pathIndexCache{indexes: make(map[string]*pathIndex), open: s.FileSystem}
+	s.symbolIndexes = &symbolIndexCache{indexes: make(map[string]*symbolIndex)}
+	s.contentIndexes = &contentIndexManager{indexes: make(map[string]*contentIndex), open: s.FileSystem}
+	s.changeJournals = &changeJournalCache{journals: make(map[string]*changeJournal)}
+	s.Reload(cfg)
+
+	s.mcp = mcpserver.NewMCPServer(
+		"multi-repo-server",
+		"1.0.0",
+		mcpserver.WithResourceCapabilities(true, false),
+	)
+	s.Register(s.mcp)
+	s.transport = newStdioServer(s.mcp)
+	s.audit.peer = s.transport.peer
+	s.transport.handle("tools/call", s.handleCallTool)
+	s.registerResources(s.transport)
+	return s, nil
+}
+
+// Reload replaces the server's repositories, dropping indexes, caches and subscriptions
+// of repositories that were removed or changed
+func (s *Server) Reload(cfg *config.Config) {
+	s.mu.Lock()
+	s.repos = cfg.Repositories
+	s.maxResults = cfg.MaxResults
+	s.defaultToolTimeout = cfg.ToolTimeout
+	s.toolTimeouts = cfg.ToolTimeouts
+	s.mu.Unlock()
+	s.pathIndexes.clear()
+	s.symbolIndexes.clear()
+	s.changeJournals.sync(cfg.Repositories)
+	s.contentIndexes.sync(cfg.Repositories)
+	s.pool.ConfigureCache(cfg.Cache)
+	s.audit.configure(cfg.Audit)
+	s.pool.Sync(cfg.Repositories)
+	s.subscriptions.prune(cfg.Repositories)
+}
+
+// Close stops indexing, drops subscriptions and closes all backend connections and the
+// audit log
+func (s *Server) Close() {
+	s.subscriptions.close()
+	s.contentIndexes.sync(nil)
+	s.pool.Close()
+	s.audit.close()
+}
+
+// Register adds the server's tools and resource templates to an mcp-go server, so they
+// can be mounted next to other tools. m must be created with WithResourceCapabilities.
+// Listing resources, subscriptions and cancelling tool calls need the server's own transport
+// (Serve, ServeStdio).
+func (s *Server) Register(m *mcpserver.MCPServer) {
+	s.registerTools(m)
+
+	// Add resource template for repository access
+	template := mcp.ResourceTemplate{
+		URITemplate: "repo://{repo}/{path}",
+		Name:        "Repository File",
+		Description: "Access files from configured repositories using repo://repo-name/path/to/file. Directory URIs return a JSON listing.",
+	}
+	m.AddResourceTemplate(template, s.handleReadResourceTemplate)
+
+	metadata := mcp.ResourceTemplate{
+		URITemplate: "repo://{repo}/{path}?metadata",
+		Name:        "Repository File Metadata",
+		Description: "Size, modification time, mode, MIME type and SHA-256 of a file or directory",
+		MIMEType:    "application/json",
+	}
+	m.AddResourceTemplate(metadata, s.handleReadResourceTemplate)
+}
+
+// registerResources adds the resource methods mcp-go doesn't handle to the transport
+func (s *Server) registerResources(transport *stdioServer) {
+	// Repository roots change with the config, and nested paths don't match mcp-go's
+	// templates, so listing and reading are handled by the transport
+	transport.handle("resources/list", s.handleListResources)
+	transport.handle("resources/read", s.handleResourceRead)
+
+	s.subscriptions = newSubscriptionManager(s.FileSystem, s.repository, func(uri string) {
+		if err := transport.notify("notifications/resources/updated", map[string]string{"uri": uri}); err != nil {
+			log.Printf("Failed to send update for %s: %v", uri, err)
+		}
+	})
+	transport.handle("resources/subscribe", s.handleSubscribe)
+	transport.handle("resources/unsubscribe", s.handleUnsubscribe)
+	transport.onDisconnect(s.subscriptions.reset)
+}
+
+// MCPServer returns the mcp-go server the Server's tools are registered on
+func (s *Server) MCPServer() *mcpserver.MCPServer {
+	return s.mcp
+}
+
+// Serve serves MCP as newline-delimited JSON-RPC, reading requests from in and writing
+// responses and notifications to out, until in is exhausted or ctx is done
+func (s *Server) Serve(ctx context.Context, in io.Reader, out io.Writer) error {
+	return s.transport.listen(ctx, in, out)
+}
+
+// ServeStdio serves MCP on stdin/stdout until stdin is closed or the process is signalled
+func (s *Server) ServeStdio() error {
+	return s.transport.serveStdio()
+}
+
+// repository returns a configured repository
+func (s *Server) repository(name string) (*backends.Repository, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	repo, ok := s.repos[name]
+	return repo, ok
+}
+
+// FileSystem returns a FileSystem for the given repository name. ctx bounds connecting to
+// the repository. A repository served from its mirror is noted on the result of the tool
+// call or resource read, and one opened for an audited call records what the call does
+// with it.
+func (s *Server) FileSystem(ctx context.Context, repoName string) (backends.FileSystem, error) {
+	repo, ok := s.repository(repoName)
+	if !ok {
+		return nil, fmt.Errorf("unknown repository: %s", repoName)
+	}
+	fs, err := s.pool.Open(ctx, repo)
+	if err != nil {
+		return nil, err
+	}
+	if synced, stale := backends.Stale(fs); stale {
+		staleReposFrom(ctx).add(repoName, synced)
+	}
+	return auditCallFrom(ctx).open(repo, fs), nil
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// staleRepos collects the repositories a tool call or resource read was served from
+// mirrors of, so that the result can say it may be out of date. It is safe for concurrent use by the
+// repositories of a cross-repository call.
+type staleRepos struct {
+	mu     sync.Mutex
+	synced map[string]time.Time // last sync by repository name
+}
+
+// staleKey is the context key of a call's *staleRepos
+type staleKey struct{}
+
+// withStaleRepos returns a context that collects the mirrors a call reads
+func withStaleRepos(ctx context.Context) (context.Context, *staleRepos) {
+	stale := &staleRepos{synced: make(map[string]time.Time)}
+	return context.WithValue(ctx, staleKey{}, stale), stale
+}
+
+// staleReposFrom returns the collector of a call, or nil outside tool calls and resource
+// reads
+func staleReposFrom(ctx context.Context) *staleRepos {
+	s, _ := ctx.Value(staleKey{}).(*staleRepos)
+	return s
+}
+
+// add records that a repository was served from its mirror
+func (s *staleRepos) add(repo string, synced time.Time) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.synced[repo] = synced
+	s.mu.Unlock()
+}
+
+// note describes the mirrors read, or returns "" if there were none
+func (s *staleRepos) note() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.synced) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(s.synced))
+	for name := range s.synced {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	lines := make([]string, len(names))
+	for i, name := range names {
+		lines[i] = fmt.Sprintf("Note: repository %s is unreachable; results come from its mirror, last synced %s, and may be stale.",
+			name, s.synced[name].Format(time.RFC3339))
+	}
+	return strings.Join(lines, "\n")
+}
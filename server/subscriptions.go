@@ -0,0 +1,384 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/mark3labs/mcp-go/mcp"
+
+	"github.com/vimalk78/fs-mcp/backends"
+	"github.com/vimalk78/fs-mcp/policy"
+)
+
+const (
+	// maxSubscriptions bounds the number of repo:// URIs a client may subscribe to
+	maxSubscriptions = 256
+	// subscriptionPollInterval is how often subscriptions on remote repositories are checked
+	subscriptionPollInterval = 5 * time.Second
+	// subscriptionEventDelay batches bursts of file system events before checking subscriptions
+	subscriptionEventDelay = 200 * time.Millisecond
+)
+
+// resourceState is what a subscription compares to decide whether a resource changed
+type resourceState struct {
+	exists   bool
+	isDir    bool
+	size     int64
+	modTime  time.Time
+	children uint64 // hash of a directory's entries
+}
+
+// subscription is one subscribed repo:// URI
+type subscription struct {
+	uri   string
+	repo  string
+	key   string // the repository's Key() when subscribed
+	path  string // relative path within the repository
+	local string // watched absolute path for local repositories; "" means polled
+	dir   string // directory watched for local, the path itself or its parent
+	state resourceState
+}
+
+// subscriptionManager tracks resource subscriptions and notifies the client when a
+// subscribed resource changes. Local repositories are watched with fsnotify; everything
+// else, and local paths that can't be watched, is polled.
+type subscriptionManager struct {
+	mu      sync.Mutex
+	subs    map[string]*subscription
+	watcher *fsnotify.Watcher
+	watched map[string]int // watched directory -> number of subscriptions using it
+	open    func(ctx context.Context, repoName string) (backends.FileSystem, error)
+	lookup  func(name string) (*backends.Repository, bool)
+	notify  func(uri string)
+	stop    chan struct{}
+	once    sync.Once
+}
+
+// newSubscriptionManager starts a manager that opens repositories with open, finds their
+// configuration with lookup and calls notify for every changed resource
+func newSubscriptionManager(open func(ctx context.Context, repoName string) (backends.FileSystem, error), lookup func(name string) (*backends.Repository, bool), notify func(uri string)) *subscriptionManager {
+	m := &subscriptionManager{
+		subs:    make(map[string]*subscription),
+		watched: make(map[string]int),
+		open:    open,
+		lookup:  lookup,
+		notify:  notify,
+		stop:    make(chan struct{}),
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Printf("Failed to start file watcher for subscriptions, polling instead: %v", err)
+	} else {
+		m.watcher = watcher
+	}
+	go m.run()
+	return m
+}
+
+// currentState stats a resource. Directories also hash their entries so that files being
+// added, removed or modified inside them count as a change.
+func currentState(ctx context.Context, fs backends.FileSystem, relPath string) resourceState {
+	info, err := fs.Stat(ctx, relPath)
+	if err != nil {
+		return resourceState{}
+	}
+	state := resourceState{exists: true, isDir: info.IsDir(), size: info.Size(), modTime: info.ModTime()}
+	if !info.IsDir() {
+		return state
+	}
+
+	entries, err := fs.ReadDir(ctx, relPath)
+	if err != nil {
+		return state
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	h := fnv.New64a()
+	for _, entry := range entries {
+		if policy.ShouldSkip(filepath.Join(relPath, entry.Name())) {
+			continue
+		}
+		fmt.Fprintf(h, "%s\x00", entry.Name())
+		if info, err := entry.Info(); err == nil {
+			fmt.Fprintf(h, "%d\x00%d\x00", info.Size(), info.ModTime().UnixNano())
+		}
+	}
+	state.children = h.Sum64()
+	return state
+}
+
+// subscribe starts watching a repo:// URI. Subscribing twice to the same URI is a no-op.
+func (m *subscriptionManager) subscribe(ctx context.Context, uri string) error {
+	res, err := parseRepoURI(uri)
+	if err != nil {
+		return err
+	}
+	if res.metadata {
+		return fmt.Errorf("subscribe to the resource itself, not its ?metadata form: %s", uri)
+	}
+	repo, ok := m.lookup(res.repo)
+	if !ok {
+		return fmt.Errorf("unknown repository: %s", res.repo)
+	}
+
+	fs, err := m.open(ctx, res.repo)
+	if err != nil {
+		return err
+	}
+	relPath := "."
+	if res.path != "" {
+		relPath, err = policy.ValidatePath(fs.BasePath(), res.path)
+		if err != nil {
+			return err
+		}
+		if policy.ShouldSkip(relPath) {
+			return fmt.Errorf("access denied: %s", res.path)
+		}
+	}
+	state := currentState(ctx, fs, relPath)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.subs[uri]; ok {
+		return nil
+	}
+	if len(m.subs) >= maxSubscriptions {
+		return fmt.Errorf("too many subscriptions (maximum %d)", maxSubscriptions)
+	}
+
+	sub := &subscription{uri: uri, repo: res.repo, key: repo.Key(), path: relPath, state: state}
+	if fs.Type() == "local" && m.watcher != nil {
+		// Watch the parent of a file so that replacing it by rename is seen too
+		sub.local = filepath.Join(fs.BasePath(), relPath)
+		sub.dir = filepath.Dir(sub.local)
+		if state.isDir {
+			sub.dir = sub.local
+		}
+		if m.watched[sub.dir] == 0 {
+			if err := m.watcher.Add(sub.dir); err != nil {
+				log.Printf("Failed to watch %s, polling instead: %v", sub.dir, err)
+				sub.local, sub.dir = "", ""
+			}
+		}
+		if sub.dir != "" {
+			m.watched[sub.dir]++
+		}
+	}
+	m.subs[uri] = sub
+	return nil
+}
+
+// unsubscribe stops watching a URI
+func (m *subscriptionManager) unsubscribe(uri string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.remove(uri)
+}
+
+// remove drops a subscription and its watch; the caller holds m.mu
+func (m *subscriptionManager) remove(uri string) {
+	sub, ok := m.subs[uri]
+	if !ok {
+		return
+	}
+	delete(m.subs, uri)
+	if sub.dir == "" {
+		return
+	}
+	m.watched[sub.dir]--
+	if m.watched[sub.dir] <= 0 {
+		delete(m.watched, sub.dir)
+		m.watcher.Remove(sub.dir)
+	}
+}
+
+// prune drops subscriptions on repositories that are no longer configured or have moved.
+// It only compares configurations, so a reload never waits on a repository.
+func (m *subscriptionManager) prune(repositories map[string]*backends.Repository) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for uri, sub := range m.subs {
+		if repo, ok := repositories[sub.repo]; !ok || repo.Key() != sub.key {
+			m.remove(uri)
+		}
+	}
+}
+
+// reset drops all subscriptions and their watches (called when the client disconnects).
+// The manager keeps running for the next connection.
+func (m *subscriptionManager) reset() {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for uri := range m.subs {
+		m.remove(uri)
+	}
+}
+
+// close drops all subscriptions and stops watching for good
+func (m *subscriptionManager) close() {
+	if m == nil {
+		return
+	}
+	m.once.Do(func() {
+		close(m.stop)
+		m.mu.Lock()
+		m.subs = make(map[string]*subscription)
+		m.watched = make(map[string]int)
+		if m.watcher != nil {
+			m.watcher.Close()
+		}
+		m.mu.Unlock()
+	})
+}
+
+// affected returns the URIs of local subscriptions touched by a file system event
+func (m *subscriptionManager) affected(name string) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var uris []string
+	for uri, sub := range m.subs {
+		if sub.local == "" {
+			continue
+		}
+		if sub.local == name || sub.dir == sub.local && filepath.Dir(name) == sub.local {
+			uris = append(uris, uri)
+		}
+	}
+	return uris
+}
+
+// polled returns the URIs of subscriptions that are checked periodically
+func (m *subscriptionManager) polled() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var uris []string
+	for uri, sub := range m.subs {
+		if sub.local == "" {
+			uris = append(uris, uri)
+		}
+	}
+	return uris
+}
+
+// check compares a subscription's resource with its last known state and notifies the
+// client if it changed
+func (m *subscriptionManager) check(uri string) {
+	m.mu.Lock()
+	sub, ok := m.subs[uri]
+	var repo, relPath string
+	if ok {
+		repo, relPath = sub.repo, sub.path
+	}
+	m.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	// A check that outlasts the poll interval would only delay the next one
+	ctx, cancel := context.WithTimeout(context.Background(), subscriptionPollInterval)
+	defer cancel()
+	fs, err := m.open(ctx, repo)
+	if err != nil {
+		return
+	}
+	state := currentState(ctx, fs, relPath)
+	if ctx.Err() != nil {
+		return
+	}
+
+	m.mu.Lock()
+	changed := m.subs[uri] == sub && state != sub.state
+	if changed {
+		sub.state = state
+	}
+	m.mu.Unlock()
+	if changed {
+		m.notify(uri)
+	}
+}
+
+func (m *subscriptionManager) run() {
+	var events <-chan fsnotify.Event
+	var errs <-chan error
+	if m.watcher != nil {
+		events, errs = m.watcher.Events, m.watcher.Errors
+	}
+
+	poll := time.NewTicker(subscriptionPollInterval)
+	defer poll.Stop()
+	apply := time.NewTimer(subscriptionEventDelay)
+	apply.Stop()
+	pending := make(map[string]bool)
+
+	for {
+		select {
+		case <-m.stop:
+			return
+		case event, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			for _, uri := range m.affected(event.Name) {
+				pending[uri] = true
+			}
+			if len(pending) > 0 {
+				apply.Reset(subscriptionEventDelay)
+			}
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			log.Printf("Subscription watcher error: %v", err)
+		case <-apply.C:
+			for uri := range pending {
+				m.check(uri)
+			}
+			pending = make(map[string]bool)
+		case <-poll.C:
+			for _, uri := range m.polled() {
+				m.check(uri)
+			}
+		}
+	}
+}
+
+// handleSubscribe answers resources/subscribe
+func (s *Server) handleSubscribe(ctx context.Context, id interface{}, params json.RawMessage) mcp.JSONRPCMessage {
+	var p struct {
+		URI string `json:"uri"`
+	}
+	if err := json.Unmarshal(params, &p); err != nil || p.URI == "" {
+		return rpcError(id, mcp.INVALID_PARAMS, "uri parameter is required")
+	}
+	if err := s.subscriptions.subscribe(ctx, p.URI); err != nil {
+		return rpcError(id, mcp.INVALID_PARAMS, err.Error())
+	}
+	return rpcResult(id, struct{}{})
+}
+
+// handleUnsubscribe answers resources/unsubscribe
+func (s *Server) handleUnsubscribe(ctx context.Context, id interface{}, params json.RawMessage) mcp.JSONRPCMessage {
+	var p struct {
+		URI string `json:"uri"`
+	}
+	if err := json.Unmarshal(params, &p); err != nil || p.URI == "" {
+		return rpcError(id, mcp.INVALID_PARAMS, "uri parameter is required")
+	}
+	s.subscriptions.unsubscribe(p.URI)
+	return rpcResult(id, struct{}{})
+}
@@ -0,0 +1,325 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+
+	"github.com/vimalk78/fs-mcp/backends"
+	"github.com/vimalk78/fs-mcp/policy"
+)
+
+const (
+	// symbolIndexTTL is how long a symbol index is trusted before changed files are re-scanned
+	symbolIndexTTL = 30 * time.Second
+	// maxSymbolFileSize skips large (typically generated) files when indexing symbols
+	maxSymbolFileSize = 1 << 20
+)
+
+// Symbol is a named definition in a source file
+type Symbol struct {
+	Name      string `json:"name"`
+	Kind      string `json:"kind"` // e.g. "func", "method", "type", "class", "const", "var"
+	Path      string `json:"path,omitempty"`
+	Line      int    `json:"line"`
+	EndLine   int    `json:"end_line,omitempty"`
+	Parent    string `json:"parent,omitempty"` // receiver, class or enclosing type
+	Signature string `json:"signature,omitempty"`
+}
+
+// SymbolExtractor finds the symbols defined in a file's content
+type SymbolExtractor interface {
+	Extract(path string, content []byte) []Symbol
+}
+
+// symbolExtractors maps a lower-case file extension (with dot) to its extractor
+var symbolExtractors = make(map[string]SymbolExtractor)
+
+// RegisterSymbolExtractor registers an extractor for the given file extensions
+func RegisterSymbolExtractor(extractor SymbolExtractor, extensions ...string) {
+	for _, ext := range extensions {
+		symbolExtractors[strings.ToLower(ext)] = extractor
+	}
+}
+
+// extractorFor returns the extractor for a path, or nil if the language is not supported
+func extractorFor(path string) SymbolExtractor {
+	return symbolExtractors[strings.ToLower(filepath.Ext(path))]
+}
+
+// fileSymbols is the cached symbol list of one file
+type fileSymbols struct {
+	size    int64
+	modTime time.Time
+	symbols []Symbol
+}
+
+// symbolIndex holds the symbols of every supported file in a repository
+type symbolIndex struct {
+	mu      sync.Mutex
+	files   map[string]*fileSymbols
+	scanned time.Time
+}
+
+// symbolIndexCache holds one lazily built symbol index per repository name
+type symbolIndexCache struct {
+	mu      sync.Mutex
+	indexes map[string]*symbolIndex
+}
+
+// get returns the symbol index for a repository, creating an empty one on first use
+func (c *symbolIndexCache) get(repoName string) *symbolIndex {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	idx, ok := c.indexes[repoName]
+	if !ok {
+		idx = &symbolIndex{files: make(map[string]*fileSymbols)}
+		c.indexes[repoName] = idx
+	}
+	return idx
+}
+
+// clear drops all cached symbol indexes (called when the config is reloaded)
+func (c *symbolIndexCache) clear() {
+	c.mu.Lock()
+	c.indexes = make(map[string]*symbolIndex)
+	c.mu.Unlock()
+}
+
+// update re-scans the repository if the index is stale, re-extracting only files whose
+// size or mtime changed since they were last indexed
+func (idx *symbolIndex) update(ctx context.Context, fs backends.FileSystem) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if time.Since(idx.scanned) < symbolIndexTTL {
+		return nil
+	}
+
+	basePath := fs.BasePath()
+	seen := make(map[string]bool, len(idx.files))
+	err := fs.Walk(ctx, ".", func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == basePath {
+			return nil
+		}
+		if policy.ShouldSkip(path) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() || info.Size() > maxSymbolFileSize {
+			return nil
+		}
+		extractor := extractorFor(path)
+		if extractor == nil {
+			return nil
+		}
+
+		rel, _ := filepath.Rel(basePath, path)
+		rel = filepath.ToSlash(rel)
+		seen[rel] = true
+
+		cached, ok := idx.files[rel]
+		if ok && cached.size == info.Size() && cached.modTime.Equal(info.ModTime()) {
+			return nil
+		}
+		content, err := fs.ReadFile(ctx, rel)
+		if err != nil {
+			return nil
+		}
+		idx.files[rel] = &fileSymbols{
+			size:    info.Size(),
+			modTime: info.ModTime(),
+			symbols: extractor.Extract(rel, content),
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for path := range idx.files {
+		if !seen[path] {
+			delete(idx.files, path)
+		}
+	}
+	idx.scanned = time.Now()
+	return nil
+}
+
+// symbolQuery selects symbols by name and kind
+type symbolQuery struct {
+	name          string
+	match         string // "exact", "prefix" or "contains"
+	kind          string
+	caseSensitive bool
+}
+
+// matches reports whether a symbol satisfies the query
+func (q *symbolQuery) matches(s Symbol) bool {
+	if q.kind != "" && s.Kind != q.kind {
+		return false
+	}
+	name, want := s.Name, q.name
+	if !q.caseSensitive {
+		name, want = strings.ToLower(name), strings.ToLower(want)
+	}
+	switch q.match {
+	case "prefix":
+		return strings.HasPrefix(name, want)
+	case "contains":
+		return strings.Contains(name, want)
+	}
+	return name == want
+}
+
+// find returns the symbols matching q, ordered by path and line
+func (idx *symbolIndex) find(q *symbolQuery) []Symbol {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	var results []Symbol
+	for path, file := range idx.files {
+		for _, s := range file.symbols {
+			if q.matches(s) {
+				s.Path = path
+				results = append(results, s)
+			}
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Path != results[j].Path {
+			return comparePaths(results[i].Path, results[j].Path) < 0
+		}
+		return results[i].Line < results[j].Line
+	})
+	return results
+}
+
+func (s *Server) handleFindSymbol(ctx context.Context, arguments map[string]interface{}) (*mcp.CallToolResult, error) {
+	repo, ok := arguments["repo"].(string)
+	if !ok {
+		return mcp.NewToolResultError("repo parameter is required"), nil
+	}
+
+	name, ok := arguments["name"].(string)
+	if !ok || name == "" {
+		return mcp.NewToolResultError("name parameter is required"), nil
+	}
+
+	q := &symbolQuery{name: name, match: "exact"}
+	if m, ok := arguments["match"].(string); ok && m != "" {
+		switch m {
+		case "exact", "prefix", "contains":
+			q.match = m
+		default:
+			return mcp.NewToolResultError(fmt.Sprintf("Invalid match: %s (expected exact, prefix or contains)", m)), nil
+		}
+	}
+	q.kind, _ = arguments["kind"].(string)
+	q.caseSensitive, _ = arguments["case_sensitive"].(bool)
+	cursor, _ := arguments["cursor"].(string)
+
+	fs, err := s.FileSystem(ctx, repo)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	idx := s.symbolIndexes.get(repo)
+	if err := idx.update(ctx, fs); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to index symbols: %v", err)), nil
+	}
+
+	symbols := idx.find(q)
+	start, end, next, err := offsetPage(len(symbols), s.resultLimit(repo, arguments), cursor)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	result := map[string]interface{}{
+		"repository": repo,
+		"name":       name,
+		"symbols":    symbols[start:end],
+	}
+	if next != "" {
+		result["next_cursor"] = next
+	}
+
+	jsonResult, _ := json.MarshalIndent(result, "", "  ")
+	return mcp.NewToolResultText(string(jsonResult)), nil
+}
+
+func (s *Server) handleListSymbols(ctx context.Context, arguments map[string]interface{}) (*mcp.CallToolResult, error) {
+	repo, ok := arguments["repo"].(string)
+	if !ok {
+		return mcp.NewToolResultError("repo parameter is required"), nil
+	}
+
+	file, ok := arguments["file"].(string)
+	if !ok {
+		return mcp.NewToolResultError("file parameter is required"), nil
+	}
+
+	kind, _ := arguments["kind"].(string)
+
+	fs, err := s.FileSystem(ctx, repo)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	relPath, err := policy.ValidatePath(fs.BasePath(), file)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	info, err := fs.Stat(ctx, relPath)
+	if err != nil {
+		return mcp.NewToolResultError(statError(err, "File does not exist: %s", file).Error()), nil
+	}
+
+	if !info.Mode().IsRegular() {
+		return mcp.NewToolResultError(fmt.Sprintf("Path is not a file: %s", file)), nil
+	}
+
+	if policy.ShouldSkip(relPath) {
+		return mcp.NewToolResultError(fmt.Sprintf("Access denied: %s", file)), nil
+	}
+
+	extractor := extractorFor(relPath)
+	if extractor == nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Unsupported file type for symbols: %s", file)), nil
+	}
+
+	content, err := fs.ReadFile(ctx, relPath)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	symbols := []Symbol{}
+	for _, sym := range extractor.Extract(relPath, content) {
+		if kind == "" || sym.Kind == kind {
+			symbols = append(symbols, sym)
+		}
+	}
+
+	result := map[string]interface{}{
+		"repository": repo,
+		"file":       file,
+		"symbols":    symbols,
+	}
+
+	jsonResult, _ := json.MarshalIndent(result, "", "  ")
+	return mcp.NewToolResultText(string(jsonResult)), nil
+}
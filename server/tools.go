@@ -0,0 +1,1183 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	mcpserver "github.com/mark3labs/mcp-go/server"
+
+	"github.com/vimalk78/fs-mcp/backends"
+	"github.com/vimalk78/fs-mcp/policy"
+)
+
+// statError describes a failed Stat of a path the caller named: a cancelled or timed-out
+// operation is reported as such, anything else as the path not existing
+func statError(err error, format string, path string) error {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	return fmt.Errorf(format, path)
+}
+
+// toolHandler handles a tools/call request. ctx is done when the client cancels the
+// request or the tool's timeout passes.
+type toolHandler func(ctx context.Context, arguments map[string]interface{}) (*mcp.CallToolResult, error)
+
+// addTool adds a tool to m and to the server's own table, which the transport calls with
+// a cancellable context. mcp-go's handlers take no context, so calls through m can only
+// be bounded by the tool's timeout.
+func (s *Server) addTool(m *mcpserver.MCPServer, tool mcp.Tool, handler toolHandler) {
+	s.mu.Lock()
+	s.tools[tool.Name] = handler
+	s.mu.Unlock()
+	m.AddTool(tool, func(arguments map[string]interface{}) (*mcp.CallToolResult, error) {
+		return s.callTool(context.Background(), tool.Name, arguments)
+	})
+}
+
+// toolTimeout returns how long a tool may run: its entry in tool_timeouts, else
+// tool_timeout. Zero means no limit.
+func (s *Server) toolTimeout(name string) time.Duration {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if seconds, ok := s.toolTimeouts[name]; ok {
+		return time.Duration(seconds) * time.Second
+	}
+	return time.Duration(s.defaultToolTimeout) * time.Second
+}
+
+// callTool runs a tool, returning as soon as ctx is done or the tool's timeout passes.
+// A handler still running then sees its context cancelled and its result is dropped.
+func (s *Server) callTool(ctx context.Context, name string, arguments map[string]interface{}) (*mcp.CallToolResult, error) {
+	s.mu.RLock()
+	handler, ok := s.tools[name]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("tool not found: %s", name)
+	}
+
+	timeout := s.toolTimeout(name)
+	toolCtx, cancel := context.WithCancel(ctx)
+	if timeout > 0 {
+		toolCtx, cancel = context.WithTimeout(ctx, timeout)
+	}
+	defer cancel()
+
+	type outcome struct {
+		result *mcp.CallToolResult
+		err    error
+	}
+	toolCtx, stale := withStaleRepos(toolCtx)
+	toolCtx, audit := s.audit.begin(toolCtx, "tool", name)
+	done := make(chan outcome, 1)
+	go func() {
+		result, err := handler(toolCtx, arguments)
+		done <- outcome{result, err}
+	}()
+
+	select {
+	case out := <-done:
+		if out.err == nil && ctx.Err() == nil && errors.Is(toolCtx.Err(), context.DeadlineExceeded) {
+			// Handlers report a cancelled context as an ordinary error; say which limit it was
+			result := mcp.NewToolResultError(fmt.Sprintf("%s timed out after %s", name, timeout))
+			audit.finishTool(result, nil, "timeout")
+			return result, nil
+		}
+		if note := stale.note(); note != "" && out.result != nil {
+			out.result.Content = append(out.result.Content, mcp.NewTextContent(note))
+		}
+		if ctx.Err() != nil {
+			audit.finishTool(out.result, out.err, "cancelled")
+		} else {
+			audit.finishTool(out.result, out.err, "")
+		}
+		return out.result, out.err
+	case <-toolCtx.Done():
+		if err := ctx.Err(); err != nil {
+			audit.finishTool(nil, err, "cancelled")
+			return nil, err
+		}
+		result := mcp.NewToolResultError(fmt.Sprintf("%s timed out after %s", name, timeout))
+		audit.finishTool(result, nil, "timeout")
+		return result, nil
+	}
+}
+
+// handleCallTool answers tools/call for the server's tools with a context that is
+// cancelled by notifications/cancelled and, if the call has a progress token, reports
+// progress of walks. Tools added to the MCPServer by an embedder are
+// passed on to it.
+func (s *Server) handleCallTool(ctx context.Context, id interface{}, params json.RawMessage) mcp.JSONRPCMessage {
+	var p struct {
+		Name      string                 `json:"name"`
+		Arguments map[string]interface{} `json:"arguments"`
+		Meta      struct {
+			ProgressToken interface{} `json:"progressToken"`
+		} `json:"_meta"`
+	}
+	if err := json.Unmarshal(params, &p); err != nil {
+		return rpcError(id, mcp.INVALID_PARAMS, "Invalid tools/call request")
+	}
+
+	s.mu.RLock()
+	_, ok := s.tools[p.Name]
+	s.mu.RUnlock()
+	if !ok {
+		request, _ := json.Marshal(struct {
+			JSONRPC string          `json:"jsonrpc"`
+			ID      interface{}     `json:"id"`
+			Method  string          `json:"method"`
+			Params  json.RawMessage `json:"params"`
+		}{mcp.JSONRPC_VERSION, id, "tools/call", params})
+		return s.mcp.HandleMessage(ctx, request)
+	}
+
+	if p.Meta.ProgressToken != nil {
+		ctx = withProgress(ctx, p.Meta.ProgressToken, s.transport.notify)
+	}
+	result, err := s.callTool(ctx, p.Name, p.Arguments)
+	progressFrom(ctx).close()
+	if err != nil {
+		return rpcError(id, mcp.INTERNAL_ERROR, err.Error())
+	}
+	return rpcResult(id, result)
+}
+
+func (s *Server) registerTools(m *mcpserver.MCPServer) {
+	// Note: We don't lock here because tool schemas don't change
+	// Tool handlers will check repos dynamically with locking
+	s.mu.RLock()
+	repoNames := make([]string, 0, len(s.repos))
+	for name := range s.repos {
+		repoNames = append(repoNames, name)
+	}
+	s.mu.RUnlock()
+
+	// Tool: list_files
+	s.addTool(m, mcp.Tool{
+		Name:        "list_files",
+		Description: "List files in a repository directory",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: withPagination(map[string]interface{}{
+				"repo": map[string]interface{}{
+					"type":        "string",
+					"description": fmt.Sprintf("Repository name. Available: %s", strings.Join(repoNames, ", ")),
+					"enum":        repoNames,
+				},
+				"path": map[string]interface{}{
+					"type":        "string",
+					"description": "Path within the repository (default: '.')",
+					"default":     ".",
+				},
+				"recursive": map[string]interface{}{
+					"type":        "boolean",
+					"description": "List files recursively (default: false)",
+					"default":     false,
+				},
+			}),
+			Required: []string{"repo"},
+		},
+	}, s.handleListFiles)
+
+	// Tool: read_file
+	s.addTool(m, mcp.Tool{
+		Name:        "read_file",
+		Description: "Read a file from a repository",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]interface{}{
+				"repo": map[string]interface{}{
+					"type":        "string",
+					"description": fmt.Sprintf("Repository name. Available: %s", strings.Join(repoNames, ", ")),
+					"enum":        repoNames,
+				},
+				"file": map[string]interface{}{
+					"type":        "string",
+					"description": "Path to the file within the repository",
+				},
+				"mode": map[string]interface{}{
+					"type":        "string",
+					"description": "'content' returns the file text; 'outline' returns package, imports and signatures with line ranges, bodies elided (default: 'content')",
+					"enum":        []string{"content", "outline"},
+					"default":     "content",
+				},
+				"start_line": map[string]interface{}{
+					"type":        "integer",
+					"description": "First line to return (1-based, inclusive)",
+				},
+				"end_line": map[string]interface{}{
+					"type":        "integer",
+					"description": "Last line to return (1-based, inclusive)",
+				},
+			},
+			Required: []string{"repo", "file"},
+		},
+	}, s.handleReadFile)
+
+	// Tool: read_files
+	s.addTool(m, mcp.Tool{
+		Name:        "read_files",
+		Description: "Read several files, or line ranges of them, in one call. Files are read concurrently and a total size budget is shared fairly between them.",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]interface{}{
+				"files": map[string]interface{}{
+					"type":        "array",
+					"description": fmt.Sprintf("Files to read (at most %d)", maxBatchFiles),
+					"items": map[string]interface{}{
+						"type": "object",
+						"properties": map[string]interface{}{
+							"repo": map[string]interface{}{
+								"type":        "string",
+								"description": "Repository name (defaults to the top-level repo)",
+								"enum":        repoNames,
+							},
+							"file": map[string]interface{}{
+								"type":        "string",
+								"description": "Path to the file within the repository",
+							},
+							"start_line": map[string]interface{}{
+								"type":        "integer",
+								"description": "First line to return (1-based, inclusive)",
+							},
+							"end_line": map[string]interface{}{
+								"type":        "integer",
+								"description": "Last line to return (1-based, inclusive)",
+							},
+						},
+						"required": []string{"file"},
+					},
+				},
+				"repo": map[string]interface{}{
+					"type":        "string",
+					"description": fmt.Sprintf("Default repository for entries without one. Available: %s", strings.Join(repoNames, ", ")),
+					"enum":        repoNames,
+				},
+				"max_bytes": map[string]interface{}{
+					"type":        "integer",
+					"description": fmt.Sprintf("Total content size budget in bytes (default: %d)", defaultReadBudget),
+				},
+			},
+			Required: []string{"files"},
+		},
+	}, s.handleReadFiles)
+
+	// Tool: search_files
+	s.addTool(m, mcp.Tool{
+		Name:        "search_files",
+		Description: "Search for files by glob (with ** support) or regular expression, filtered by type, size and modification time",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: withPagination(map[string]interface{}{
+				"repo": repoSchema(repoNames, fmt.Sprintf("Repository name, list of names, or '*' for all repositories. Available: %s", strings.Join(repoNames, ", "))),
+				"timeout": map[string]interface{}{
+					"type":        "integer",
+					"description": fmt.Sprintf("Per-repository timeout in seconds when searching several repositories (default: %d)", int(defaultRepoTimeout.Seconds())),
+				},
+				"pattern": map[string]interface{}{
+					"type":        "string",
+					"description": "Pattern to match. Globs without '/' match the file name (e.g. '*.ts'); globs with '/' match the relative path and support ** (e.g. 'src/**/*_test.go')",
+				},
+				"include": map[string]interface{}{
+					"type":        "array",
+					"items":       map[string]interface{}{"type": "string"},
+					"description": "Additional patterns; an entry matching any pattern or include is returned",
+				},
+				"exclude": map[string]interface{}{
+					"type":        "array",
+					"items":       map[string]interface{}{"type": "string"},
+					"description": "Patterns to exclude; excluded directories are not descended into",
+				},
+				"regex": map[string]interface{}{
+					"type":        "boolean",
+					"description": "Treat pattern, include and exclude as regular expressions matched against the relative path (default: false)",
+					"default":     false,
+				},
+				"path": map[string]interface{}{
+					"type":        "string",
+					"description": "Directory within the repository to search (default: '.')",
+					"default":     ".",
+				},
+				"type": map[string]interface{}{
+					"type":        "string",
+					"description": "Entry type to return (default: 'file')",
+					"enum":        []string{"file", "dir", "symlink", "any"},
+					"default":     "file",
+				},
+				"min_size": map[string]interface{}{
+					"type":        "integer",
+					"description": "Minimum file size in bytes",
+				},
+				"max_size": map[string]interface{}{
+					"type":        "integer",
+					"description": "Maximum file size in bytes",
+				},
+				"modified_since": map[string]interface{}{
+					"type":        "string",
+					"description": "Only entries modified after this RFC 3339 timestamp or duration ago (e.g. '24h')",
+				},
+				"sort": map[string]interface{}{
+					"type":        "string",
+					"description": "Sort results by name, size or mtime (default: 'name')",
+					"enum":        []string{"name", "size", "mtime"},
+					"default":     "name",
+				},
+				"order": map[string]interface{}{
+					"type":        "string",
+					"description": "Sort order (default: 'asc' for name, 'desc' for size and mtime)",
+					"enum":        []string{"asc", "desc"},
+				},
+			}),
+			Required: []string{"repo"},
+		},
+	}, s.handleSearchFiles)
+
+	// Tool: search_content
+	s.addTool(m, mcp.Tool{
+		Name:        "search_content",
+		Description: "Search file contents with a regular expression, in one repository, several, or all ('*')",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: withPagination(map[string]interface{}{
+				"repo": repoSchema(repoNames, fmt.Sprintf("Repository name, list of names, or '*' for all repositories. Available: %s", strings.Join(repoNames, ", "))),
+				"pattern": map[string]interface{}{
+					"type":        "string",
+					"description": "Regular expression (RE2 syntax) to search for",
+				},
+				"literal": map[string]interface{}{
+					"type":        "boolean",
+					"description": "Treat pattern as a literal string (default: false)",
+					"default":     false,
+				},
+				"case_insensitive": map[string]interface{}{
+					"type":        "boolean",
+					"description": "Match case-insensitively (default: false)",
+					"default":     false,
+				},
+				"include": map[string]interface{}{
+					"type":        "array",
+					"items":       map[string]interface{}{"type": "string"},
+					"description": "Only search files matching these globs (e.g. '*.go', 'src/**/*.ts')",
+				},
+				"exclude": map[string]interface{}{
+					"type":        "array",
+					"items":       map[string]interface{}{"type": "string"},
+					"description": "Skip files and directories matching these globs",
+				},
+				"path": map[string]interface{}{
+					"type":        "string",
+					"description": "Directory within the repository to search (default: '.')",
+					"default":     ".",
+				},
+				"context": map[string]interface{}{
+					"type":        "integer",
+					"description": fmt.Sprintf("Lines of context before and after each match (default: 0, max: %d)", maxContextLines),
+					"default":     0,
+				},
+				"max_file_size": map[string]interface{}{
+					"type":        "integer",
+					"description": fmt.Sprintf("Skip files larger than this many bytes (default: %d)", defaultMaxContentFileSize),
+				},
+				"timeout": map[string]interface{}{
+					"type":        "integer",
+					"description": fmt.Sprintf("Per-repository timeout in seconds when searching several repositories (default: %d)", int(defaultRepoTimeout.Seconds())),
+				},
+			}),
+			Required: []string{"repo", "pattern"},
+		},
+	}, s.handleSearchContent)
+
+	// Tool: tree
+	s.addTool(m, mcp.Tool{
+		Name:        "tree",
+		Description: "Show a directory tree with optional sizes, modification times, permissions and symlink targets",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]interface{}{
+				"repo": map[string]interface{}{
+					"type":        "string",
+					"description": fmt.Sprintf("Repository name. Available: %s", strings.Join(repoNames, ", ")),
+					"enum":        repoNames,
+				},
+				"path": map[string]interface{}{
+					"type":        "string",
+					"description": "Directory within the repository (default: '.')",
+					"default":     ".",
+				},
+				"max_depth": map[string]interface{}{
+					"type":        "integer",
+					"description": fmt.Sprintf("Maximum directory depth to descend (default: %d)", defaultTreeDepth),
+					"default":     defaultTreeDepth,
+				},
+				"max_entries": map[string]interface{}{
+					"type":        "integer",
+					"description": fmt.Sprintf("Maximum number of entries to return (default: %d)", defaultTreeEntries),
+					"default":     defaultTreeEntries,
+				},
+				"sizes": map[string]interface{}{
+					"type":        "boolean",
+					"description": "Include file sizes (default: false)",
+					"default":     false,
+				},
+				"mtimes": map[string]interface{}{
+					"type":        "boolean",
+					"description": "Include modification times (default: false)",
+					"default":     false,
+				},
+				"permissions": map[string]interface{}{
+					"type":        "boolean",
+					"description": "Include permission bits (default: false)",
+					"default":     false,
+				},
+				"format": map[string]interface{}{
+					"type":        "string",
+					"description": "Output format: 'text' for an indented tree, 'json' for structured output (default: 'text')",
+					"enum":        []string{"text", "json"},
+					"default":     "text",
+				},
+			},
+			Required: []string{"repo"},
+		},
+	}, s.handleTree)
+
+	// Tool: find_file
+	s.addTool(m, mcp.Tool{
+		Name:        "find_file",
+		Description: "Fuzzy-find files by path (fzf-style), in one repository or across all repositories, ranked by score",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: withPagination(map[string]interface{}{
+				"query": map[string]interface{}{
+					"type":        "string",
+					"description": "Fuzzy query; whitespace-separated terms must all match the path (e.g. 'user service handler')",
+				},
+				"repo": repoSchema(repoNames, fmt.Sprintf("Repository name, list of names, or '*' for all repositories (default: all). Available: %s", strings.Join(repoNames, ", "))),
+				"timeout": map[string]interface{}{
+					"type":        "integer",
+					"description": fmt.Sprintf("Per-repository timeout in seconds for building path indexes (default: %d)", int(defaultRepoTimeout.Seconds())),
+				},
+				"refresh": map[string]interface{}{
+					"type":        "boolean",
+					"description": "Rebuild the cached path index before searching (default: false)",
+					"default":     false,
+				},
+			}),
+			Required: []string{"query"},
+		},
+	}, s.handleFindFile)
+
+	// Tool: find_symbol
+	s.addTool(m, mcp.Tool{
+		Name:        "find_symbol",
+		Description: "Find where functions, types, classes and other symbols are defined in a repository",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: withPagination(map[string]interface{}{
+				"repo": map[string]interface{}{
+					"type":        "string",
+					"description": fmt.Sprintf("Repository name. Available: %s", strings.Join(repoNames, ", ")),
+					"enum":        repoNames,
+				},
+				"name": map[string]interface{}{
+					"type":        "string",
+					"description": "Symbol name to look for",
+				},
+				"match": map[string]interface{}{
+					"type":        "string",
+					"description": "How to match the name (default: 'exact')",
+					"enum":        []string{"exact", "prefix", "contains"},
+					"default":     "exact",
+				},
+				"kind": map[string]interface{}{
+					"type":        "string",
+					"description": "Only return symbols of this kind (e.g. func, method, struct, interface, type, class, const, var)",
+				},
+				"case_sensitive": map[string]interface{}{
+					"type":        "boolean",
+					"description": "Match the name case-sensitively (default: false)",
+					"default":     false,
+				},
+			}),
+			Required: []string{"repo", "name"},
+		},
+	}, s.handleFindSymbol)
+
+	// Tool: list_symbols
+	s.addTool(m, mcp.Tool{
+		Name:        "list_symbols",
+		Description: "List the symbols defined in a file with their line numbers",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]interface{}{
+				"repo": map[string]interface{}{
+					"type":        "string",
+					"description": fmt.Sprintf("Repository name. Available: %s", strings.Join(repoNames, ", ")),
+					"enum":        repoNames,
+				},
+				"file": map[string]interface{}{
+					"type":        "string",
+					"description": "Path to the file within the repository",
+				},
+				"kind": map[string]interface{}{
+					"type":        "string",
+					"description": "Only return symbols of this kind",
+				},
+			},
+			Required: []string{"repo", "file"},
+		},
+	}, s.handleListSymbols)
+
+	// Tool: watch_changes
+	s.addTool(m, mcp.Tool{
+		Name:        "watch_changes",
+		Description: "Report files created, modified and deleted in a repository since a point in time or since a previous call's token",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]interface{}{
+				"repo": map[string]interface{}{
+					"type":        "string",
+					"description": fmt.Sprintf("Repository name. Available: %s", strings.Join(repoNames, ", ")),
+					"enum":        repoNames,
+				},
+				"token": map[string]interface{}{
+					"type":        "string",
+					"description": "Token returned by a previous call; reports changes since that call, or the rest of them if that result was truncated",
+				},
+				"since": map[string]interface{}{
+					"type":        "string",
+					"description": "Report changes after this RFC 3339 timestamp or duration ago (e.g. '2024-01-15T10:00:00Z', '30m'). Ignored when token is given.",
+				},
+				"limit": map[string]interface{}{
+					"type":        "integer",
+					"description": "Maximum number of changed paths to return",
+				},
+			},
+			Required: []string{"repo"},
+		},
+	}, s.handleWatchChanges)
+
+	// Tool: hash_file
+	s.addTool(m, mcp.Tool{
+		Name:        "hash_file",
+		Description: "Compute the hash of a file, or of a range of its lines",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]interface{}{
+				"repo": map[string]interface{}{
+					"type":        "string",
+					"description": fmt.Sprintf("Repository name. Available: %s", strings.Join(repoNames, ", ")),
+					"enum":        repoNames,
+				},
+				"file": map[string]interface{}{
+					"type":        "string",
+					"description": "File path relative to repository root",
+				},
+				"algorithm": map[string]interface{}{
+					"type":        "string",
+					"description": "Hash algorithm (default: sha256)",
+					"enum":        []string{"sha256", "sha1", "md5"},
+				},
+				"start_line": map[string]interface{}{
+					"type":        "integer",
+					"description": "First line to hash (1-based). Hashes the whole file when neither start_line nor end_line is given.",
+				},
+				"end_line": map[string]interface{}{
+					"type":        "integer",
+					"description": "Last line to hash (inclusive)",
+				},
+			},
+			Required: []string{"repo", "file"},
+		},
+	}, s.handleHashFile)
+
+	// Tool: diff_files
+	s.addTool(m, mcp.Tool{
+		Name:        "diff_files",
+		Description: "Show a unified diff between two files, which may be in different repositories",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]interface{}{
+				"repo_a": map[string]interface{}{
+					"type":        "string",
+					"description": fmt.Sprintf("Repository of the original file. Available: %s", strings.Join(repoNames, ", ")),
+					"enum":        repoNames,
+				},
+				"file_a": map[string]interface{}{
+					"type":        "string",
+					"description": "Original file path relative to repo_a's root",
+				},
+				"repo_b": map[string]interface{}{
+					"type":        "string",
+					"description": fmt.Sprintf("Repository of the new file (default: repo_a). Available: %s", strings.Join(repoNames, ", ")),
+					"enum":        repoNames,
+				},
+				"file_b": map[string]interface{}{
+					"type":        "string",
+					"description": "New file path relative to repo_b's root",
+				},
+				"context": map[string]interface{}{
+					"type":        "integer",
+					"description": "Unchanged lines shown around each change (default: 3)",
+				},
+			},
+			Required: []string{"repo_a", "file_a", "file_b"},
+		},
+	}, s.handleDiffFiles)
+
+	// Tool: compare_dirs
+	s.addTool(m, mcp.Tool{
+		Name:        "compare_dirs",
+		Description: "Summarize files added, removed and changed between two directory trees, which may be in different repositories",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]interface{}{
+				"repo_a": map[string]interface{}{
+					"type":        "string",
+					"description": fmt.Sprintf("Repository of the original tree. Available: %s", strings.Join(repoNames, ", ")),
+					"enum":        repoNames,
+				},
+				"path_a": map[string]interface{}{
+					"type":        "string",
+					"description": "Original directory relative to repo_a's root (default: root)",
+				},
+				"repo_b": map[string]interface{}{
+					"type":        "string",
+					"description": fmt.Sprintf("Repository of the new tree (default: repo_a). Available: %s", strings.Join(repoNames, ", ")),
+					"enum":        repoNames,
+				},
+				"path_b": map[string]interface{}{
+					"type":        "string",
+					"description": "New directory relative to repo_b's root (default: root)",
+				},
+				"compare": map[string]interface{}{
+					"type":        "string",
+					"description": "How files present in both trees are compared: 'content' hashes files of equal size, 'size' compares sizes only (default: content)",
+					"enum":        []string{"content", "size"},
+				},
+				"limit": map[string]interface{}{
+					"type":        "integer",
+					"description": "Maximum number of differing paths to return",
+				},
+			},
+			Required: []string{"repo_a"},
+		},
+	}, s.handleCompareDirs)
+
+	// Tool: list_repos
+	s.addTool(m, mcp.Tool{
+		Name:        "list_repos",
+		Description: "List all configured repositories and their paths",
+		InputSchema: mcp.ToolInputSchema{
+			Type:       "object",
+			Properties: map[string]interface{}{},
+			Required:   []string{},
+		},
+	}, s.handleListRepos)
+}
+
+func (s *Server) handleListFiles(ctx context.Context, arguments map[string]interface{}) (*mcp.CallToolResult, error) {
+	repo, ok := arguments["repo"].(string)
+	if !ok {
+		return mcp.NewToolResultError("repo parameter is required"), nil
+	}
+
+	path := "."
+	if p, ok := arguments["path"].(string); ok {
+		path = p
+	}
+
+	recursive := false
+	if r, ok := arguments["recursive"].(bool); ok {
+		recursive = r
+	}
+
+	cursor, _ := arguments["cursor"].(string)
+
+	fs, err := s.FileSystem(ctx, repo)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	// Validate path
+	relPath, err := policy.ValidatePath(fs.BasePath(), path)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	info, err := fs.Stat(ctx, relPath)
+	if err != nil {
+		return mcp.NewToolResultError(statError(err, "Path does not exist: %s", path).Error()), nil
+	}
+
+	if !info.IsDir() {
+		return mcp.NewToolResultError(fmt.Sprintf("Path is not a directory: %s", path)), nil
+	}
+
+	page, err := newPager(s.resultLimit(repo, arguments), cursor)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	if recursive {
+		basePath := fs.BasePath()
+		targetPath := filepath.Join(basePath, relPath)
+		prog := progressFrom(ctx)
+		err = fs.Walk(ctx, relPath, func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if p == targetPath || p == basePath {
+				return nil
+			}
+			if policy.ShouldSkip(p) {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			prog.scanned(info.IsDir())
+			// Get path relative to target
+			rel, _ := filepath.Rel(targetPath, p)
+			if rel == "" {
+				return nil
+			}
+			if seen, err := page.seek(rel, info.IsDir()); seen {
+				return err
+			}
+			prog.matched(1)
+			if info.IsDir() {
+				return page.add(rel + "/")
+			}
+			return page.add(rel)
+		})
+		err = page.finish(err)
+	} else {
+		entries, err := fs.ReadDir(ctx, relPath)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		sort.Slice(entries, func(i, j int) bool {
+			return entries[i].Name() < entries[j].Name()
+		})
+		for _, entry := range entries {
+			if policy.ShouldSkip(entry.Name()) {
+				continue
+			}
+			if seen, _ := page.seek(entry.Name(), false); seen {
+				continue
+			}
+			name := entry.Name()
+			if entry.IsDir() {
+				name += "/"
+			}
+			if page.add(name) != nil {
+				break
+			}
+		}
+	}
+
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	result := map[string]interface{}{
+		"repository": repo,
+		"path":       path,
+		"files":      page.results,
+	}
+	if page.next != "" {
+		result["next_cursor"] = page.next
+	}
+
+	jsonResult, _ := json.MarshalIndent(result, "", "  ")
+	return mcp.NewToolResultText(string(jsonResult)), nil
+}
+
+func (s *Server) handleReadFile(ctx context.Context, arguments map[string]interface{}) (*mcp.CallToolResult, error) {
+	repo, ok := arguments["repo"].(string)
+	if !ok {
+		return mcp.NewToolResultError("repo parameter is required"), nil
+	}
+
+	file, ok := arguments["file"].(string)
+	if !ok {
+		return mcp.NewToolResultError("file parameter is required"), nil
+	}
+
+	mode := "content"
+	if m, ok := arguments["mode"].(string); ok && m != "" {
+		if m != "content" && m != "outline" {
+			return mcp.NewToolResultError(fmt.Sprintf("Invalid mode: %s (expected content or outline)", m)), nil
+		}
+		mode = m
+	}
+
+	startLine := intArgument(arguments, "start_line", 0)
+	endLine := intArgument(arguments, "end_line", 0)
+	if startLine < 0 || endLine < 0 {
+		return mcp.NewToolResultError("start_line and end_line must be positive"), nil
+	}
+
+	fs, err := s.FileSystem(ctx, repo)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	relPath, content, err := readRepoFile(ctx, fs, file)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	decoded := decodeContent(relPath, content)
+	if decoded.Binary {
+		uri := fmt.Sprintf("repo://%s/%s", repo, filepath.ToSlash(relPath))
+		return binaryToolResult(fmt.Sprintf("File: %s/%s", repo, file), uri, content, decoded), nil
+	}
+	text := decoded.Text
+
+	if mode == "outline" {
+		extractor := extractorFor(relPath)
+		if extractor == nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Outline not supported for this file type: %s", file)), nil
+		}
+		outline := renderOutline(outlineFor(extractor, relPath, []byte(text)))
+		result := fmt.Sprintf("File: %s/%s (outline, %d lines)\n\n%s", repo, file, countLines([]byte(text)), outline)
+		return mcp.NewToolResultText(result), nil
+	}
+
+	if startLine > 0 || endLine > 0 {
+		slice, first, last, total := sliceLines([]byte(text), startLine, endLine)
+		if first > last {
+			return mcp.NewToolResultError(fmt.Sprintf("start_line %d is past the end of the file (%d lines)", first, total)), nil
+		}
+		result := fmt.Sprintf("File: %s/%s (lines %d-%d of %d)\n%s\n\n%s", repo, file, first, last, total, decoded.describe(), slice)
+		return mcp.NewToolResultText(result), nil
+	}
+
+	result := fmt.Sprintf("File: %s/%s\n%s\n\n%s", repo, file, decoded.describe(), text)
+	return mcp.NewToolResultText(result), nil
+}
+
+// readRepoFile validates a path within a repository and reads the regular file it names
+func readRepoFile(ctx context.Context, fs backends.FileSystem, file string) (string, []byte, error) {
+	relPath, err := policy.ValidatePath(fs.BasePath(), file)
+	if err != nil {
+		return "", nil, err
+	}
+
+	info, err := fs.Stat(ctx, relPath)
+	if err != nil {
+		return "", nil, statError(err, "File does not exist: %s", file)
+	}
+
+	if !info.Mode().IsRegular() {
+		return "", nil, fmt.Errorf("Path is not a file: %s", file)
+	}
+
+	if policy.ShouldSkip(relPath) {
+		return "", nil, fmt.Errorf("Access denied: %s", file)
+	}
+
+	content, err := fs.ReadFile(ctx, relPath)
+	if err != nil {
+		return "", nil, err
+	}
+	return relPath, content, nil
+}
+
+// countLines returns the number of lines in content, counting a final unterminated line
+func countLines(content []byte) int {
+	n := bytes.Count(content, []byte("\n"))
+	if len(content) > 0 && content[len(content)-1] != '\n' {
+		n++
+	}
+	return n
+}
+
+// sliceLines returns lines start..end (1-based, inclusive) of content, clamped to the file.
+// A start of 0 means the first line and an end of 0 the last. It also returns the clamped
+// range and the file's total line count.
+func sliceLines(content []byte, start, end int) (string, int, int, int) {
+	total := countLines(content)
+	if start < 1 {
+		start = 1
+	}
+	if end < 1 || end > total {
+		end = total
+	}
+	if start > end {
+		return "", start, end, total
+	}
+
+	lines := strings.SplitAfter(string(content), "\n")
+	return strings.Join(lines[start-1:end], ""), start, end, total
+}
+
+func (s *Server) handleSearchFiles(ctx context.Context, arguments map[string]interface{}) (*mcp.CallToolResult, error) {
+	names, multi, err := s.repoArgument(arguments)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	filter, err := parseSearchFilter(arguments)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	path := "."
+	if p, ok := arguments["path"].(string); ok && p != "" {
+		path = p
+	}
+
+	cursor, _ := arguments["cursor"].(string)
+
+	if !multi {
+		repo := names[0]
+		matches, next, err := s.searchFiles(ctx, repo, path, filter, s.resultLimit(repo, arguments), cursor)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		result := map[string]interface{}{
+			"repository": repo,
+			"matches":    matches,
+		}
+		if pattern, ok := arguments["pattern"]; ok {
+			result["pattern"] = pattern
+		}
+		if next != "" {
+			result["next_cursor"] = next
+		}
+
+		jsonResult, _ := json.MarshalIndent(result, "", "  ")
+		return mcp.NewToolResultText(string(jsonResult)), nil
+	}
+
+	names, cursors, err := multiRepoPlan(names, cursor)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	type searchPage struct {
+		matches []string
+		next    string
+	}
+	results := runAcrossRepos(ctx, names, repoTimeout(arguments), func(ctx context.Context, repo string) (interface{}, error) {
+		matches, next, err := s.searchFiles(ctx, repo, path, filter, s.resultLimit(repo, arguments), cursors[repo])
+		return searchPage{matches: matches, next: next}, err
+	})
+
+	matches := make([]map[string]string, 0)
+	repoErrors := make(map[string]string)
+	nextCursors := make(map[string]string)
+	for _, r := range results {
+		if r.err != nil {
+			repoErrors[r.repo] = r.err.Error()
+			continue
+		}
+		page := r.value.(searchPage)
+		for _, m := range page.matches {
+			matches = append(matches, map[string]string{"repository": r.repo, "path": m})
+		}
+		if page.next != "" {
+			nextCursors[r.repo] = page.next
+		}
+	}
+
+	result := map[string]interface{}{
+		"repositories": names,
+		"matches":      matches,
+	}
+	if pattern, ok := arguments["pattern"]; ok {
+		result["pattern"] = pattern
+	}
+	if len(repoErrors) > 0 {
+		result["errors"] = repoErrors
+	}
+	if next := encodeMultiCursor(nextCursors); next != "" {
+		result["next_cursor"] = next
+	}
+
+	jsonResult, _ := json.MarshalIndent(result, "", "  ")
+	return mcp.NewToolResultText(string(jsonResult)), nil
+}
+
+// listReposOpenTimeout bounds how long list_repos waits for a repository it expects to
+// open without a round trip
+const listReposOpenTimeout = 5 * time.Second
+
+func (s *Server) handleListRepos(ctx context.Context, arguments map[string]interface{}) (*mcp.CallToolResult, error) {
+	s.mu.RLock()
+	configured := make([]*backends.Repository, 0, len(s.repos))
+	for _, repo := range s.repos {
+		configured = append(configured, repo)
+	}
+	s.mu.RUnlock()
+	sort.Slice(configured, func(i, j int) bool { return configured[i].Name < configured[j].Name })
+
+	// Type-specific details come from each repository's FileSystem. Listing shouldn't
+	// connect to hosts, start backends or download archives, so only repositories that
+	// are cheap to open are opened, concurrently, without the lock and each under a
+	// short timeout.
+	repoList := make([]map[string]interface{}, len(configured))
+	var wg sync.WaitGroup
+	for i, repo := range configured {
+		wg.Add(1)
+		go func(i int, repo *backends.Repository) {
+			defer wg.Done()
+			info := map[string]interface{}{
+				"name":     repo.Name,
+				"type":     repo.Type,
+				"path":     repo.Path,
+				"location": repo.Location(),
+			}
+			if !s.pool.Ready(repo) {
+				info["opened"] = false
+			} else {
+				openCtx, cancel := context.WithTimeout(ctx, listReposOpenTimeout)
+				fs, err := s.pool.Open(openCtx, repo)
+				cancel()
+				if err != nil {
+					info["error"] = err.Error()
+				} else {
+					for key, value := range fs.Info() {
+						info[key] = value
+					}
+				}
+			}
+			if idx := s.contentIndexes.get(repo.Name); idx != nil {
+				info["index"] = idx.status()
+			}
+			if stats, ok := s.pool.CacheStats(repo.Name); ok {
+				info["cache"] = stats
+			}
+			repoList[i] = info
+		}(i, repo)
+	}
+	wg.Wait()
+
+	result := map[string]interface{}{
+		"repositories": repoList,
+		"count":        len(repoList),
+	}
+
+	jsonResult, _ := json.MarshalIndent(result, "", "  ")
+	return mcp.NewToolResultText(string(jsonResult)), nil
+}
+
+// handleReadResourceTemplate reads a repo:// resource for mcp-go, which doesn't pass a
+// context to resource handlers
+func (s *Server) handleReadResourceTemplate(request mcp.ReadResourceRequest) ([]interface{}, error) {
+	ctx, audit := s.audit.begin(context.Background(), "resource", "")
+	contents, err := s.readResource(ctx, request.Params.URI)
+	audit.finishResource(contents, err)
+	return contents, err
+}
+
+// readResource returns the contents of a repo:// URI: a file, a directory listing or metadata.
+// A resource read from a mirror is followed by a plain text note saying it may be stale.
+func (s *Server) readResource(ctx context.Context, uri string) ([]interface{}, error) {
+	ctx, stale := withStaleRepos(ctx)
+	contents, err := s.resourceContents(ctx, uri)
+	if note := stale.note(); note != "" && err == nil {
+		contents = append(contents, mcp.TextResourceContents{
+			ResourceContents: mcp.ResourceContents{URI: uri, MIMEType: "text/plain"},
+			Text:             note,
+		})
+	}
+	return contents, err
+}
+
+// resourceContents reads the resource a repo:// URI names
+func (s *Server) resourceContents(ctx context.Context, uri string) ([]interface{}, error) {
+	// Parse URI: repo://repo-name/path/to/file[?metadata]
+	res, err := parseRepoURI(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	fs, err := s.FileSystem(ctx, res.repo)
+	if err != nil {
+		return nil, err
+	}
+
+	relPath := "."
+	if res.path != "" {
+		relPath, err = policy.ValidatePath(fs.BasePath(), res.path)
+		if err != nil {
+			return nil, err
+		}
+		if policy.ShouldSkip(relPath) {
+			return nil, fmt.Errorf("access denied: %s", res.path)
+		}
+	}
+
+	info, err := fs.Stat(ctx, relPath)
+	if err != nil {
+		return nil, statError(err, "file does not exist: %s", res.path)
+	}
+
+	if res.metadata {
+		meta, err := resourceMetadata(ctx, res.repo, fs, relPath)
+		if err != nil {
+			return nil, err
+		}
+		return []interface{}{
+			mcp.TextResourceContents{
+				ResourceContents: mcp.ResourceContents{URI: uri, MIMEType: "application/json"},
+				Text:             meta,
+			},
+		}, nil
+	}
+
+	if info.IsDir() {
+		listing, err := s.directoryListing(ctx, res.repo, fs, relPath)
+		if err != nil {
+			return nil, err
+		}
+		return []interface{}{
+			mcp.TextResourceContents{
+				ResourceContents: mcp.ResourceContents{URI: uri, MIMEType: "application/json"},
+				Text:             listing,
+			},
+		}, nil
+	}
+
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("path is not a file: %s", res.path)
+	}
+
+	content, err := fs.ReadFile(ctx, relPath)
+	if err != nil {
+		return nil, err
+	}
+
+	decoded := decodeContent(relPath, content)
+	if decoded.Binary {
+		return []interface{}{
+			mcp.BlobResourceContents{
+				ResourceContents: mcp.ResourceContents{URI: uri, MIMEType: decoded.MIMEType},
+				Blob:             base64.StdEncoding.EncodeToString(content),
+			},
+		}, nil
+	}
+
+	return []interface{}{
+		mcp.TextResourceContents{
+			ResourceContents: mcp.ResourceContents{URI: uri, MIMEType: decoded.MIMEType},
+			Text:             decoded.Text,
+		},
+	}, nil
+}
@@ -0,0 +1,284 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	mcpserver "github.com/mark3labs/mcp-go/server"
+)
+
+// maxMessageSize bounds a single JSON-RPC message read from stdin
+const maxMessageSize = 64 << 20
+
+// methodHandler handles a JSON-RPC request the wrapped MCPServer doesn't support itself.
+// It returns the response to send. ctx is cancelled if the client cancels the request or
+// disconnects.
+type methodHandler func(ctx context.Context, id interface{}, params json.RawMessage) mcp.JSONRPCMessage
+
+// stdioServer serves an MCPServer over stdin/stdout. Methods with a registered handler
+// are answered here, concurrently and cancellable with notifications/cancelled; everything
+// else is passed to the MCPServer in order.
+type stdioServer struct {
+	mcp          *mcpserver.MCPServer
+	methods      map[string]methodHandler
+	disconnected []func()
+
+	writeMu sync.Mutex
+	out     io.Writer // nil while no client is connected
+
+	inflightMu sync.Mutex
+	inflight   map[string]context.CancelFunc // by JSON-encoded request ID
+	running    sync.WaitGroup
+
+	peerMu  sync.Mutex
+	session string // random ID of the current connection
+	client  string // name/version the client gave in initialize
+}
+
+// newStdioServer wraps an MCPServer
+func newStdioServer(s *mcpserver.MCPServer) *stdioServer {
+	return &stdioServer{
+		mcp:      s,
+		methods:  make(map[string]methodHandler),
+		inflight: make(map[string]context.CancelFunc),
+	}
+}
+
+// handle registers a handler for a JSON-RPC method, taking precedence over the MCPServer
+func (s *stdioServer) handle(method string, handler methodHandler) {
+	s.methods[method] = handler
+}
+
+// onDisconnect registers a function to run when the client disconnects
+func (s *stdioServer) onDisconnect(fn func()) {
+	s.disconnected = append(s.disconnected, fn)
+}
+
+// rpcNotification is a JSON-RPC notification sent to the client
+type rpcNotification struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params,omitempty"`
+}
+
+// notify sends a notification to the client
+func (s *stdioServer) notify(method string, params interface{}) error {
+	return s.write(rpcNotification{JSONRPC: mcp.JSONRPC_VERSION, Method: method, Params: params})
+}
+
+// rpcResult builds a successful JSON-RPC response
+func rpcResult(id interface{}, result interface{}) mcp.JSONRPCMessage {
+	return mcp.JSONRPCResponse{
+		JSONRPC: mcp.JSONRPC_VERSION,
+		ID:      id,
+		Result:  result,
+	}
+}
+
+// rpcError builds a JSON-RPC error response
+func rpcError(id interface{}, code int, message string) mcp.JSONRPCMessage {
+	resp := mcp.JSONRPCError{JSONRPC: mcp.JSONRPC_VERSION, ID: id}
+	resp.Error.Code = code
+	resp.Error.Message = message
+	return resp
+}
+
+// errNotConnected is returned for messages sent while no client is connected, such as
+// notifications from work that outlived its connection
+var errNotConnected = errors.New("no client connected")
+
+// write sends one message as a line of JSON
+func (s *stdioServer) write(message interface{}) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	if s.out == nil {
+		return errNotConnected
+	}
+	_, err = fmt.Fprintf(s.out, "%s\n", data)
+	return err
+}
+
+// requestKey identifies a request ID in the in-flight table. IDs are compared by their
+// JSON encoding, so 1 and "1" stay distinct.
+func requestKey(id interface{}) string {
+	data, _ := json.Marshal(id)
+	return string(data)
+}
+
+// process handles one incoming line and returns the response to send, if any. Requests
+// for registered methods are started in the background and answered when they finish.
+func (s *stdioServer) process(ctx context.Context, line []byte) mcp.JSONRPCMessage {
+	var base struct {
+		Method string          `json:"method"`
+		ID     interface{}     `json:"id,omitempty"`
+		Params json.RawMessage `json:"params,omitempty"`
+	}
+	if err := json.Unmarshal(line, &base); err != nil {
+		return rpcError(nil, mcp.PARSE_ERROR, "Parse error")
+	}
+
+	if base.Method == "notifications/cancelled" {
+		var p struct {
+			RequestID interface{} `json:"requestId"`
+		}
+		if err := json.Unmarshal(base.Params, &p); err == nil && p.RequestID != nil {
+			s.cancel(p.RequestID)
+		}
+		return nil
+	}
+
+	if base.Method == "initialize" {
+		var p struct {
+			ClientInfo mcp.Implementation `json:"clientInfo"`
+		}
+		if err := json.Unmarshal(base.Params, &p); err == nil && p.ClientInfo.Name != "" {
+			s.peerMu.Lock()
+			s.client = p.ClientInfo.Name + "/" + p.ClientInfo.Version
+			s.peerMu.Unlock()
+		}
+	}
+
+	if handler, ok := s.methods[base.Method]; ok && base.ID != nil {
+		s.start(ctx, handler, base.ID, base.Params)
+		return nil
+	}
+	return s.mcp.HandleMessage(ctx, line)
+}
+
+// start runs a handler in the background. A request cancelled before it finishes gets no
+// response, as the client has stopped waiting for it.
+func (s *stdioServer) start(ctx context.Context, handler methodHandler, id interface{}, params json.RawMessage) {
+	key := requestKey(id)
+	reqCtx, cancel := context.WithCancel(ctx)
+	s.inflightMu.Lock()
+	s.inflight[key] = cancel
+	s.inflightMu.Unlock()
+
+	s.running.Add(1)
+	go func() {
+		defer s.running.Done()
+		response := handler(reqCtx, id, params)
+
+		s.inflightMu.Lock()
+		delete(s.inflight, key)
+		s.inflightMu.Unlock()
+		cancelled := reqCtx.Err() != nil
+		cancel()
+		if cancelled || response == nil {
+			return
+		}
+		if err := s.write(response); err != nil {
+			log.Printf("Failed to write response: %v", err)
+		}
+	}()
+}
+
+// cancel cancels an in-flight request; unknown or finished requests are ignored
+func (s *stdioServer) cancel(id interface{}) {
+	s.inflightMu.Lock()
+	cancel, ok := s.inflight[requestKey(id)]
+	s.inflightMu.Unlock()
+	if ok {
+		cancel()
+	}
+}
+
+// peer identifies the connected client, for the audit log
+func (s *stdioServer) peer() (session, client string) {
+	s.peerMu.Lock()
+	defer s.peerMu.Unlock()
+	return s.session, s.client
+}
+
+// listen reads newline-delimited JSON-RPC messages until in is exhausted or ctx is done
+func (s *stdioServer) listen(ctx context.Context, in io.Reader, out io.Writer) error {
+	s.writeMu.Lock()
+	s.out = out
+	s.writeMu.Unlock()
+	id := make([]byte, 8)
+	rand.Read(id)
+	s.peerMu.Lock()
+	s.session = hex.EncodeToString(id)
+	s.client = ""
+	s.peerMu.Unlock()
+	ctx, cancel := context.WithCancel(ctx)
+	defer func() {
+		// Stop whatever is still running once the context is done
+		cancel()
+		s.running.Wait()
+		for _, fn := range s.disconnected {
+			fn()
+		}
+		s.writeMu.Lock()
+		s.out = nil
+		s.writeMu.Unlock()
+	}()
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxMessageSize)
+
+	lines := make(chan []byte)
+	errs := make(chan error, 1)
+	go func() {
+		for scanner.Scan() {
+			line := append([]byte(nil), scanner.Bytes()...)
+			select {
+			case lines <- line:
+			case <-ctx.Done():
+				return
+			}
+		}
+		errs <- scanner.Err()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-errs:
+			// The client closed its end; answer the requests it already sent
+			s.running.Wait()
+			return err
+		case line := <-lines:
+			if len(line) == 0 {
+				continue
+			}
+			if response := s.process(ctx, line); response != nil {
+				if err := s.write(response); err != nil {
+					return fmt.Errorf("failed to write response: %w", err)
+				}
+			}
+		}
+	}
+}
+
+// serveStdio serves s on stdin/stdout until stdin is closed or the process is signalled
+func (s *stdioServer) serveStdio() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		<-sigChan
+		log.Printf("Shutting down")
+		cancel()
+	}()
+
+	return s.listen(ctx, os.Stdin, os.Stdout)
+}
@@ -0,0 +1,46 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	mcpserver "github.com/mark3labs/mcp-go/server"
+)
+
+// TestStdioServerReconnect checks that notifications sent from other goroutines while
+// connections come and go don't race with them, and fail once the client is gone
+func TestStdioServerReconnect(t *testing.T) {
+	s := newStdioServer(mcpserver.NewMCPServer("test", "1.0.0"))
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				s.notify("notifications/message", nil)
+			}
+		}
+	}()
+
+	for i := 0; i < 3; i++ {
+		var out bytes.Buffer
+		in := strings.NewReader(`{"jsonrpc": "2.0", "id": 1, "method": "ping"}` + "\n")
+		if err := s.listen(context.Background(), in, &out); err != nil {
+			t.Fatalf("listen: %v", err)
+		}
+	}
+	close(stop)
+	wg.Wait()
+
+	if err := s.notify("notifications/message", nil); !errors.Is(err, errNotConnected) {
+		t.Errorf("notify after disconnecting = %v, want errNotConnected", err)
+	}
+}
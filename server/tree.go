@@ -0,0 +1,301 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+
+	"github.com/vimalk78/fs-mcp/backends"
+	"github.com/vimalk78/fs-mcp/policy"
+)
+
+const (
+	defaultTreeDepth   = 3
+	defaultTreeEntries = 1000
+)
+
+// treeOptions controls how a directory tree is collected and rendered
+type treeOptions struct {
+	maxDepth    int
+	maxEntries  int
+	sizes       bool
+	mtimes      bool
+	permissions bool
+}
+
+// treeCounts holds the number of direct children of a directory
+type treeCounts struct {
+	Files int `json:"files"`
+	Dirs  int `json:"dirs"`
+}
+
+// treeNode is a single entry in a directory tree
+type treeNode struct {
+	Name      string      `json:"name"`
+	Type      string      `json:"type"` // "file", "dir" or "symlink"
+	Size      *int64      `json:"size,omitempty"`
+	ModTime   string      `json:"mtime,omitempty"`
+	Mode      string      `json:"mode,omitempty"`
+	Target    string      `json:"target,omitempty"`
+	Counts    *treeCounts `json:"counts,omitempty"`
+	Truncated bool        `json:"truncated,omitempty"` // children not listed (depth or entry limit)
+	Children  []*treeNode `json:"children,omitempty"`
+}
+
+// treeBuilder walks a FileSystem with ReadDir, honoring depth and entry limits
+type treeBuilder struct {
+	fs      backends.FileSystem
+	opts    treeOptions
+	entries int
+	limited bool
+}
+
+// entryType classifies a file mode as file, dir or symlink
+func entryType(mode fs.FileMode) string {
+	switch {
+	case mode&fs.ModeSymlink != 0:
+		return "symlink"
+	case mode.IsDir():
+		return "dir"
+	default:
+		return "file"
+	}
+}
+
+// newNode creates a tree node for the given entry, filling in requested metadata
+func (b *treeBuilder) newNode(ctx context.Context, relPath, name string, info fs.FileInfo) *treeNode {
+	node := &treeNode{
+		Name: name,
+		Type: entryType(info.Mode()),
+	}
+	if b.opts.sizes && node.Type == "file" {
+		size := info.Size()
+		node.Size = &size
+	}
+	if b.opts.mtimes {
+		node.ModTime = info.ModTime().UTC().Format(time.RFC3339)
+	}
+	if b.opts.permissions {
+		node.Mode = info.Mode().String()
+	}
+	if node.Type == "symlink" {
+		if target, err := b.fs.Readlink(ctx, relPath); err == nil {
+			node.Target = target
+		}
+	}
+	return node
+}
+
+// expand reads the children of a directory node up to the configured depth
+func (b *treeBuilder) expand(ctx context.Context, node *treeNode, relPath string, depth int) error {
+	if depth >= b.opts.maxDepth {
+		node.Truncated = true
+		return nil
+	}
+
+	entries, err := b.fs.ReadDir(ctx, relPath)
+	if err != nil {
+		return err
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+
+	node.Counts = &treeCounts{}
+	for _, entry := range entries {
+		if policy.ShouldSkip(entry.Name()) {
+			continue
+		}
+		if entry.IsDir() {
+			node.Counts.Dirs++
+		} else {
+			node.Counts.Files++
+		}
+	}
+
+	for _, entry := range entries {
+		if policy.ShouldSkip(entry.Name()) {
+			continue
+		}
+		if b.entries >= b.opts.maxEntries {
+			node.Truncated = true
+			b.limited = true
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		childPath := filepath.Join(relPath, entry.Name())
+		child := b.newNode(ctx, childPath, entry.Name(), info)
+		node.Children = append(node.Children, child)
+		b.entries++
+
+		if child.Type == "dir" {
+			if err := b.expand(ctx, child, childPath, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// formatSize renders a byte count in a compact human readable form
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%dB", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%c", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+// renderTree writes an indented text representation of the tree
+func renderTree(sb *strings.Builder, node *treeNode, prefix string) {
+	for i, child := range node.Children {
+		last := i == len(node.Children)-1 && !node.Truncated
+		branch, indent := "├── ", "│   "
+		if last {
+			branch, indent = "└── ", "    "
+		}
+
+		sb.WriteString(prefix + branch + child.label() + "\n")
+		if child.Type == "dir" {
+			renderTree(sb, child, prefix+indent)
+		}
+	}
+	if node.Truncated && len(node.Children) > 0 {
+		sb.WriteString(prefix + "└── ...\n")
+	}
+}
+
+// label returns the single-line text representation of a node
+func (n *treeNode) label() string {
+	label := n.Name
+	switch n.Type {
+	case "dir":
+		label += "/"
+	case "symlink":
+		if n.Target != "" {
+			label += " -> " + n.Target
+		}
+	}
+
+	var meta []string
+	if n.Counts != nil {
+		meta = append(meta, fmt.Sprintf("%d files, %d dirs", n.Counts.Files, n.Counts.Dirs))
+	}
+	if n.Size != nil {
+		meta = append(meta, formatSize(*n.Size))
+	}
+	if n.Mode != "" {
+		meta = append(meta, n.Mode)
+	}
+	if n.ModTime != "" {
+		meta = append(meta, n.ModTime)
+	}
+	if len(meta) > 0 {
+		label += "  [" + strings.Join(meta, ", ") + "]"
+	}
+	return label
+}
+
+// intArgument reads a numeric tool argument, which JSON decodes as float64
+func intArgument(arguments map[string]interface{}, name string, def int) int {
+	if v, ok := arguments[name].(float64); ok {
+		return int(v)
+	}
+	return def
+}
+
+func (s *Server) handleTree(ctx context.Context, arguments map[string]interface{}) (*mcp.CallToolResult, error) {
+	repo, ok := arguments["repo"].(string)
+	if !ok {
+		return mcp.NewToolResultError("repo parameter is required"), nil
+	}
+
+	path := "."
+	if p, ok := arguments["path"].(string); ok {
+		path = p
+	}
+
+	format := "text"
+	if f, ok := arguments["format"].(string); ok {
+		format = f
+	}
+	if format != "text" && format != "json" {
+		return mcp.NewToolResultError(fmt.Sprintf("Invalid format: %s (expected 'text' or 'json')", format)), nil
+	}
+
+	opts := treeOptions{
+		maxDepth:   intArgument(arguments, "max_depth", defaultTreeDepth),
+		maxEntries: intArgument(arguments, "max_entries", defaultTreeEntries),
+	}
+	opts.sizes, _ = arguments["sizes"].(bool)
+	opts.mtimes, _ = arguments["mtimes"].(bool)
+	opts.permissions, _ = arguments["permissions"].(bool)
+	if opts.maxDepth < 1 {
+		opts.maxDepth = 1
+	}
+	if opts.maxEntries < 1 {
+		opts.maxEntries = defaultTreeEntries
+	}
+
+	fs, err := s.FileSystem(ctx, repo)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	relPath, err := policy.ValidatePath(fs.BasePath(), path)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	info, err := fs.Stat(ctx, relPath)
+	if err != nil {
+		return mcp.NewToolResultError(statError(err, "Path does not exist: %s", path).Error()), nil
+	}
+
+	if !info.IsDir() {
+		return mcp.NewToolResultError(fmt.Sprintf("Path is not a directory: %s", path)), nil
+	}
+
+	b := &treeBuilder{fs: fs, opts: opts}
+	root := b.newNode(ctx, relPath, path, info)
+	root.Type = "dir"
+	if err := b.expand(ctx, root, relPath, 0); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	if format == "json" {
+		result := map[string]interface{}{
+			"repository": repo,
+			"path":       path,
+			"entries":    b.entries,
+			"truncated":  b.limited,
+			"tree":       root,
+		}
+		jsonResult, _ := json.MarshalIndent(result, "", "  ")
+		return mcp.NewToolResultText(string(jsonResult)), nil
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("Tree: %s/%s\n\n", repo, path))
+	sb.WriteString(root.label() + "\n")
+	renderTree(&sb, root, "")
+	if b.limited {
+		sb.WriteString(fmt.Sprintf("\n(output truncated at %d entries)\n", opts.maxEntries))
+	}
+	return mcp.NewToolResultText(sb.String()), nil
+}
@@ -0,0 +1,216 @@
+package server
+
+import (
+	"regexp/syntax"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// trigramOp is the kind of node in a trigram query
+type trigramOp int
+
+const (
+	trigramAll trigramOp = iota // matches every file (no constraint)
+	trigramAnd
+	trigramOr
+)
+
+// trigramQuery describes which trigrams a file must contain for a regular expression
+// to possibly match it. Trigrams are computed over lower-cased text so that one index
+// serves both case-sensitive and case-insensitive searches.
+type trigramQuery struct {
+	op       trigramOp
+	trigrams []uint32
+	subs     []*trigramQuery
+}
+
+var matchAll = &trigramQuery{op: trigramAll}
+
+// packTrigram packs three bytes into a trigram key
+func packTrigram(a, b, c byte) uint32 {
+	return uint32(a)<<16 | uint32(b)<<8 | uint32(c)
+}
+
+// extractTrigrams returns the sorted, de-duplicated trigrams of lower-cased content
+func extractTrigrams(content []byte) []uint32 {
+	if len(content) < 3 {
+		return nil
+	}
+	seen := make(map[uint32]struct{})
+	lower := func(b byte) byte {
+		if 'A' <= b && b <= 'Z' {
+			return b + 'a' - 'A'
+		}
+		return b
+	}
+	a, b := lower(content[0]), lower(content[1])
+	for i := 2; i < len(content); i++ {
+		c := lower(content[i])
+		if a != '\n' && b != '\n' && c != '\n' {
+			seen[packTrigram(a, b, c)] = struct{}{}
+		}
+		a, b = b, c
+	}
+
+	trigrams := make([]uint32, 0, len(seen))
+	for t := range seen {
+		trigrams = append(trigrams, t)
+	}
+	sort.Slice(trigrams, func(i, j int) bool { return trigrams[i] < trigrams[j] })
+	return trigrams
+}
+
+// asciiLower lower-cases ASCII letters only, matching how content trigrams are extracted
+func asciiLower(s string) string {
+	return strings.Map(func(r rune) rune {
+		if 'A' <= r && r <= 'Z' {
+			return r + 'a' - 'A'
+		}
+		return r
+	}, s)
+}
+
+// indexableLiteral reports whether a literal node can be turned into trigrams. Case-folded
+// non-ASCII literals cannot, since content is only lower-cased for ASCII.
+func indexableLiteral(re *syntax.Regexp) bool {
+	if re.Flags&syntax.FoldCase == 0 {
+		return true
+	}
+	for _, r := range re.Rune {
+		if r > unicode.MaxASCII {
+			return false
+		}
+	}
+	return true
+}
+
+// literalQuery requires all trigrams of a literal string
+func literalQuery(lit string) *trigramQuery {
+	lit = asciiLower(lit)
+	if len(lit) < 3 {
+		return matchAll
+	}
+	trigrams := extractTrigrams([]byte(lit))
+	if len(trigrams) == 0 {
+		return matchAll
+	}
+	return &trigramQuery{op: trigramAnd, trigrams: trigrams}
+}
+
+// andQuery combines queries that must all hold
+func andQuery(qs ...*trigramQuery) *trigramQuery {
+	var subs []*trigramQuery
+	for _, q := range qs {
+		if q.op != trigramAll {
+			subs = append(subs, q)
+		}
+	}
+	switch len(subs) {
+	case 0:
+		return matchAll
+	case 1:
+		return subs[0]
+	}
+	return &trigramQuery{op: trigramAnd, subs: subs}
+}
+
+// orQuery combines alternatives; any unconstrained alternative makes the whole query unconstrained
+func orQuery(qs ...*trigramQuery) *trigramQuery {
+	for _, q := range qs {
+		if q.op == trigramAll {
+			return matchAll
+		}
+	}
+	if len(qs) == 1 {
+		return qs[0]
+	}
+	return &trigramQuery{op: trigramOr, subs: qs}
+}
+
+// compileTrigramQuery derives a trigram query from a regular expression. It is
+// conservative: any construct it does not understand is treated as matching everything.
+func compileTrigramQuery(pattern string) *trigramQuery {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return matchAll
+	}
+	return regexpQuery(re.Simplify())
+}
+
+// regexpQuery walks a parsed regular expression collecting required literals
+func regexpQuery(re *syntax.Regexp) *trigramQuery {
+	switch re.Op {
+	case syntax.OpLiteral:
+		if !indexableLiteral(re) {
+			return matchAll
+		}
+		return literalQuery(string(re.Rune))
+	case syntax.OpCapture, syntax.OpPlus:
+		return regexpQuery(re.Sub[0])
+	case syntax.OpRepeat:
+		if re.Min >= 1 {
+			return regexpQuery(re.Sub[0])
+		}
+		return matchAll
+	case syntax.OpAlternate:
+		subs := make([]*trigramQuery, len(re.Sub))
+		for i, sub := range re.Sub {
+			subs[i] = regexpQuery(sub)
+		}
+		return orQuery(subs...)
+	case syntax.OpConcat:
+		// Adjacent literals are joined so trigrams spanning them are required too
+		var parts []*trigramQuery
+		var run strings.Builder
+		flush := func() {
+			if run.Len() > 0 {
+				parts = append(parts, literalQuery(run.String()))
+				run.Reset()
+			}
+		}
+		for _, sub := range re.Sub {
+			if sub.Op == syntax.OpLiteral && indexableLiteral(sub) {
+				run.WriteString(string(sub.Rune))
+				continue
+			}
+			flush()
+			parts = append(parts, regexpQuery(sub))
+		}
+		flush()
+		return andQuery(parts...)
+	}
+	return matchAll
+}
+
+// hasTrigram reports whether the sorted trigram set contains t
+func hasTrigram(set []uint32, t uint32) bool {
+	i := sort.Search(len(set), func(i int) bool { return set[i] >= t })
+	return i < len(set) && set[i] == t
+}
+
+// matches evaluates the query against a file's sorted trigram set
+func (q *trigramQuery) matches(set []uint32) bool {
+	switch q.op {
+	case trigramAnd:
+		for _, t := range q.trigrams {
+			if !hasTrigram(set, t) {
+				return false
+			}
+		}
+		for _, sub := range q.subs {
+			if !sub.matches(set) {
+				return false
+			}
+		}
+		return true
+	case trigramOr:
+		for _, sub := range q.subs {
+			if sub.matches(set) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}